@@ -0,0 +1,552 @@
+// cli.go - One-shot maintenance commands
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/convert"
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/export"
+	"github.com/sstent/garminsync-go/internal/processors"
+	"github.com/sstent/garminsync-go/internal/sync"
+)
+
+// runCommand executes a maintenance command given on the command line
+func (app *App) runCommand(args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "sync":
+		return app.syncCommand(ctx, args[1:])
+	case "plan":
+		return app.planCommand(ctx, args[1:])
+	case "verify":
+		return app.verifyCommand(ctx, args[1:])
+	case "convert":
+		return app.convertCommand(args[1:])
+	case "export":
+		return app.exportCommand(ctx, args[1:])
+	case "summaries":
+		return app.summariesCommand(ctx, args[1:])
+	case "parquet":
+		return app.parquetCommand(ctx, args[1:])
+	case "influx":
+		return app.influxCommand(ctx, args[1:])
+	case "import":
+		return app.importCommand(ctx, args[1:])
+	case "reprocess":
+		return app.reprocessCommand(ctx, args[1:])
+	case "duplicates":
+		return app.duplicatesCommand()
+	case "help", "-h", "--help":
+		printUsage()
+		return nil
+	}
+
+	printUsage()
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func printUsage() {
+	fmt.Println(`Usage: garminsync [command] [flags]
+
+Without a command, garminsync runs the web server and scheduler.
+
+Commands:
+  sync         sync activities now, optionally backfilling a date window
+  plan         show what a sync would download without changing anything
+  verify       check archived files against the database and repair them
+  reprocess    parse archived files again to update metrics and laps
+  import       add FIT, GPX and TCX files from directories or ZIP archives
+  export       write activity files and manifests to a ZIP or tar.gz archive
+  summaries    write activity summaries as CSV or JSON Lines
+  parquet      write activities, laps and records as partitioned Parquet files
+  influx       backfill archived activities to InfluxDB as line protocol
+  convert      write an activity or activity file as GPX or TCX
+  duplicates   list activities whose archived files have identical content`)
+}
+
+// syncFlags registers the flags shared by sync and plan. The returned
+// function builds the options once the flags are parsed.
+func syncFlags(flags *flag.FlagSet) func() (sync.Options, error) {
+	from := flags.String("from", "", "only sync activities on or after this date (YYYY-MM-DD)")
+	to := flags.String("to", "", "only sync activities on or before this date (YYYY-MM-DD)")
+	force := flags.Bool("force", false, "re-download activities even if they are unchanged")
+	full := flags.Bool("full", false, "list the whole account instead of stopping at stored activities")
+
+	return func() (sync.Options, error) {
+		opts := sync.Options{Trigger: sync.TriggerManual, Force: *force}
+		if *full {
+			opts.Mode = sync.ModeFull
+		}
+		var err error
+		opts.From, opts.To, err = sync.ParseWindow(*from, *to)
+		return opts, err
+	}
+}
+
+func (app *App) syncCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	options := syncFlags(flags)
+	flags.Parse(args)
+
+	opts, err := options()
+	if err != nil {
+		return err
+	}
+
+	run, err := app.syncService.Run(ctx, opts)
+	if run != nil {
+		fmt.Printf("Run %d %s: %d found, %d new, %d updated, %d failed\n",
+			run.ID, run.Status, run.Found, run.New, run.Updated, run.Failed)
+	}
+	return err
+}
+
+func (app *App) planCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	options := syncFlags(flags)
+	asJSON := flags.Bool("json", false, "print the plan as JSON")
+	flags.Parse(args)
+
+	opts, err := options()
+	if err != nil {
+		return err
+	}
+	plan, err := app.syncService.Plan(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tID\tSTART\tTYPE\tNAME\tEST. SIZE\tREASON")
+	for _, items := range [][]sync.PlanItem{plan.New, plan.Changed, plan.Deleted, plan.Skipped, plan.Blocked} {
+		for _, item := range items {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", item.Action, item.ActivityID, item.StartTime,
+				item.ActivityType, item.Name, formatBytes(item.EstimatedBytes), item.Reason)
+		}
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Printf("Listed:     %d (%s mode)\n", plan.Remote, plan.Mode)
+	fmt.Printf("New:        %d\n", len(plan.New))
+	fmt.Printf("Changed:    %d\n", len(plan.Changed))
+	if plan.DeletionsChecked {
+		fmt.Printf("Deleted:    %d\n", len(plan.Deleted))
+	} else {
+		fmt.Println("Deleted:    not checked (use -full without a date window)")
+	}
+	fmt.Printf("Skipped:    %d\n", len(plan.Skipped))
+	fmt.Printf("Blocked:    %d (retry queue)\n", len(plan.Blocked))
+	fmt.Printf("Unchanged:  %d\n", plan.Unchanged)
+	fmt.Printf("Downloads:  %d, about %s\n", plan.EstimatedDownloads, formatBytes(plan.EstimatedDownloadBytes))
+	return nil
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+func (app *App) verifyCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	repair := flags.Bool("repair", true, "re-download missing or corrupt files")
+	flags.Parse(args)
+
+	report, err := app.syncService.Verify(ctx, sync.VerifyOptions{Repair: *repair})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Checked:           %d\n", report.Checked)
+	fmt.Printf("OK:                %d (%d baselined)\n", report.OK, report.Baselined)
+	fmt.Printf("Missing:           %v\n", report.Missing)
+	fmt.Printf("Size mismatch:     %v\n", report.SizeMismatch)
+	fmt.Printf("Checksum mismatch: %v\n", report.ChecksumMismatch)
+	fmt.Printf("Repaired:          %v\n", report.Repaired)
+	for _, path := range report.UntrackedFiles {
+		fmt.Printf("Untracked file:    %s\n", path)
+	}
+	for _, group := range report.Duplicates {
+		fmt.Printf("Duplicate content: %v\n", group.ActivityIDs)
+	}
+	for _, msg := range report.Errors {
+		fmt.Printf("Error:             %s\n", msg)
+	}
+
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("verification finished with %d errors", len(report.Errors))
+	}
+	return nil
+}
+
+func (app *App) importCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "list duplicate files as well as imported and failed ones")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: garminsync import [-v] <directory or zip>...")
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		report, err := app.syncService.Import(ctx, path)
+		if err != nil {
+			return err
+		}
+		for _, result := range report.Files {
+			switch {
+			case result.Status == sync.ImportImported:
+				fmt.Printf("Imported   %s as activity %d\n", result.Path, result.ActivityID)
+			case result.Status == sync.ImportFailed:
+				fmt.Printf("Failed     %s: %s\n", result.Path, result.Error)
+			case *verbose:
+				fmt.Printf("Duplicate  %s of activity %d\n", result.Path, result.DuplicateOf)
+			}
+		}
+		failed += report.Failed
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("import finished with %d failed files", failed)
+	}
+	return nil
+}
+
+func (app *App) convertCommand(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	format := flags.String("format", convert.FormatGPX, "output format: gpx or tcx")
+	output := flags.String("o", "", "output file (default stdout)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: garminsync convert [-format gpx|tcx] [-o file] <activity id or file>")
+	}
+
+	// The argument is either a stored activity or a file on disk
+	filename, name, activityType := flags.Arg(0), "", ""
+	if id, err := strconv.Atoi(flags.Arg(0)); err == nil {
+		activity, err := app.db.GetActivity(id)
+		if err != nil {
+			return err
+		}
+		if !activity.Downloaded || activity.Filename == "" {
+			return fmt.Errorf("activity %d has no stored file", id)
+		}
+		filename, name, activityType = activity.Filename, activity.ActivityName, activity.ActivityType
+	}
+
+	activity, err := convert.FromFile(filename, name, activityType)
+	if err != nil {
+		return err
+	}
+	if activity.Type == "" {
+		activity.Type = activity.Metrics.ActivityType
+	}
+	if activity.Name == "" {
+		activity.Name = activity.Metrics.Name
+	}
+
+	if *output == "" {
+		return convert.Write(os.Stdout, *format, activity)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := convert.Write(f, *format, activity); err != nil {
+		f.Close()
+		os.Remove(*output)
+		return err
+	}
+	return f.Close()
+}
+
+func (app *App) exportCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "output archive")
+	archive := flags.String("archive", export.ArchiveZip, "archive format: zip or tar.gz")
+	formats := flags.String("formats", export.FormatOriginal, "comma-separated file formats: original, fit, gpx, tcx")
+	activityType := flags.String("type", "", "only export activities of this type")
+	from := flags.String("from", "", "only export activities on or after this date (YYYY-MM-DD)")
+	to := flags.String("to", "", "only export activities on or before this date (YYYY-MM-DD)")
+	cursor := flags.String("cursor", "", "resume after the activities of an earlier export")
+	limit := flags.Int("limit", 0, "maximum number of activities in the archive (0 for all)")
+	flags.Parse(args)
+
+	if *output == "" || flags.NArg() != 0 {
+		return fmt.Errorf("usage: garminsync export -o file [-archive zip|tar.gz] [-formats original,gpx,tcx] [-type type] [-from date] [-to date] [-cursor cursor] [-limit n]")
+	}
+
+	opts := export.Options{
+		ActivityType: *activityType,
+		Formats:      strings.Split(*formats, ","),
+		Archive:      *archive,
+		Cursor:       *cursor,
+		Limit:        *limit,
+	}
+	var err error
+	opts.From, opts.To, err = sync.ParseWindow(*from, *to)
+	if err != nil {
+		return err
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	result, err := export.New(app.db).Write(ctx, f, opts)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+
+	for _, msg := range result.Errors {
+		fmt.Printf("Error: %s\n", msg)
+	}
+	fmt.Printf("Exported %d activities (%d files) to %s\n", result.Activities, result.Files, *output)
+	if result.NextCursor != "" {
+		fmt.Printf("More activities remain; continue with -cursor %s\n", result.NextCursor)
+	}
+	return nil
+}
+
+func (app *App) summariesCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("summaries", flag.ExitOnError)
+	format := flags.String("format", export.SummaryCSV, "output format: csv or jsonl")
+	output := flags.String("o", "", "output file, replaced once complete (default stdout)")
+	columns := flags.String("columns", "", "comma-separated columns to write (default all): "+strings.Join(export.ColumnNames(), ","))
+	units := flags.String("units", export.UnitsMetric, "units: metric or imperial")
+	activityType := flags.String("type", "", "only write activities of this type")
+	from := flags.String("from", "", "only write activities on or after this date (YYYY-MM-DD)")
+	to := flags.String("to", "", "only write activities on or before this date (YYYY-MM-DD)")
+	sortBy := flags.String("sort", "start_time", "column to sort by")
+	order := flags.String("order", "desc", "sort order: asc or desc")
+	limit := flags.Int("limit", 0, "maximum number of activities (0 for all)")
+	flags.Parse(args)
+
+	opts := export.SummaryOptions{
+		Filters: database.ActivityFilters{
+			ActivityType: *activityType,
+			SortBy:       *sortBy,
+			SortOrder:    *order,
+			Limit:        *limit,
+		},
+		Units: *units,
+	}
+	if *columns != "" {
+		opts.Columns = strings.Split(*columns, ",")
+	}
+	start, end, err := sync.ParseWindow(*from, *to)
+	if err != nil {
+		return err
+	}
+	if !start.IsZero() {
+		opts.Filters.DateFrom = &start
+	}
+	if !end.IsZero() {
+		end = end.Add(-time.Second)
+		opts.Filters.DateTo = &end
+	}
+
+	exporter := export.New(app.db)
+	if *output == "" {
+		_, err := exporter.WriteSummaries(ctx, os.Stdout, *format, opts)
+		return err
+	}
+
+	// Write next to the output and rename, so a scheduled dump never
+	// leaves a partial file in place of the previous one
+	f, err := os.CreateTemp(filepath.Dir(*output), filepath.Base(*output)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	rows, err := exporter.WriteSummaries(ctx, f, *format, opts)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), *output); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d activities to %s\n", rows, *output)
+	return nil
+}
+
+func (app *App) parquetCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("parquet", flag.ExitOnError)
+	output := flags.String("o", "", "output directory (default <data dir>/parquet)")
+	datasets := flags.String("datasets", "", "comma-separated datasets to write: activities, laps, records (default all)")
+	flags.Parse(args)
+
+	var names []string
+	if *datasets != "" {
+		names = strings.Split(*datasets, ",")
+	}
+	result, err := app.syncService.ExportParquet(ctx, *output, names)
+	if err != nil {
+		return err
+	}
+	for _, msg := range result.Errors {
+		fmt.Printf("Error: %s\n", msg)
+	}
+	return nil
+}
+
+func (app *App) influxCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("influx", flag.ExitOnError)
+	target := flags.String("target", os.Getenv("INFLUX_TARGET"), "- for stdout, an InfluxDB write URL, or a file to append to (default $INFLUX_TARGET or -)")
+	defaults := influxOptions(*target)
+	token := flags.String("token", defaults.Token, "API token for the write URL (default $INFLUX_TOKEN)")
+	batchSize := flags.Int("batch", defaults.BatchSize, "lines per write (default 5000)")
+	maxRetries := flags.Int("retries", defaults.MaxRetries, "retries of a failed HTTP write (default 3)")
+	timeout := flags.Duration("timeout", 5*time.Minute, "time allowed to write each activity")
+	activityType := flags.String("type", "", "only backfill activities of this type")
+	from := flags.String("from", "", "only backfill activities on or after this date (YYYY-MM-DD)")
+	to := flags.String("to", "", "only backfill activities on or before this date (YYYY-MM-DD)")
+	flags.Parse(args)
+	if *target == "" {
+		*target = "-"
+	}
+
+	opts := sync.BackfillOptions{
+		ActivityType: *activityType,
+		Timeout:      *timeout,
+		Progress: func(report sync.BackfillReport) {
+			if report.Processed%100 == 0 || report.Processed == report.Total {
+				fmt.Fprintf(os.Stderr, "Backfilled %d/%d (%d failed)\n", report.Processed, report.Total, report.Failed)
+			}
+		},
+	}
+	var err error
+	opts.From, opts.To, err = sync.ParseWindow(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	influx, err := processors.NewInflux(processors.InfluxOptions{
+		Target:     *target,
+		Token:      *token,
+		BatchSize:  *batchSize,
+		MaxRetries: *maxRetries,
+	})
+	if err != nil {
+		return err
+	}
+	defer influx.Close()
+
+	report, err := app.syncService.Backfill(ctx, influx, opts)
+	if err != nil {
+		return err
+	}
+	for _, msg := range report.Errors {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", msg)
+	}
+	fmt.Fprintf(os.Stderr, "Backfilled %d of %d activities to %s\n", report.Processed-report.Failed, report.Total, *target)
+	if report.Failed > 0 {
+		return fmt.Errorf("backfill finished with %d failures", report.Failed)
+	}
+	return nil
+}
+
+func (app *App) reprocessCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reprocess", flag.ExitOnError)
+	activityType := flags.String("type", "", "only reprocess activities of this type")
+	from := flags.String("from", "", "only reprocess activities on or after this date (YYYY-MM-DD)")
+	to := flags.String("to", "", "only reprocess activities on or before this date (YYYY-MM-DD)")
+	workers := flags.Int("workers", runtime.NumCPU(), "number of files to parse in parallel")
+	flags.Parse(args)
+
+	opts := sync.ReprocessOptions{
+		ActivityType: *activityType,
+		Workers:      *workers,
+		Progress: func(report sync.ReprocessReport) {
+			if report.Processed%100 == 0 || report.Processed == report.Total {
+				fmt.Printf("Reprocessed %d/%d (%d failed)\n", report.Processed, report.Total, report.Failed)
+			}
+		},
+	}
+	var err error
+	opts.From, opts.To, err = sync.ParseWindow(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	report, err := app.syncService.Reprocess(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, msg := range report.Errors {
+		fmt.Printf("Error: %s\n", msg)
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("reprocess finished with %d failures", report.Failed)
+	}
+	return nil
+}
+
+func (app *App) duplicatesCommand() error {
+	groups, err := app.db.FindDuplicateFiles()
+	if err != nil {
+		return err
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No duplicate files found")
+		return nil
+	}
+	for _, group := range groups {
+		fmt.Printf("%s  %8d bytes  activities %v\n", group.FileSHA256, group.FileSize, group.ActivityIDs)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package convert writes parsed activities in the GPX and TCX formats.
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/sstent/garminsync-go/internal/models"
+	"github.com/sstent/garminsync-go/internal/parser"
+)
+
+// Formats the package can write
+const (
+	FormatGPX = "gpx"
+	FormatTCX = "tcx"
+)
+
+// Version identifies the output of Write. Bump it whenever a change alters
+// the files written for the same input, so caches keyed on it are refreshed.
+const Version = "1"
+
+// ErrUnsupportedFormat is returned by Write for formats it cannot produce
+var ErrUnsupportedFormat = errors.New("unsupported output format")
+
+// Activity is a parsed activity together with the descriptive fields the
+// output formats carry
+type Activity struct {
+	Name    string
+	Type    string // Garmin Connect activity type, e.g. running
+	Metrics *models.ActivityMetrics
+}
+
+// Write writes the activity to w in the given format
+func Write(w io.Writer, format string, activity Activity) error {
+	switch format {
+	case FormatGPX:
+		return WriteGPX(w, activity)
+	case FormatTCX:
+		return WriteTCX(w, activity)
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+// roundAltitude rounds an altitude to the centimetre. FIT altitudes have a
+// 0.2 m resolution, and the float noise of their scaling would otherwise be
+// written out as long decimals.
+func roundAltitude(altitude float64) float64 {
+	return math.Round(altitude*100) / 100
+}
+
+// ContentType returns the MIME type of an activity file format
+func ContentType(format string) string {
+	switch format {
+	case "fit":
+		return "application/vnd.ant.fit"
+	case FormatGPX:
+		return "application/gpx+xml"
+	case FormatTCX:
+		return "application/vnd.garmin.tcx+xml"
+	}
+	return "application/octet-stream"
+}
+
+// FromFile parses a stored FIT, GPX or TCX file into an Activity ready to
+// be written in another format
+func FromFile(filename, name, activityType string) (Activity, error) {
+	metrics, err := parser.NewParser().ParseFile(filename)
+	if err != nil {
+		return Activity{}, err
+	}
+	return Activity{Name: name, Type: activityType, Metrics: metrics}, nil
+}
@@ -0,0 +1,199 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/models"
+	"github.com/sstent/garminsync-go/internal/parser"
+	"github.com/tormoder/fit"
+)
+
+// metersPerDegree is the length of a degree of latitude on the sphere the
+// parser measures track distances on
+const metersPerDegree = 6371008.8 * math.Pi / 180
+
+var fixtureStart = time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC)
+
+// fitFixture encodes a two-lap run of 20 one-second records heading north
+// at 3 m/s, with heart rate, cadence, power and altitude streams
+func fitFixture(t *testing.T) []byte {
+	t.Helper()
+	file, err := fit.NewFile(fit.FileTypeActivity, fit.NewHeader(fit.V20, false))
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	file.FileId.SerialNumber = 3999
+	activity, err := file.Activity()
+	if err != nil {
+		t.Fatalf("Activity: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		record := fit.NewRecordMsg()
+		record.Timestamp = fixtureStart.Add(time.Duration(i) * time.Second)
+		record.PositionLat = fit.NewLatitudeDegrees(47 + float64(i)*3/metersPerDegree)
+		record.PositionLong = fit.NewLongitudeDegrees(8)
+		record.Altitude = uint16((400 + float64(i)*0.2 + 500) * 5)
+		record.Distance = uint32(i * 300)
+		record.Speed = 3000
+		record.HeartRate = uint8(120 + i)
+		record.Cadence = uint8(80 + i%3)
+		record.Power = uint16(200 + i)
+		activity.Records = append(activity.Records, record)
+	}
+
+	for i, lap := range []struct {
+		offset, timer, distance int // s, ms, cm
+		avgHR, maxHR, cadence   uint8
+		avgPower, maxPower      uint16
+		calories                uint16
+	}{
+		{0, 10000, 3000, 124, 129, 81, 204, 209, 3},
+		{10, 9000, 2700, 134, 139, 81, 214, 219, 2},
+	} {
+		msg := fit.NewLapMsg()
+		msg.MessageIndex = fit.MessageIndex(i)
+		msg.StartTime = fixtureStart.Add(time.Duration(lap.offset) * time.Second)
+		msg.Timestamp = msg.StartTime.Add(time.Duration(lap.timer) * time.Millisecond)
+		msg.TotalTimerTime = uint32(lap.timer)
+		msg.TotalDistance = uint32(lap.distance)
+		msg.AvgSpeed, msg.MaxSpeed = 3000, 3000
+		msg.AvgHeartRate, msg.MaxHeartRate = lap.avgHR, lap.maxHR
+		msg.AvgCadence, msg.MaxCadence = lap.cadence, 82
+		msg.AvgPower, msg.MaxPower = lap.avgPower, lap.maxPower
+		msg.TotalCalories = lap.calories
+		activity.Laps = append(activity.Laps, msg)
+	}
+
+	session := fit.NewSessionMsg()
+	session.StartTime = fixtureStart
+	session.Timestamp = fixtureStart.Add(19 * time.Second)
+	session.Sport = fit.SportRunning
+	session.TotalTimerTime = 19000
+	session.TotalDistance = 5700
+	session.TotalCalories = 5
+	session.AvgHeartRate, session.MaxHeartRate = 129, 139
+	session.AvgPower = 209
+	activity.Sessions = append(activity.Sessions, session)
+
+	var buf bytes.Buffer
+	if err := fit.Encode(&buf, file, binary.LittleEndian); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// parseFixture parses the FIT fixture the way stored files are parsed
+func parseFixture(t *testing.T) *models.ActivityMetrics {
+	t.Helper()
+	metrics, err := parser.NewParser().ParseFIT(fitFixture(t))
+	if err != nil {
+		t.Fatalf("ParseFIT: %v", err)
+	}
+	if len(metrics.Records) != 20 || len(metrics.Laps) != 2 {
+		t.Fatalf("fixture parsed to %d records and %d laps, want 20 and 2", len(metrics.Records), len(metrics.Laps))
+	}
+	return metrics
+}
+
+func TestGPXRoundTrip(t *testing.T) {
+	source := parseFixture(t)
+	var buf bytes.Buffer
+	if err := WriteGPX(&buf, Activity{Name: "Morning Run", Type: "running", Metrics: source}); err != nil {
+		t.Fatalf("WriteGPX: %v", err)
+	}
+	got, err := parser.NewParser().ParseGPX(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseGPX: %v\n%s", err, buf.Bytes())
+	}
+
+	if !got.StartTime.Equal(source.StartTime) {
+		t.Errorf("start time = %v, want %v", got.StartTime, source.StartTime)
+	}
+	if got.Name != "Morning Run" || got.ActivityType != "running" {
+		t.Errorf("name, type = %q, %q", got.Name, got.ActivityType)
+	}
+	// GPX has no distance of its own; the track length comes back within
+	// the precision of FIT positions
+	if math.Abs(got.Distance-source.Distance) > 0.5 {
+		t.Errorf("distance = %.2f, want %.2f", got.Distance, source.Distance)
+	}
+	if got.AvgHeartRate != source.AvgHeartRate || got.MaxHeartRate != source.MaxHeartRate {
+		t.Errorf("heart rate = %d/%d, want %d/%d", got.AvgHeartRate, got.MaxHeartRate, source.AvgHeartRate, source.MaxHeartRate)
+	}
+	// GPX has neither laps nor a power field
+	if len(got.Laps) != 0 || got.AvgPower != 0 {
+		t.Errorf("laps %d, power %d; GPX carries neither", len(got.Laps), got.AvgPower)
+	}
+
+	if len(got.Records) != len(source.Records) {
+		t.Fatalf("%d records, want %d", len(got.Records), len(source.Records))
+	}
+	for i, want := range source.Records {
+		record := got.Records[i]
+		if !record.Time.Equal(want.Time) || record.HeartRate != want.HeartRate || record.Cadence != want.Cadence {
+			t.Errorf("record %d = %v hr %d cad %d, want %v hr %d cad %d", i,
+				record.Time, record.HeartRate, record.Cadence, want.Time, want.HeartRate, want.Cadence)
+		}
+		if record.Altitude != roundAltitude(want.Altitude) {
+			t.Errorf("record %d altitude = %v, want %v", i, record.Altitude, roundAltitude(want.Altitude))
+		}
+	}
+}
+
+func TestTCXRoundTrip(t *testing.T) {
+	source := parseFixture(t)
+	var buf bytes.Buffer
+	if err := WriteTCX(&buf, Activity{Name: "Morning Run", Type: "running", Metrics: source}); err != nil {
+		t.Fatalf("WriteTCX: %v", err)
+	}
+	got, err := parser.NewParser().ParseTCX(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseTCX: %v\n%s", err, buf.Bytes())
+	}
+
+	if !got.StartTime.Equal(source.StartTime) {
+		t.Errorf("start time = %v, want %v", got.StartTime, source.StartTime)
+	}
+	if got.ActivityType != "running" {
+		t.Errorf("activity type = %q, want running", got.ActivityType)
+	}
+	if got.Distance != source.Distance || got.Duration != source.Duration || got.Calories != source.Calories {
+		t.Errorf("distance, duration, calories = %v, %v, %d; want %v, %v, %d",
+			got.Distance, got.Duration, got.Calories, source.Distance, source.Duration, source.Calories)
+	}
+	if got.AvgHeartRate != source.AvgHeartRate || got.MaxHeartRate != source.MaxHeartRate {
+		t.Errorf("heart rate = %d/%d, want %d/%d", got.AvgHeartRate, got.MaxHeartRate, source.AvgHeartRate, source.MaxHeartRate)
+	}
+	if got.AvgPower != source.AvgPower {
+		t.Errorf("power = %d, want %d", got.AvgPower, source.AvgPower)
+	}
+
+	if len(got.Laps) != len(source.Laps) {
+		t.Fatalf("%d laps, want %d", len(got.Laps), len(source.Laps))
+	}
+	for i, want := range source.Laps {
+		lap := got.Laps[i]
+		// TCX has no maximum lap cadence, and lap elevation is computed
+		// from the track points
+		want.MaxCadence, lap.ElevationGain, lap.ElevationLoss = 0, want.ElevationGain, want.ElevationLoss
+		if lap != want {
+			t.Errorf("lap %d = %+v\nwant %+v", i, lap, want)
+		}
+	}
+
+	if len(got.Records) != len(source.Records) {
+		t.Fatalf("%d records, want %d", len(got.Records), len(source.Records))
+	}
+	for i, want := range source.Records {
+		record := got.Records[i]
+		if !record.Time.Equal(want.Time) || record.Distance != want.Distance || record.HeartRate != want.HeartRate ||
+			record.Cadence != want.Cadence || record.Power != want.Power || record.Speed != want.Speed {
+			t.Errorf("record %d = %+v\nwant %+v", i, record, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+const (
+	gpxNamespace = "http://www.topografix.com/GPX/1/1"
+	gpxSchema    = "http://www.topografix.com/GPX/1/1/gpx.xsd"
+	tpxNamespace = "http://www.garmin.com/xmlschemas/TrackPointExtension/v2"
+	tpxSchema    = "https://www8.garmin.com/xmlschemas/TrackPointExtensionv2.xsd"
+	xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+type gpxDoc struct {
+	XMLName        xml.Name    `xml:"gpx"`
+	Xmlns          string      `xml:"xmlns,attr"`
+	XmlnsTPX       string      `xml:"xmlns:gpxtpx,attr"`
+	XmlnsXSI       string      `xml:"xmlns:xsi,attr"`
+	SchemaLocation string      `xml:"xsi:schemaLocation,attr"`
+	Version        string      `xml:"version,attr"`
+	Creator        string      `xml:"creator,attr"`
+	Metadata       gpxMetadata `xml:"metadata"`
+	Track          gpxTrack    `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+type gpxTrack struct {
+	Name    string     `xml:"name,omitempty"`
+	Type    string     `xml:"type,omitempty"`
+	Segment gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat        float64        `xml:"lat,attr"`
+	Lon        float64        `xml:"lon,attr"`
+	Elevation  *float64       `xml:"ele,omitempty"`
+	Time       string         `xml:"time,omitempty"`
+	Extensions *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+type gpxExtensions struct {
+	TrackPoint gpxTrackPointExtension `xml:"gpxtpx:TrackPointExtension"`
+}
+
+// gpxTrackPointExtension holds Garmin's TrackPointExtension v2 fields, in
+// schema order
+type gpxTrackPointExtension struct {
+	Temperature *float64 `xml:"gpxtpx:atemp,omitempty"`
+	HeartRate   int      `xml:"gpxtpx:hr,omitempty"`
+	Cadence     int      `xml:"gpxtpx:cad,omitempty"`
+}
+
+// WriteGPX writes the activity as a GPX 1.1 track. Heart rate, cadence and
+// temperature go into Garmin's TrackPointExtension. Records without a
+// position are left out, since every GPX track point needs one.
+func WriteGPX(w io.Writer, activity Activity) error {
+	metrics := activity.Metrics
+	doc := gpxDoc{
+		Xmlns:          gpxNamespace,
+		XmlnsTPX:       tpxNamespace,
+		XmlnsXSI:       xsiNamespace,
+		SchemaLocation: gpxNamespace + " " + gpxSchema + " " + tpxNamespace + " " + tpxSchema,
+		Version:        "1.1",
+		Creator:        "garminsync",
+		Metadata: gpxMetadata{
+			Name: activity.Name,
+			Time: formatTime(metrics.StartTime),
+		},
+		Track: gpxTrack{Name: activity.Name, Type: activity.Type},
+	}
+
+	for i := range metrics.Records {
+		record := &metrics.Records[i]
+		if !record.HasPosition {
+			continue
+		}
+		point := gpxPoint{Lat: record.Latitude, Lon: record.Longitude, Time: formatTime(record.Time)}
+		if record.HasAltitude {
+			altitude := roundAltitude(record.Altitude)
+			point.Elevation = &altitude
+		}
+
+		extension := gpxTrackPointExtension{HeartRate: record.HeartRate, Cadence: record.Cadence}
+		if record.HasTemperature {
+			temperature := record.Temperature
+			extension.Temperature = &temperature
+		}
+		if extension != (gpxTrackPointExtension{}) {
+			point.Extensions = &gpxExtensions{TrackPoint: extension}
+		}
+		doc.Track.Segment.Points = append(doc.Track.Segment.Points, point)
+	}
+
+	return writeXML(w, doc)
+}
+
+// writeXML writes an indented XML document with its declaration
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// formatTime formats a timestamp as UTC RFC 3339, the form GPX and TCX use
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,222 @@
+package convert
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/models"
+)
+
+const (
+	tcxNamespace = "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+	tcxSchema    = "http://www.garmin.com/xmlschemas/TrainingCenterDatabasev2.xsd"
+	axNamespace  = "http://www.garmin.com/xmlschemas/ActivityExtension/v2"
+)
+
+type tcxDoc struct {
+	XMLName        xml.Name      `xml:"TrainingCenterDatabase"`
+	Xmlns          string        `xml:"xmlns,attr"`
+	XmlnsAX        string        `xml:"xmlns:ns3,attr"`
+	XmlnsXSI       string        `xml:"xmlns:xsi,attr"`
+	SchemaLocation string        `xml:"xsi:schemaLocation,attr"`
+	Activities     []tcxActivity `xml:"Activities>Activity"`
+}
+
+type tcxActivity struct {
+	Sport string   `xml:"Sport,attr"`
+	ID    string   `xml:"Id"`
+	Laps  []tcxLap `xml:"Lap"`
+}
+
+// tcxLap holds the elements of ActivityLap_t, in schema order
+type tcxLap struct {
+	StartTime        string          `xml:"StartTime,attr"`
+	TotalTimeSeconds float64         `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64         `xml:"DistanceMeters"`
+	MaximumSpeed     float64         `xml:"MaximumSpeed,omitempty"`
+	Calories         int             `xml:"Calories"`
+	AvgHeartRate     *tcxValue       `xml:"AverageHeartRateBpm,omitempty"`
+	MaxHeartRate     *tcxValue       `xml:"MaximumHeartRateBpm,omitempty"`
+	Intensity        string          `xml:"Intensity"`
+	Cadence          int             `xml:"Cadence,omitempty"`
+	TriggerMethod    string          `xml:"TriggerMethod"`
+	Trackpoints      []tcxTrackpoint `xml:"Track>Trackpoint"`
+	Extensions       *tcxLapExt      `xml:"Extensions,omitempty"`
+}
+
+// tcxLapExt is the ActivityExtension v2 lap summary
+type tcxLapExt struct {
+	LX struct {
+		AvgSpeed      float64 `xml:"ns3:AvgSpeed,omitempty"`
+		AvgRunCadence int     `xml:"ns3:AvgRunCadence,omitempty"`
+		AvgWatts      int     `xml:"ns3:AvgWatts,omitempty"`
+		MaxWatts      int     `xml:"ns3:MaxWatts,omitempty"`
+	} `xml:"ns3:LX"`
+}
+
+type tcxTrackpoint struct {
+	Time       string            `xml:"Time"`
+	Position   *tcxPosition      `xml:"Position,omitempty"`
+	Altitude   *float64          `xml:"AltitudeMeters,omitempty"`
+	Distance   float64           `xml:"DistanceMeters"`
+	HeartRate  *tcxValue         `xml:"HeartRateBpm,omitempty"`
+	Cadence    int               `xml:"Cadence,omitempty"`
+	Extensions *tcxTrackpointExt `xml:"Extensions,omitempty"`
+}
+
+// tcxTrackpointExt is the ActivityExtension v2 trackpoint data
+type tcxTrackpointExt struct {
+	TPX struct {
+		Speed      float64 `xml:"ns3:Speed,omitempty"`
+		RunCadence int     `xml:"ns3:RunCadence,omitempty"`
+		Watts      int     `xml:"ns3:Watts,omitempty"`
+	} `xml:"ns3:TPX"`
+}
+
+type tcxPosition struct {
+	Latitude  float64 `xml:"LatitudeDegrees"`
+	Longitude float64 `xml:"LongitudeDegrees"`
+}
+
+type tcxValue struct {
+	Value int `xml:"Value"`
+}
+
+func optionalValue(v int) *tcxValue {
+	if v <= 0 {
+		return nil
+	}
+	return &tcxValue{Value: v}
+}
+
+// tcxSport maps Garmin Connect activity types onto the three sports TCX
+// knows
+func tcxSport(activityType string) string {
+	switch activityType {
+	case "running", "trail_running", "treadmill_running", "track_running":
+		return "Running"
+	case "cycling", "road_biking", "mountain_biking", "gravel_cycling", "indoor_cycling", "virtual_ride":
+		return "Biking"
+	}
+	return "Other"
+}
+
+// WriteTCX writes the activity as a TrainingCenterDatabase v2 document.
+// Each parsed lap becomes a TCX lap holding the records that fall within
+// it; power and speed go into the ActivityExtension v2 elements. Activities
+// without laps are written as a single lap.
+func WriteTCX(w io.Writer, activity Activity) error {
+	metrics := activity.Metrics
+	sport := tcxSport(activity.Type)
+
+	laps := metrics.Laps
+	if len(laps) == 0 {
+		laps = []models.Lap{{
+			StartTime:     metrics.StartTime,
+			Duration:      metrics.Duration,
+			Distance:      metrics.Distance,
+			AvgHeartRate:  metrics.AvgHeartRate,
+			MaxHeartRate:  metrics.MaxHeartRate,
+			AvgPower:      metrics.AvgPower,
+			Calories:      metrics.Calories,
+			ElevationGain: metrics.ElevationGain,
+			ElevationLoss: metrics.ElevationLoss,
+		}}
+	}
+
+	records := metrics.Records
+	tcxLaps := make([]tcxLap, 0, len(laps))
+	for i := range laps {
+		// A lap holds the records up to the start of the next one
+		end := len(records)
+		if i+1 < len(laps) {
+			end = recordsBefore(records, laps[i+1].StartTime)
+		}
+		tcxLaps = append(tcxLaps, newTCXLap(&laps[i], records[:end], sport))
+		records = records[end:]
+	}
+
+	doc := tcxDoc{
+		Xmlns:          tcxNamespace,
+		XmlnsAX:        axNamespace,
+		XmlnsXSI:       xsiNamespace,
+		SchemaLocation: tcxNamespace + " " + tcxSchema,
+		Activities: []tcxActivity{{
+			Sport: sport,
+			ID:    formatTime(metrics.StartTime),
+			Laps:  tcxLaps,
+		}},
+	}
+	return writeXML(w, doc)
+}
+
+// recordsBefore returns the number of leading records timestamped before t
+func recordsBefore(records []models.Record, t time.Time) int {
+	for i := range records {
+		if !records[i].Time.Before(t) {
+			return i
+		}
+	}
+	return len(records)
+}
+
+func newTCXLap(lap *models.Lap, records []models.Record, sport string) tcxLap {
+	out := tcxLap{
+		StartTime:        formatTime(lap.StartTime),
+		TotalTimeSeconds: lap.Duration.Seconds(),
+		DistanceMeters:   lap.Distance,
+		MaximumSpeed:     lap.MaxSpeed,
+		Calories:         lap.Calories,
+		AvgHeartRate:     optionalValue(lap.AvgHeartRate),
+		MaxHeartRate:     optionalValue(lap.MaxHeartRate),
+		Intensity:        "Active",
+		TriggerMethod:    "Manual",
+	}
+
+	ext := &tcxLapExt{}
+	ext.LX.AvgSpeed = lap.AvgSpeed
+	ext.LX.AvgWatts = lap.AvgPower
+	ext.LX.MaxWatts = lap.MaxPower
+	if sport == "Running" {
+		ext.LX.AvgRunCadence = lap.AvgCadence
+	} else {
+		out.Cadence = lap.AvgCadence
+	}
+	if ext.LX != (tcxLapExt{}).LX {
+		out.Extensions = ext
+	}
+
+	for i := range records {
+		out.Trackpoints = append(out.Trackpoints, newTCXTrackpoint(&records[i], sport))
+	}
+	return out
+}
+
+func newTCXTrackpoint(record *models.Record, sport string) tcxTrackpoint {
+	point := tcxTrackpoint{
+		Time:      formatTime(record.Time),
+		Distance:  record.Distance,
+		HeartRate: optionalValue(record.HeartRate),
+	}
+	if record.HasPosition {
+		point.Position = &tcxPosition{Latitude: record.Latitude, Longitude: record.Longitude}
+	}
+	if record.HasAltitude {
+		altitude := roundAltitude(record.Altitude)
+		point.Altitude = &altitude
+	}
+
+	ext := &tcxTrackpointExt{}
+	ext.TPX.Speed = record.Speed
+	ext.TPX.Watts = record.Power
+	if sport == "Running" {
+		ext.TPX.RunCadence = record.Cadence
+	} else {
+		point.Cadence = record.Cadence
+	}
+	if ext.TPX != (tcxTrackpointExt{}).TPX {
+		point.Extensions = ext
+	}
+	return point
+}
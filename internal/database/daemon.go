@@ -0,0 +1,61 @@
+// internal/database/daemon.go
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Daemon states stored in daemon_config.status
+const (
+	DaemonStopped  = "stopped"  // scheduler not running
+	DaemonDisabled = "disabled" // scheduler running with the schedule turned off
+	DaemonIdle     = "idle"     // waiting for the next scheduled run
+	DaemonRunning  = "running"  // a scheduled sync is in progress
+	DaemonFailed   = "failed"   // the last scheduled sync failed
+)
+
+// GetDaemonConfig loads the daemon configuration.
+func (s *SQLiteDB) GetDaemonConfig() (*DaemonConfig, error) {
+	var (
+		config  DaemonConfig
+		cron    sql.NullString
+		lastRun sql.NullString
+		status  sql.NullString
+		enabled sql.NullBool
+	)
+	err := s.db.QueryRow(`SELECT id, enabled, schedule_cron, last_run, status FROM daemon_config WHERE id = 1`).
+		Scan(&config.ID, &enabled, &cron, &lastRun, &status)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Enabled = !enabled.Valid || enabled.Bool
+	config.ScheduleCron = cron.String
+	config.Status = status.String
+	if lastRun.Valid && lastRun.String != "" {
+		if t, err := time.Parse(timeLayout, lastRun.String); err == nil {
+			config.LastRun = &t
+		}
+	}
+	return &config, nil
+}
+
+// UpdateDaemonSchedule stores the enabled flag and cron expression.
+func (s *SQLiteDB) UpdateDaemonSchedule(enabled bool, scheduleCron string) error {
+	_, err := s.db.Exec(`UPDATE daemon_config SET enabled = ?, schedule_cron = ? WHERE id = 1`, enabled, scheduleCron)
+	return err
+}
+
+// SetDaemonStatus stores the daemon status.
+func (s *SQLiteDB) SetDaemonStatus(status string) error {
+	_, err := s.db.Exec(`UPDATE daemon_config SET status = ? WHERE id = 1`, status)
+	return err
+}
+
+// MarkDaemonRun records that a scheduled run started at the given time.
+func (s *SQLiteDB) MarkDaemonRun(startedAt time.Time) error {
+	_, err := s.db.Exec(`UPDATE daemon_config SET status = ?, last_run = ? WHERE id = 1`,
+		DaemonRunning, startedAt.UTC().Format(timeLayout))
+	return err
+}
@@ -0,0 +1,63 @@
+// internal/database/imports.go
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Activity sources
+const (
+	SourceGarmin = "garmin" // synced from Garmin Connect
+	SourceImport = "import" // imported from a local file or export archive
+	SourceUpload = "upload" // uploaded through the API
+)
+
+// source returns the activity's source, defaulting to Garmin Connect
+func (a *Activity) source() string {
+	if a.Source == "" {
+		return SourceGarmin
+	}
+	return a.Source
+}
+
+// FileFormat returns the format of the activity's stored file: fit, gpx or
+// tcx. Rows from before the file type was recorded hold FIT files.
+func (a *Activity) FileFormat() string {
+	switch a.FileType {
+	case "fit", "gpx", "tcx":
+		return a.FileType
+	}
+	return "fit"
+}
+
+// FindActivityByFileStart returns the activity_id of a stored activity whose
+// file recorded the same start time, to the second, on the same device. An
+// empty serial on either side matches any device. found is false if there
+// is none.
+func (s *SQLiteDB) FindActivityByFileStart(start time.Time, serial string) (activityID int, found bool, err error) {
+	err = s.db.QueryRow(`
+	SELECT activity_id FROM activities
+	WHERE file_start_time = ? AND (device_serial = ? OR device_serial = '' OR ? = '')
+	ORDER BY activity_id LIMIT 1`,
+		start.UTC().Format(timeLayout), serial, serial).Scan(&activityID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return activityID, true, nil
+}
+
+// NextLocalActivityID returns an unused activity_id for an activity that did
+// not come from Garmin Connect. Local IDs count down from -1 so they never
+// collide with Garmin's positive IDs.
+func (s *SQLiteDB) NextLocalActivityID() (int, error) {
+	var lowest int
+	err := s.db.QueryRow(`SELECT COALESCE(MIN(activity_id), 0) FROM activities WHERE activity_id < 0`).Scan(&lowest)
+	if err != nil {
+		return 0, err
+	}
+	return lowest - 1, nil
+}
@@ -0,0 +1,130 @@
+// internal/database/laps.go
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Lap is one lap of an activity, as parsed from its file
+type Lap struct {
+	ActivityID    int       `json:"activity_id"`
+	Index         int       `json:"index"`
+	StartTime     time.Time `json:"start_time"`
+	Duration      float64   `json:"duration"`  // in seconds
+	Distance      float64   `json:"distance"`  // in meters
+	AvgSpeed      float64   `json:"avg_speed"` // in m/s
+	MaxSpeed      float64   `json:"max_speed"` // in m/s
+	AvgHeartRate  int       `json:"avg_heart_rate"`
+	MaxHeartRate  int       `json:"max_heart_rate"`
+	AvgCadence    int       `json:"avg_cadence"`
+	MaxCadence    int       `json:"max_cadence"`
+	AvgPower      int       `json:"avg_power"`
+	MaxPower      int       `json:"max_power"`
+	Calories      int       `json:"calories"`
+	ElevationGain float64   `json:"elevation_gain"`
+	ElevationLoss float64   `json:"elevation_loss"`
+}
+
+// ParsedMetrics are the activity columns derived from the stored file rather
+// than from the Garmin Connect summary
+type ParsedMetrics struct {
+	Duration      int
+	Distance      float64
+	MaxHeartRate  int
+	AvgHeartRate  int
+	AvgPower      float64
+	Calories      int
+	Steps         int
+	ElevationGain float64
+	FileStartTime time.Time
+	DeviceSerial  string
+}
+
+// ReplaceLaps stores the laps of an activity in place of any it had.
+func (t *Tx) ReplaceLaps(activityID int, laps []Lap) error {
+	return replaceLaps(t.tx, activityID, laps)
+}
+
+// UpdateParsedMetrics overwrites the file-derived columns of an activity and
+// replaces its laps in one transaction. It does not create a revision, since
+// the activity itself did not change.
+func (s *SQLiteDB) UpdateParsedMetrics(activityID int, metrics ParsedMetrics, laps []Lap) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fileStart *time.Time
+	if !metrics.FileStartTime.IsZero() {
+		fileStart = &metrics.FileStartTime
+	}
+	result, err := tx.Exec(`
+	UPDATE activities SET duration = ?, distance = ?, max_heart_rate = ?, avg_heart_rate = ?,
+		avg_power = ?, calories = ?, steps = ?, elevation_gain = ?, file_start_time = ?, device_serial = ?
+	WHERE activity_id = ?`,
+		metrics.Duration, metrics.Distance, metrics.MaxHeartRate, metrics.AvgHeartRate,
+		metrics.AvgPower, metrics.Calories, metrics.Steps, metrics.ElevationGain,
+		nullableTime(fileStart), metrics.DeviceSerial, activityID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := replaceLaps(tx, activityID, laps); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceLaps(tx *sql.Tx, activityID int, laps []Lap) error {
+	if _, err := tx.Exec(`DELETE FROM activity_laps WHERE activity_id = ?`, activityID); err != nil {
+		return err
+	}
+
+	for _, lap := range laps {
+		_, err := tx.Exec(`
+		INSERT INTO activity_laps (activity_id, lap_index, start_time, duration, distance, avg_speed, max_speed,
+			avg_heart_rate, max_heart_rate, avg_cadence, max_cadence, avg_power, max_power, calories,
+			elevation_gain, elevation_loss)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			activityID, lap.Index, lap.StartTime.UTC().Format(timeLayout), lap.Duration, lap.Distance,
+			lap.AvgSpeed, lap.MaxSpeed, lap.AvgHeartRate, lap.MaxHeartRate, lap.AvgCadence, lap.MaxCadence,
+			lap.AvgPower, lap.MaxPower, lap.Calories, lap.ElevationGain, lap.ElevationLoss)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetActivityLaps returns the laps of an activity in order.
+func (s *SQLiteDB) GetActivityLaps(activityID int) ([]Lap, error) {
+	rows, err := s.db.Query(`
+	SELECT activity_id, lap_index, start_time, duration, distance, avg_speed, max_speed,
+		avg_heart_rate, max_heart_rate, avg_cadence, max_cadence, avg_power, max_power, calories,
+		elevation_gain, elevation_loss
+	FROM activity_laps WHERE activity_id = ? ORDER BY lap_index`, activityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	laps := []Lap{}
+	for rows.Next() {
+		var lap Lap
+		err := rows.Scan(&lap.ActivityID, &lap.Index, &lap.StartTime, &lap.Duration, &lap.Distance,
+			&lap.AvgSpeed, &lap.MaxSpeed, &lap.AvgHeartRate, &lap.MaxHeartRate, &lap.AvgCadence, &lap.MaxCadence,
+			&lap.AvgPower, &lap.MaxPower, &lap.Calories, &lap.ElevationGain, &lap.ElevationLoss)
+		if err != nil {
+			return nil, err
+		}
+		laps = append(laps, lap)
+	}
+	return laps, rows.Err()
+}
@@ -0,0 +1,81 @@
+// internal/database/migrate.go
+package database
+
+import (
+	"fmt"
+)
+
+// columnMigrations lists columns added to tables after their first release.
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so migrate adds
+// any of these that an older database is missing.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"activities", "activity_name", "TEXT NOT NULL DEFAULT ''"},
+	{"activities", "summary_hash", "TEXT NOT NULL DEFAULT ''"},
+	{"activities", "revision", "INTEGER NOT NULL DEFAULT 1"},
+	{"activities", "remote_deleted", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"activities", "remote_deleted_at", "DATETIME"},
+	{"activities", "file_sha256", "TEXT NOT NULL DEFAULT ''"},
+	{"activities", "source_format", "TEXT NOT NULL DEFAULT ''"},
+	{"activities", "downloaded_at", "DATETIME"},
+	{"activities", "source", "TEXT NOT NULL DEFAULT 'garmin'"},
+	{"activities", "device_serial", "TEXT NOT NULL DEFAULT ''"},
+	{"activities", "file_start_time", "DATETIME"},
+	{"sync_runs", "skipped", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// migratedIndexes are indexes on columns from columnMigrations; they can only
+// be created once those columns exist.
+const migratedIndexes = `
+CREATE INDEX IF NOT EXISTS idx_activities_file_sha256 ON activities(file_sha256);
+CREATE INDEX IF NOT EXISTS idx_activities_file_start_time ON activities(file_start_time);
+`
+
+func (s *SQLiteDB) migrate() error {
+	for _, m := range columnMigrations {
+		exists, err := s.columnExists(m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", m.table, m.column, err)
+		}
+	}
+
+	_, err := s.db.Exec(migratedIndexes)
+	return err
+}
+
+func (s *SQLiteDB) columnExists(table, column string) (bool, error) {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue interface{}
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
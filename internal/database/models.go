@@ -8,6 +8,7 @@ import (
 type Activity struct {
 	ID           int       `json:"id"`
 	ActivityID   int       `json:"activity_id"`
+	ActivityName string    `json:"activity_name"`
 	StartTime    time.Time `json:"start_time"`
 	ActivityType string    `json:"activity_type"`
 	Duration     int       `json:"duration"`      // in seconds
@@ -23,23 +24,53 @@ type Activity struct {
 	Filename     string    `json:"filename"`
 	FileType     string    `json:"file_type"`
 	FileSize     int64     `json:"file_size"`
+	FileSHA256   string    `json:"file_sha256"`
+	SourceFormat string    `json:"source_format"` // format of the downloaded payload, e.g. fit or zip
 	Downloaded   bool      `json:"downloaded"`
+	DownloadedAt *time.Time `json:"downloaded_at,omitempty"`
+	Source       string     `json:"source"`                      // where the activity came from: garmin, import or upload
+	DeviceSerial string     `json:"device_serial,omitempty"`     // serial number of the recording device, from the file
+	FileStartTime *time.Time `json:"file_start_time,omitempty"` // UTC start time recorded in the file
+	SummaryHash  string    `json:"summary_hash"` // hash of the Garmin summary fields, for change detection
+	Revision     int       `json:"revision"`
+	RemoteDeleted   bool       `json:"remote_deleted"` // deleted on Garmin Connect
+	RemoteDeletedAt *time.Time `json:"remote_deleted_at,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	LastSync     time.Time `json:"last_sync"`
 }
 
+// ActivityRevision is a snapshot of an activity row taken before a re-sync
+// replaced it.
+type ActivityRevision struct {
+	ID          int       `json:"id"`
+	ActivityID  int       `json:"activity_id"`
+	Revision    int       `json:"revision"`
+	SummaryHash string    `json:"summary_hash"`
+	Snapshot    Activity  `json:"snapshot"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DuplicateGroup is a set of activities whose stored files have identical
+// content.
+type DuplicateGroup struct {
+	FileSHA256  string `json:"file_sha256"`
+	FileSize    int64  `json:"file_size"`
+	ActivityIDs []int  `json:"activity_ids"`
+}
+
 type Stats struct {
     Total      int `json:"total"`
     Downloaded int `json:"downloaded"`
     Missing    int `json:"missing"`
+    RemoteDeleted int `json:"remote_deleted"`
 }
 
 type DaemonConfig struct {
-    ID           int    `json:"id"`
-    Enabled      bool   `json:"enabled"`
-    ScheduleCron string `json:"schedule_cron"`
-    LastRun      string `json:"last_run"`
-    Status       string `json:"status"`
+    ID           int        `json:"id"`
+    Enabled      bool       `json:"enabled"`
+    ScheduleCron string     `json:"schedule_cron"`
+    LastRun      *time.Time `json:"last_run,omitempty"`
+    Status       string     `json:"status"`
 }
 
 // Database interface
@@ -65,6 +96,7 @@ type ActivityFilters struct {
     ActivityType string
     DateFrom     *time.Time
     DateTo       *time.Time
+    Year         int // UTC year started in, by file_start_time when recorded; 0 for any
     MinDistance  float64
     MaxDistance  float64
     MinDuration  int
@@ -72,6 +104,14 @@ type ActivityFilters struct {
     Downloaded   *bool
     Limit        int
     Offset       int
+    Cursor       string // opaque keyset cursor, used by ListActivities
     SortBy       string
     SortOrder    string
 }
+
+// ActivityPage is one page of a keyset-paginated activity listing
+type ActivityPage struct {
+    Activities []Activity `json:"activities"`
+    NextCursor string     `json:"next_cursor,omitempty"`
+    Total      int        `json:"total"`
+}
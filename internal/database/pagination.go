@@ -0,0 +1,167 @@
+// internal/database/pagination.go
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination token cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ActivityCursor marks a position in the (start_time, activity_id) ordering
+// used for keyset pagination. Rows are listed newest first, so the next page
+// holds everything strictly "before" the cursor.
+type ActivityCursor struct {
+	StartTime  time.Time
+	ActivityID int
+}
+
+// EncodeCursor turns a cursor into an opaque, URL-safe token.
+func EncodeCursor(c ActivityCursor) string {
+	raw := c.StartTime.Format(timeLayout) + "|" + strconv.Itoa(c.ActivityID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a token produced by EncodeCursor.
+func DecodeCursor(token string) (*ActivityCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidCursor)
+	}
+
+	startTime, err := time.Parse(timeLayout, parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	activityID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	return &ActivityCursor{StartTime: startTime, ActivityID: activityID}, nil
+}
+
+// ListActivities returns one page of activities matching the filters, ordered
+// by start_time and activity_id descending. Unlike FilterActivities it pages
+// with filters.Cursor instead of OFFSET, so rows inserted by a running sync
+// never shift the page boundaries. SortBy, SortOrder and Offset are ignored.
+func (s *SQLiteDB) ListActivities(filters ActivityFilters) (*ActivityPage, error) {
+	conditions, args := filterConditions(filters)
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	page := &ActivityPage{Activities: []Activity{}}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM activities"+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	conditions, args, err := cursorCondition(filters.Cursor, conditions, args)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + activityColumns + ` FROM activities`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY start_time DESC, activity_id DESC"
+
+	// Fetch one extra row to learn whether another page follows
+	limit := filters.Limit
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit+1)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities, err := scanActivities(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(activities) > limit {
+		activities = activities[:limit]
+		last := activities[limit-1]
+		page.NextCursor = EncodeCursor(ActivityCursor{StartTime: last.StartTime, ActivityID: last.ActivityID})
+	}
+	if activities != nil {
+		page.Activities = activities
+	}
+
+	return page, nil
+}
+
+// CursorAfter returns the cursor that follows the first n activities
+// matching the filters, counted from filters.Cursor, or "" if no activity
+// follows them. It lets a caller split a long listing into chunks up front
+// without loading the rows.
+func (s *SQLiteDB) CursorAfter(filters ActivityFilters, n int) (string, error) {
+	conditions, args := filterConditions(filters)
+	conditions, args, err := cursorCondition(filters.Cursor, conditions, args)
+	if err != nil {
+		return "", err
+	}
+
+	query := `SELECT start_time, activity_id FROM activities`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY start_time DESC, activity_id DESC LIMIT 2 OFFSET ?"
+
+	rows, err := s.db.Query(query, append(args, n-1)...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var cursors []ActivityCursor
+	for rows.Next() {
+		var c ActivityCursor
+		if err := rows.Scan(&c.StartTime, &c.ActivityID); err != nil {
+			return "", err
+		}
+		cursors = append(cursors, c)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	// The nth row only becomes a cursor if another row follows it
+	if len(cursors) < 2 {
+		return "", nil
+	}
+	return EncodeCursor(cursors[0]), nil
+}
+
+// cursorCondition adds the keyset condition for rows after a cursor token
+func cursorCondition(token string, conditions []string, args []interface{}) ([]string, []interface{}, error) {
+	if token == "" {
+		return conditions, args, nil
+	}
+	cursor, err := DecodeCursor(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	startTime := cursor.StartTime.Format(timeLayout)
+	conditions = append(conditions, "(start_time < ? OR (start_time = ? AND activity_id < ?))")
+	args = append(args, startTime, startTime, cursor.ActivityID)
+	return conditions, args, nil
+}
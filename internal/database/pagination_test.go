@@ -0,0 +1,158 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := ActivityCursor{StartTime: time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC), ActivityID: 12345}
+	got, err := DecodeCursor(EncodeCursor(want))
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+	if !got.StartTime.Equal(want.StartTime) || got.ActivityID != want.ActivityID {
+		t.Errorf("DecodeCursor = %+v, want %+v", *got, want)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not base64", "%%%"},
+		{"no separator", "MjAyNC0wNS0wMQ"},
+		{"bad time", "bm90LWEtdGltZXwx"},
+		{"bad id", "MjAyNC0wNS0wMSAwNzozMDowMHx4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeCursor(tt.token); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeCursor(%q) error = %v, want ErrInvalidCursor", tt.token, err)
+			}
+		})
+	}
+}
+
+func TestListActivitiesKeyset(t *testing.T) {
+	db := newTestDB(t)
+	base := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	// Activities 3 and 4 share a start time, so the page boundary between
+	// them is decided by activity_id
+	insertActivities(t, db,
+		testActivity(1, base),
+		testActivity(2, base.Add(time.Hour)),
+		testActivity(3, base.Add(2*time.Hour)),
+		testActivity(4, base.Add(2*time.Hour)),
+		testActivity(5, base.Add(3*time.Hour)),
+	)
+
+	tests := []struct {
+		limit int
+		pages [][]int
+	}{
+		{limit: 2, pages: [][]int{{5, 4}, {3, 2}, {1}}},
+		{limit: 3, pages: [][]int{{5, 4, 3}, {2, 1}}},
+		{limit: 5, pages: [][]int{{5, 4, 3, 2, 1}}},
+		{limit: 0, pages: [][]int{{5, 4, 3, 2, 1}}},
+	}
+	for _, tt := range tests {
+		filters := ActivityFilters{Limit: tt.limit}
+		var pages [][]int
+		for {
+			page, err := db.ListActivities(filters)
+			if err != nil {
+				t.Fatalf("limit %d: ListActivities: %v", tt.limit, err)
+			}
+			if page.Total != 5 {
+				t.Errorf("limit %d: Total = %d, want 5", tt.limit, page.Total)
+			}
+			var ids []int
+			for _, a := range page.Activities {
+				ids = append(ids, a.ActivityID)
+			}
+			pages = append(pages, ids)
+			if page.NextCursor == "" {
+				break
+			}
+			filters.Cursor = page.NextCursor
+		}
+		if !reflect.DeepEqual(pages, tt.pages) {
+			t.Errorf("limit %d: pages = %v, want %v", tt.limit, pages, tt.pages)
+		}
+	}
+}
+
+func TestListActivitiesStableUnderInserts(t *testing.T) {
+	db := newTestDB(t)
+	base := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	insertActivities(t, db,
+		testActivity(1, base),
+		testActivity(2, base.Add(time.Hour)),
+		testActivity(3, base.Add(2*time.Hour)),
+	)
+
+	first, err := db.ListActivities(ActivityFilters{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListActivities: %v", err)
+	}
+
+	// A sync inserting a newer activity must not shift the next page
+	insertActivities(t, db, testActivity(4, base.Add(3*time.Hour)))
+
+	second, err := db.ListActivities(ActivityFilters{Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("ListActivities: %v", err)
+	}
+	if len(second.Activities) != 1 || second.Activities[0].ActivityID != 1 {
+		t.Errorf("second page = %v, want only activity 1", second.Activities)
+	}
+}
+
+func TestCursorAfter(t *testing.T) {
+	db := newTestDB(t)
+	base := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	for id := 1; id <= 5; id++ {
+		insertActivities(t, db, testActivity(id, base.Add(time.Duration(id)*time.Hour)))
+	}
+
+	tests := []struct {
+		n      int
+		wantID int // activity the cursor points at, 0 for no cursor
+	}{
+		{n: 1, wantID: 5},
+		{n: 2, wantID: 4},
+		{n: 4, wantID: 2},
+		{n: 5, wantID: 0},
+		{n: 10, wantID: 0},
+	}
+	for _, tt := range tests {
+		token, err := db.CursorAfter(ActivityFilters{}, tt.n)
+		if err != nil {
+			t.Fatalf("CursorAfter(%d): %v", tt.n, err)
+		}
+		if tt.wantID == 0 {
+			if token != "" {
+				t.Errorf("CursorAfter(%d) = %q, want no cursor", tt.n, token)
+			}
+			continue
+		}
+		cursor, err := DecodeCursor(token)
+		if err != nil {
+			t.Fatalf("CursorAfter(%d) returned undecodable %q: %v", tt.n, token, err)
+		}
+		if cursor.ActivityID != tt.wantID {
+			t.Errorf("CursorAfter(%d) points at %d, want %d", tt.n, cursor.ActivityID, tt.wantID)
+		}
+	}
+}
+
+func TestListActivitiesInvalidCursor(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.ListActivities(ActivityFilters{Limit: 2, Cursor: "%%%"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("ListActivities error = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -0,0 +1,178 @@
+// internal/database/reconcile.go
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetActivityIDs returns the activity_id of every activity synced from
+// Garmin Connect. Imported activities are not included.
+func (s *SQLiteDB) GetActivityIDs() ([]int, error) {
+	rows, err := s.db.Query(`SELECT activity_id FROM activities WHERE source = ?`, SourceGarmin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetDownloadedFiles maps the activity_id of every downloaded activity to
+// its filename.
+func (s *SQLiteDB) GetDownloadedFiles() (map[int]string, error) {
+	rows, err := s.db.Query(`SELECT activity_id, filename FROM activities WHERE downloaded = TRUE`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var filename sql.NullString
+		if err := rows.Scan(&id, &filename); err != nil {
+			return nil, err
+		}
+		files[id] = filename.String
+	}
+	return files, rows.Err()
+}
+
+// SetRemoteDeleted flags or unflags an activity as deleted on Garmin
+// Connect. The deletion timestamp is only set the first time it is flagged.
+func (s *SQLiteDB) SetRemoteDeleted(activityID int, deleted bool) error {
+	if !deleted {
+		_, err := s.db.Exec(`
+		UPDATE activities SET remote_deleted = FALSE, remote_deleted_at = NULL
+		WHERE activity_id = ?`, activityID)
+		return err
+	}
+
+	_, err := s.db.Exec(`
+	UPDATE activities SET remote_deleted = TRUE, remote_deleted_at = ?
+	WHERE activity_id = ? AND remote_deleted = FALSE`,
+		time.Now().UTC().Format(timeLayout), activityID)
+	return err
+}
+
+// SetActivityFile points an activity at a new file location.
+func (s *SQLiteDB) SetActivityFile(activityID int, filename string, downloaded bool) error {
+	_, err := s.db.Exec(`UPDATE activities SET filename = ?, downloaded = ? WHERE activity_id = ?`,
+		filename, downloaded, activityID)
+	return err
+}
+
+// SetFileIntegrity records the size and SHA-256 of an activity's file and
+// marks it downloaded.
+func (s *SQLiteDB) SetFileIntegrity(activityID int, size int64, sha256 string) error {
+	_, err := s.db.Exec(`
+	UPDATE activities SET file_size = ?, file_sha256 = ?, downloaded = TRUE
+	WHERE activity_id = ?`, size, sha256, activityID)
+	return err
+}
+
+// RecordDownload stores the integrity metadata of a freshly downloaded file
+// and marks the activity downloaded.
+func (s *SQLiteDB) RecordDownload(activityID int, size int64, sha256, sourceFormat string) error {
+	_, err := s.db.Exec(`
+	UPDATE activities SET file_size = ?, file_sha256 = ?, source_format = ?,
+		downloaded = TRUE, downloaded_at = ?
+	WHERE activity_id = ?`,
+		size, sha256, sourceFormat, time.Now().UTC().Format(timeLayout), activityID)
+	return err
+}
+
+// FindActivitiesBySHA256 returns the IDs of activities whose stored file has
+// the given checksum.
+func (s *SQLiteDB) FindActivitiesBySHA256(sha256 string) ([]int, error) {
+	rows, err := s.db.Query(`SELECT activity_id FROM activities WHERE file_sha256 = ? ORDER BY activity_id`, sha256)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// FindDuplicateFiles groups activities whose stored files share a checksum.
+func (s *SQLiteDB) FindDuplicateFiles() ([]DuplicateGroup, error) {
+	rows, err := s.db.Query(`
+	SELECT file_sha256, file_size, activity_id FROM activities
+	WHERE file_sha256 IN (
+		SELECT file_sha256 FROM activities
+		WHERE file_sha256 != ''
+		GROUP BY file_sha256 HAVING COUNT(*) > 1
+	)
+	ORDER BY file_sha256, activity_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []DuplicateGroup{}
+	for rows.Next() {
+		var sum string
+		var size int64
+		var id int
+		if err := rows.Scan(&sum, &size, &id); err != nil {
+			return nil, err
+		}
+		if len(groups) == 0 || groups[len(groups)-1].FileSHA256 != sum {
+			groups = append(groups, DuplicateGroup{FileSHA256: sum, FileSize: size})
+		}
+		last := &groups[len(groups)-1]
+		last.ActivityIDs = append(last.ActivityIDs, id)
+	}
+	return groups, rows.Err()
+}
+
+// activityTables lists the tables keyed by activity_id that DeleteActivity
+// clears along with the activity row. Laps go through their foreign key.
+var activityTables = []string{"activity_revisions", "sync_errors", "sync_retries", "skipped_activities", "activities"}
+
+// DeleteActivity removes an activity together with its revision history,
+// error ledger entries and retry and skip records, in one transaction.
+func (s *SQLiteDB) DeleteActivity(activityID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteActivity(tx, activityID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteActivity is the transactional form of SQLiteDB.DeleteActivity.
+func (t *Tx) DeleteActivity(activityID int) error {
+	return deleteActivity(t.tx, activityID)
+}
+
+func deleteActivity(tx *sql.Tx, activityID int) error {
+	for _, table := range activityTables {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE activity_id = ?`, activityID); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+	return nil
+}
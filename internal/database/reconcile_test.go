@@ -0,0 +1,51 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeleteActivityRemovesDependentRows(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	run, err := db.CreateSyncRun("test")
+	if err != nil {
+		t.Fatalf("CreateSyncRun: %v", err)
+	}
+	// Activity 1 is purged; activity 2 has the same history and must keep it
+	for _, id := range []int{1, 2} {
+		a := testActivity(id, start.Add(time.Duration(id)*time.Hour))
+		insertActivities(t, db, a)
+		if _, err := db.UpsertActivity(a); err != nil {
+			t.Fatalf("UpsertActivity(%d): %v", id, err)
+		}
+		if _, err := db.RecordSyncError(run.ID, id, "download", "boom"); err != nil {
+			t.Fatalf("RecordSyncError(%d): %v", id, err)
+		}
+		if err := db.SaveRetry(&RetryEntry{ActivityID: id, Status: RetryDead, Attempts: 5, NextAttemptAt: start}); err != nil {
+			t.Fatalf("SaveRetry(%d): %v", id, err)
+		}
+		if err := db.RecordSkipped(&SkippedActivity{ActivityID: id, Reason: "excluded type"}); err != nil {
+			t.Fatalf("RecordSkipped(%d): %v", id, err)
+		}
+		if err := db.UpdateParsedMetrics(id, ParsedMetrics{}, []Lap{{Index: 0, StartTime: start}}); err != nil {
+			t.Fatalf("UpdateParsedMetrics(%d): %v", id, err)
+		}
+	}
+
+	if err := db.DeleteActivity(1); err != nil {
+		t.Fatalf("DeleteActivity: %v", err)
+	}
+
+	tables := append([]string{"activity_laps"}, activityTables...)
+	for _, table := range tables {
+		query := `SELECT COUNT(*) FROM ` + table + ` WHERE activity_id = ?`
+		if n := countRows(t, db.DB(), query, 1); n != 0 {
+			t.Errorf("%s: %d rows left for the deleted activity", table, n)
+		}
+		if n := countRows(t, db.DB(), query, 2); n == 0 {
+			t.Errorf("%s: rows of the other activity were deleted", table)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// internal/database/retries.go
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Retry queue states
+const (
+	RetryPending = "pending" // waiting for its next attempt
+	RetryDead    = "dead"    // gave up after too many attempts
+	RetryIgnored = "ignored" // dismissed by the user, never retried
+)
+
+// ErrRetryNotFound is returned when an activity is not in the retry queue.
+var ErrRetryNotFound = errors.New("retry entry not found")
+
+// RetryEntry tracks an activity that failed to sync
+type RetryEntry struct {
+	ActivityID    int       `json:"activity_id"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastStage     string    `json:"last_stage"`
+	LastError     string    `json:"last_error"`
+	Summary       string    `json:"-"` // Garmin summary JSON, used to retry without listing again
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+const retryColumns = `activity_id, status, attempts, next_attempt_at, last_stage, last_error, summary, updated_at`
+
+// GetRetry returns the queue entry of an activity, or nil if it has none.
+func (s *SQLiteDB) GetRetry(activityID int) (*RetryEntry, error) {
+	entry, err := scanRetry(s.db.QueryRow(`SELECT `+retryColumns+` FROM sync_retries WHERE activity_id = ?`, activityID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// SaveRetry inserts or replaces a queue entry.
+func (s *SQLiteDB) SaveRetry(entry *RetryEntry) error {
+	entry.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	_, err := s.db.Exec(`
+	INSERT INTO sync_retries (activity_id, status, attempts, next_attempt_at, last_stage, last_error, summary, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(activity_id) DO UPDATE SET
+		status = excluded.status, attempts = excluded.attempts,
+		next_attempt_at = excluded.next_attempt_at, last_stage = excluded.last_stage,
+		last_error = excluded.last_error, summary = excluded.summary,
+		updated_at = excluded.updated_at`,
+		entry.ActivityID, entry.Status, entry.Attempts, entry.NextAttemptAt.UTC().Format(timeLayout),
+		entry.LastStage, entry.LastError, entry.Summary, entry.UpdatedAt.Format(timeLayout))
+	return err
+}
+
+// DeleteRetry removes an activity from the queue, typically after it synced.
+func (s *SQLiteDB) DeleteRetry(activityID int) error {
+	_, err := s.db.Exec(`DELETE FROM sync_retries WHERE activity_id = ?`, activityID)
+	return err
+}
+
+// SetRetryStatus moves a queued activity to a new state. Resetting it to
+// pending also clears its attempt count and makes it due immediately.
+func (s *SQLiteDB) SetRetryStatus(activityID int, status string) error {
+	query := `UPDATE sync_retries SET status = ?, updated_at = ? WHERE activity_id = ?`
+	args := []interface{}{status, time.Now().UTC().Format(timeLayout), activityID}
+	if status == RetryPending {
+		query = `UPDATE sync_retries SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ? WHERE activity_id = ?`
+		now := time.Now().UTC().Format(timeLayout)
+		args = []interface{}{status, now, now, activityID}
+	}
+
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrRetryNotFound
+	}
+	return nil
+}
+
+// ListRetries returns queue entries, optionally restricted to one status.
+func (s *SQLiteDB) ListRetries(status string) ([]RetryEntry, error) {
+	query := `SELECT ` + retryColumns + ` FROM sync_retries`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY next_attempt_at`
+	return s.queryRetries(query, args...)
+}
+
+// ListDueRetries returns pending entries whose next attempt is due.
+func (s *SQLiteDB) ListDueRetries(now time.Time) ([]RetryEntry, error) {
+	return s.queryRetries(`SELECT `+retryColumns+` FROM sync_retries
+	WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at`,
+		RetryPending, now.UTC().Format(timeLayout))
+}
+
+func (s *SQLiteDB) queryRetries(query string, args ...interface{}) ([]RetryEntry, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []RetryEntry{}
+	for rows.Next() {
+		entry, err := scanRetry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+func scanRetry(row rowScanner) (*RetryEntry, error) {
+	var e RetryEntry
+	var stage, lastErr, summary sql.NullString
+	err := row.Scan(&e.ActivityID, &e.Status, &e.Attempts, &e.NextAttemptAt, &stage, &lastErr, &summary, &e.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.LastStage, e.LastError, e.Summary = stage.String, lastErr.String, summary.String
+	return &e, nil
+}
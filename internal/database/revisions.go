@@ -0,0 +1,128 @@
+// internal/database/revisions.go
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// UpsertActivity inserts the activity or, if a row with the same activity_id
+// already exists, snapshots the old row into activity_revisions and replaces
+// it. It reports whether a new row was created.
+func (s *SQLiteDB) UpsertActivity(activity *Activity) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	created, err := upsertActivity(tx, activity)
+	if err != nil {
+		return false, err
+	}
+	return created, tx.Commit()
+}
+
+// Tx groups several activity writes into one transaction.
+type Tx struct {
+	tx *sql.Tx
+}
+
+// Begin starts a transaction for batched writes.
+func (s *SQLiteDB) Begin() (*Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx: tx}, nil
+}
+
+// UpsertActivity is the transactional form of SQLiteDB.UpsertActivity.
+func (t *Tx) UpsertActivity(activity *Activity) (bool, error) {
+	return upsertActivity(t.tx, activity)
+}
+
+func (t *Tx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *Tx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+func upsertActivity(tx *sql.Tx, activity *Activity) (bool, error) {
+	existing, err := scanActivity(tx.QueryRow(
+		`SELECT `+activityColumns+` FROM activities WHERE activity_id = ?`, activity.ActivityID))
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+
+	if existing != nil {
+		snapshot, err := json.Marshal(existing)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(`
+		INSERT INTO activity_revisions (activity_id, revision, summary_hash, snapshot)
+		VALUES (?, ?, ?, ?)`,
+			existing.ActivityID, existing.Revision, existing.SummaryHash, string(snapshot))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	assignments := make([]string, 0, len(activityWriteColumns))
+	for _, column := range activityWriteColumns[1:] {
+		assignments = append(assignments, column+" = excluded."+column)
+	}
+	query := `INSERT INTO activities (` + strings.Join(activityWriteColumns, ", ") + `)
+	VALUES (` + placeholders(len(activityWriteColumns)) + `)
+	ON CONFLICT(activity_id) DO UPDATE SET ` + strings.Join(assignments, ", ") + `,
+		revision = activities.revision + 1,
+		remote_deleted = FALSE,
+		remote_deleted_at = NULL,
+		last_sync = CURRENT_TIMESTAMP`
+
+	if _, err := tx.Exec(query, activityValues(activity)...); err != nil {
+		return false, err
+	}
+	return existing == nil, nil
+}
+
+// SetSummaryHash records the summary hash of an activity without touching
+// its other fields.
+func (s *SQLiteDB) SetSummaryHash(activityID int, hash string) error {
+	_, err := s.db.Exec(`UPDATE activities SET summary_hash = ? WHERE activity_id = ?`, hash, activityID)
+	return err
+}
+
+// GetActivityRevisions returns the stored revisions of an activity, newest
+// first.
+func (s *SQLiteDB) GetActivityRevisions(activityID int) ([]ActivityRevision, error) {
+	rows, err := s.db.Query(`
+	SELECT id, activity_id, revision, summary_hash, snapshot, created_at
+	FROM activity_revisions
+	WHERE activity_id = ?
+	ORDER BY revision DESC`, activityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []ActivityRevision{}
+	for rows.Next() {
+		var r ActivityRevision
+		var hash sql.NullString
+		var snapshot string
+		if err := rows.Scan(&r.ID, &r.ActivityID, &r.Revision, &hash, &snapshot, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.SummaryHash = hash.String
+		if err := json.Unmarshal([]byte(snapshot), &r.Snapshot); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
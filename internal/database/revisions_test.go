@@ -0,0 +1,122 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpsertActivityRevisions(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	a := testActivity(42, start)
+	a.SummaryHash = "v1"
+	created, err := db.UpsertActivity(a)
+	if err != nil {
+		t.Fatalf("UpsertActivity: %v", err)
+	}
+	if !created {
+		t.Error("first UpsertActivity reported an update, want created")
+	}
+
+	versions := []struct {
+		name string
+		hash string
+	}{
+		{"Morning Run", "v2"},
+		{"Morning Run (edited)", "v3"},
+	}
+	for _, v := range versions {
+		a.ActivityName, a.SummaryHash = v.name, v.hash
+		created, err := db.UpsertActivity(a)
+		if err != nil {
+			t.Fatalf("UpsertActivity(%s): %v", v.hash, err)
+		}
+		if created {
+			t.Errorf("UpsertActivity(%s) reported a new row, want update", v.hash)
+		}
+	}
+
+	got, err := db.GetActivity(42)
+	if err != nil {
+		t.Fatalf("GetActivity: %v", err)
+	}
+	if got.Revision != 3 || got.ActivityName != "Morning Run (edited)" || got.SummaryHash != "v3" {
+		t.Errorf("row = revision %d, %q, %q; want revision 3, edited name, v3",
+			got.Revision, got.ActivityName, got.SummaryHash)
+	}
+
+	revisions, err := db.GetActivityRevisions(42)
+	if err != nil {
+		t.Fatalf("GetActivityRevisions: %v", err)
+	}
+	want := []struct {
+		revision int
+		hash     string
+		name     string
+	}{
+		{2, "v2", "Morning Run"},
+		{1, "v1", "Activity"},
+	}
+	if len(revisions) != len(want) {
+		t.Fatalf("got %d revisions, want %d", len(revisions), len(want))
+	}
+	for i, w := range want {
+		r := revisions[i]
+		if r.Revision != w.revision || r.SummaryHash != w.hash || r.Snapshot.ActivityName != w.name {
+			t.Errorf("revision %d = %d/%q/%q, want %d/%q/%q", i,
+				r.Revision, r.SummaryHash, r.Snapshot.ActivityName, w.revision, w.hash, w.name)
+		}
+	}
+}
+
+func TestUpsertActivityClearsRemoteDeleted(t *testing.T) {
+	db := newTestDB(t)
+	a := testActivity(7, time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC))
+	insertActivities(t, db, a)
+	if err := db.SetRemoteDeleted(7, true); err != nil {
+		t.Fatalf("SetRemoteDeleted: %v", err)
+	}
+
+	if _, err := db.UpsertActivity(a); err != nil {
+		t.Fatalf("UpsertActivity: %v", err)
+	}
+	got, err := db.GetActivity(7)
+	if err != nil {
+		t.Fatalf("GetActivity: %v", err)
+	}
+	if got.RemoteDeleted || got.RemoteDeletedAt != nil {
+		t.Errorf("re-synced activity still marked remote deleted")
+	}
+}
+
+func TestTxRollbackDiscardsUpserts(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)
+	insertActivities(t, db, testActivity(1, start))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	updated := testActivity(1, start)
+	updated.ActivityName = "Renamed"
+	for _, a := range []*Activity{updated, testActivity(2, start.Add(time.Hour))} {
+		if _, err := tx.UpsertActivity(a); err != nil {
+			t.Fatalf("Tx.UpsertActivity(%d): %v", a.ActivityID, err)
+		}
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	if got, _ := db.GetActivity(1); got == nil || got.ActivityName != "Activity" || got.Revision != 1 {
+		t.Errorf("activity 1 changed by a rolled back transaction: %+v", got)
+	}
+	if exists, _ := db.ActivityExists(2); exists {
+		t.Error("activity 2 exists after rollback")
+	}
+	if n := countRows(t, db.DB(), `SELECT COUNT(*) FROM activity_revisions`); n != 0 {
+		t.Errorf("%d revisions left after rollback, want 0", n)
+	}
+}
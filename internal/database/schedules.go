@@ -0,0 +1,214 @@
+// internal/database/schedules.go
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrScheduleNotFound is returned when no schedule matches an ID.
+	ErrScheduleNotFound = errors.New("schedule not found")
+	// ErrScheduleExists is returned when a schedule name is already taken.
+	ErrScheduleExists = errors.New("a schedule with this name already exists")
+)
+
+// Schedule is a named job run on its own cron expression
+type Schedule struct {
+	ID           int64           `json:"id"`
+	Name         string          `json:"name"`
+	Kind         string          `json:"kind"` // incremental, full, reconcile, verify, wellness, backup or parquet
+	ScheduleCron string          `json:"schedule_cron"`
+	Params       json.RawMessage `json:"params"`
+	Enabled      bool            `json:"enabled"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// ScheduleRun records one execution of a schedule
+type ScheduleRun struct {
+	ID         int64           `json:"id"`
+	ScheduleID int64           `json:"schedule_id"`
+	Trigger    string          `json:"trigger"` // cron or api
+	Status     string          `json:"status"`  // running, succeeded, failed or skipped
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+const scheduleColumns = `id, name, kind, schedule_cron, params, enabled, created_at, updated_at`
+
+const scheduleRunColumns = `id, schedule_id, trigger, status, started_at, finished_at, result, error`
+
+// ListSchedules returns all schedules ordered by name.
+func (s *SQLiteDB) ListSchedules() ([]Schedule, error) {
+	rows, err := s.db.Query(`SELECT ` + scheduleColumns + ` FROM schedules ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []Schedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// GetSchedule returns a schedule by ID.
+func (s *SQLiteDB) GetSchedule(id int64) (*Schedule, error) {
+	schedule, err := scanSchedule(s.db.QueryRow(`SELECT `+scheduleColumns+` FROM schedules WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrScheduleNotFound
+	}
+	return schedule, err
+}
+
+// CreateSchedule stores a new schedule and sets its ID and timestamps.
+func (s *SQLiteDB) CreateSchedule(schedule *Schedule) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	schedule.CreatedAt, schedule.UpdatedAt = now, now
+
+	result, err := s.db.Exec(`
+	INSERT INTO schedules (name, kind, schedule_cron, params, enabled, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		schedule.Name, schedule.Kind, schedule.ScheduleCron, scheduleParams(schedule), schedule.Enabled,
+		now.Format(timeLayout), now.Format(timeLayout))
+	if err != nil {
+		return scheduleWriteError(err)
+	}
+	schedule.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateSchedule stores the editable fields of a schedule.
+func (s *SQLiteDB) UpdateSchedule(schedule *Schedule) error {
+	schedule.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+
+	result, err := s.db.Exec(`
+	UPDATE schedules SET name = ?, kind = ?, schedule_cron = ?, params = ?, enabled = ?, updated_at = ?
+	WHERE id = ?`,
+		schedule.Name, schedule.Kind, schedule.ScheduleCron, scheduleParams(schedule), schedule.Enabled,
+		schedule.UpdatedAt.Format(timeLayout), schedule.ID)
+	if err != nil {
+		return scheduleWriteError(err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// DeleteSchedule removes a schedule together with its run history.
+func (s *SQLiteDB) DeleteSchedule(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM schedules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// CreateScheduleRun records the start of a schedule run.
+func (s *SQLiteDB) CreateScheduleRun(scheduleID int64, trigger string) (*ScheduleRun, error) {
+	run := &ScheduleRun{
+		ScheduleID: scheduleID,
+		Trigger:    trigger,
+		Status:     "running",
+		StartedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+
+	result, err := s.db.Exec(`INSERT INTO schedule_runs (schedule_id, trigger, status, started_at) VALUES (?, ?, ?, ?)`,
+		run.ScheduleID, run.Trigger, run.Status, run.StartedAt.Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	if run.ID, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// FinishScheduleRun stores the final status, result and error of a run.
+func (s *SQLiteDB) FinishScheduleRun(run *ScheduleRun) error {
+	finished := time.Now().UTC().Truncate(time.Second)
+	run.FinishedAt = &finished
+
+	var result interface{}
+	if len(run.Result) > 0 {
+		result = string(run.Result)
+	}
+	_, err := s.db.Exec(`UPDATE schedule_runs SET status = ?, finished_at = ?, result = ?, error = ? WHERE id = ?`,
+		run.Status, finished.Format(timeLayout), result, run.Error, run.ID)
+	return err
+}
+
+// ListScheduleRuns returns the most recent runs of a schedule, newest first.
+func (s *SQLiteDB) ListScheduleRuns(scheduleID int64, limit int) ([]ScheduleRun, error) {
+	rows, err := s.db.Query(`
+	SELECT `+scheduleRunColumns+` FROM schedule_runs
+	WHERE schedule_id = ? ORDER BY id DESC LIMIT ?`, scheduleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []ScheduleRun{}
+	for rows.Next() {
+		var run ScheduleRun
+		var finishedAt sql.NullTime
+		var result, runErr sql.NullString
+		err := rows.Scan(&run.ID, &run.ScheduleID, &run.Trigger, &run.Status, &run.StartedAt,
+			&finishedAt, &result, &runErr)
+		if err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		if result.Valid {
+			run.Result = json.RawMessage(result.String)
+		}
+		run.Error = runErr.String
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func scanSchedule(row rowScanner) (*Schedule, error) {
+	var schedule Schedule
+	var params string
+	err := row.Scan(&schedule.ID, &schedule.Name, &schedule.Kind, &schedule.ScheduleCron, &params,
+		&schedule.Enabled, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	schedule.Params = json.RawMessage(params)
+	return &schedule, nil
+}
+
+// scheduleParams defaults missing parameters to an empty object
+func scheduleParams(schedule *Schedule) string {
+	if len(schedule.Params) == 0 || string(schedule.Params) == "null" {
+		schedule.Params = json.RawMessage("{}")
+	}
+	return string(schedule.Params)
+}
+
+// scheduleWriteError maps unique name violations to ErrScheduleExists
+func scheduleWriteError(err error) error {
+	if strings.Contains(err.Error(), "UNIQUE constraint failed: schedules.name") {
+		return ErrScheduleExists
+	}
+	return err
+}
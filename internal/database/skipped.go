@@ -0,0 +1,94 @@
+// internal/database/skipped.go
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SkippedActivity records a Garmin activity that sync rules filtered out
+type SkippedActivity struct {
+	ActivityID   int       `json:"activity_id"`
+	RunID        int64     `json:"run_id,omitempty"`
+	ActivityName string    `json:"activity_name"`
+	ActivityType string    `json:"activity_type"`
+	StartTime    string    `json:"start_time"`
+	Reason       string    `json:"reason"`
+	SkippedAt    time.Time `json:"skipped_at"`
+}
+
+// RecordSkipped stores or refreshes why an activity was skipped.
+func (s *SQLiteDB) RecordSkipped(skipped *SkippedActivity) error {
+	skipped.SkippedAt = time.Now().UTC().Truncate(time.Second)
+	_, err := s.db.Exec(`
+	INSERT INTO skipped_activities (activity_id, run_id, activity_name, activity_type, start_time, reason, skipped_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(activity_id) DO UPDATE SET
+		run_id = excluded.run_id, activity_name = excluded.activity_name,
+		activity_type = excluded.activity_type, start_time = excluded.start_time,
+		reason = excluded.reason, skipped_at = excluded.skipped_at`,
+		skipped.ActivityID, skipped.RunID, skipped.ActivityName, skipped.ActivityType,
+		skipped.StartTime, skipped.Reason, skipped.SkippedAt.Format(timeLayout))
+	return err
+}
+
+// ClearSkipped forgets a skipped activity, typically once it synced.
+func (s *SQLiteDB) ClearSkipped(activityID int) error {
+	_, err := s.db.Exec(`DELETE FROM skipped_activities WHERE activity_id = ?`, activityID)
+	return err
+}
+
+// IsSkipped reports whether an activity is recorded as skipped.
+func (s *SQLiteDB) IsSkipped(activityID int) (bool, error) {
+	var found int
+	err := s.db.QueryRow(`SELECT 1 FROM skipped_activities WHERE activity_id = ?`, activityID).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ListSkipped returns skipped activities, most recently skipped first.
+func (s *SQLiteDB) ListSkipped(limit int) ([]SkippedActivity, error) {
+	rows, err := s.db.Query(`
+	SELECT activity_id, run_id, activity_name, activity_type, start_time, reason, skipped_at
+	FROM skipped_activities ORDER BY skipped_at DESC, activity_id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skipped := []SkippedActivity{}
+	for rows.Next() {
+		var a SkippedActivity
+		var runID sql.NullInt64
+		var name, activityType, startTime sql.NullString
+		if err := rows.Scan(&a.ActivityID, &runID, &name, &activityType, &startTime, &a.Reason, &a.SkippedAt); err != nil {
+			return nil, err
+		}
+		a.RunID = runID.Int64
+		a.ActivityName, a.ActivityType, a.StartTime = name.String, activityType.String, startTime.String
+		skipped = append(skipped, a)
+	}
+	return skipped, rows.Err()
+}
+
+// GetSyncRules returns the stored sync rules as JSON, or "" if none were
+// saved yet.
+func (s *SQLiteDB) GetSyncRules() (string, error) {
+	var rules string
+	err := s.db.QueryRow(`SELECT rules FROM sync_rules WHERE id = 1`).Scan(&rules)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return rules, err
+}
+
+// SaveSyncRules stores the sync rules as JSON.
+func (s *SQLiteDB) SaveSyncRules(rules string) error {
+	_, err := s.db.Exec(`
+	INSERT INTO sync_rules (id, rules, updated_at) VALUES (1, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET rules = excluded.rules, updated_at = excluded.updated_at`,
+		rules, time.Now().UTC().Format(timeLayout))
+	return err
+}
@@ -3,11 +3,65 @@ package database
 
 import (
     "database/sql"
+    "errors"
     "fmt"
     "strings"
     "time"
 )
 
+// activityColumns is the column list shared by every activity query; it must
+// stay in sync with scanActivity.
+const activityColumns = `id, activity_id, activity_name, start_time, activity_type, duration, distance,
+           max_heart_rate, avg_heart_rate, avg_power, calories, steps,
+           elevation_gain, start_latitude, start_longitude,
+           filename, file_type, file_size, file_sha256, source_format, downloaded, downloaded_at,
+           source, device_serial, file_start_time, summary_hash, revision,
+           remote_deleted, remote_deleted_at, created_at, last_sync`
+
+// activityWriteColumns lists the columns written by CreateActivity,
+// UpdateActivity and UpsertActivity, in the order of activityValues.
+// activity_id must stay first.
+var activityWriteColumns = []string{
+	"activity_id", "activity_name", "start_time", "activity_type", "duration", "distance",
+	"max_heart_rate", "avg_heart_rate", "avg_power", "calories",
+	"steps", "elevation_gain", "start_latitude", "start_longitude",
+	"filename", "file_type", "file_size", "file_sha256", "source_format",
+	"downloaded", "downloaded_at", "source", "device_serial", "file_start_time", "summary_hash",
+}
+
+func activityValues(a *Activity) []interface{} {
+	return []interface{}{
+		a.ActivityID, a.ActivityName, a.StartTime.Format(timeLayout), a.ActivityType, a.Duration, a.Distance,
+		a.MaxHeartRate, a.AvgHeartRate, a.AvgPower, a.Calories,
+		a.Steps, a.ElevationGain, a.StartLatitude, a.StartLongitude,
+		a.Filename, a.FileType, a.FileSize, a.FileSHA256, a.SourceFormat,
+		a.Downloaded, nullableTime(a.DownloadedAt), a.source(), a.DeviceSerial, nullableTime(a.FileStartTime),
+		a.SummaryHash,
+	}
+}
+
+// nullableTime formats an optional timestamp for writing, mapping nil to NULL
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(timeLayout)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// timeLayout is the format timestamps are written to SQLite in.
+const timeLayout = "2006-01-02 15:04:05"
+
+// ErrActivityNotFound is returned when no row matches an activity ID.
+var ErrActivityNotFound = errors.New("activity not found")
+
+// ErrInvalidSort is returned by FilterActivities for an unknown sort column
+// or order.
+var ErrInvalidSort = errors.New("invalid sort")
+
 type SQLiteDB struct {
     db *sql.DB
 }
@@ -33,6 +87,7 @@ func (s *SQLiteDB) CreateTables() error {
 	CREATE TABLE IF NOT EXISTS activities (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		activity_id INTEGER UNIQUE NOT NULL,
+		activity_name TEXT NOT NULL DEFAULT '',
 		start_time DATETIME NOT NULL,
 		activity_type TEXT,
 		duration INTEGER,
@@ -48,7 +103,17 @@ func (s *SQLiteDB) CreateTables() error {
 		filename TEXT UNIQUE,
 		file_type TEXT,
 		file_size INTEGER,
+		file_sha256 TEXT NOT NULL DEFAULT '',
+		source_format TEXT NOT NULL DEFAULT '',
+		source TEXT NOT NULL DEFAULT 'garmin',
+		device_serial TEXT NOT NULL DEFAULT '',
+		file_start_time DATETIME,
 		downloaded BOOLEAN DEFAULT FALSE,
+		downloaded_at DATETIME,
+		summary_hash TEXT NOT NULL DEFAULT '',
+		revision INTEGER NOT NULL DEFAULT 1,
+		remote_deleted BOOLEAN NOT NULL DEFAULT FALSE,
+		remote_deleted_at DATETIME,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		last_sync DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -57,6 +122,7 @@ func (s *SQLiteDB) CreateTables() error {
     CREATE INDEX IF NOT EXISTS idx_activities_start_time ON activities(start_time);
     CREATE INDEX IF NOT EXISTS idx_activities_activity_type ON activities(activity_type);
     CREATE INDEX IF NOT EXISTS idx_activities_downloaded ON activities(downloaded);
+    CREATE INDEX IF NOT EXISTS idx_activities_keyset ON activities(start_time DESC, activity_id DESC);
     
     CREATE TABLE IF NOT EXISTS daemon_config (
         id INTEGER PRIMARY KEY DEFAULT 1,
@@ -68,18 +134,134 @@ func (s *SQLiteDB) CreateTables() error {
     );
     
     INSERT OR IGNORE INTO daemon_config (id) VALUES (1);
+    
+    CREATE TABLE IF NOT EXISTS activity_revisions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        activity_id INTEGER NOT NULL,
+        revision INTEGER NOT NULL,
+        summary_hash TEXT,
+        snapshot TEXT NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (activity_id, revision)
+    );
+    
+    CREATE TABLE IF NOT EXISTS sync_runs (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        trigger TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'running',
+        started_at DATETIME NOT NULL,
+        finished_at DATETIME,
+        found INTEGER NOT NULL DEFAULT 0,
+        new INTEGER NOT NULL DEFAULT 0,
+        updated INTEGER NOT NULL DEFAULT 0,
+        failed INTEGER NOT NULL DEFAULT 0,
+        skipped INTEGER NOT NULL DEFAULT 0,
+        error TEXT
+    );
+    
+    CREATE TABLE IF NOT EXISTS sync_errors (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        run_id INTEGER NOT NULL REFERENCES sync_runs(id) ON DELETE CASCADE,
+        activity_id INTEGER NOT NULL,
+        stage TEXT NOT NULL,
+        message TEXT NOT NULL,
+        attempt INTEGER NOT NULL DEFAULT 1,
+        created_at DATETIME NOT NULL
+    );
+    
+    CREATE INDEX IF NOT EXISTS idx_sync_errors_run_id ON sync_errors(run_id);
+    CREATE INDEX IF NOT EXISTS idx_sync_errors_activity_id ON sync_errors(activity_id);
+    
+    CREATE TABLE IF NOT EXISTS sync_retries (
+        activity_id INTEGER PRIMARY KEY,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at DATETIME NOT NULL,
+        last_stage TEXT,
+        last_error TEXT,
+        summary TEXT,
+        updated_at DATETIME NOT NULL
+    );
+    
+    CREATE INDEX IF NOT EXISTS idx_sync_retries_due ON sync_retries(status, next_attempt_at);
+    
+    CREATE TABLE IF NOT EXISTS schedules (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL UNIQUE,
+        kind TEXT NOT NULL,
+        schedule_cron TEXT NOT NULL,
+        params TEXT NOT NULL DEFAULT '{}',
+        enabled BOOLEAN NOT NULL DEFAULT TRUE,
+        created_at DATETIME NOT NULL,
+        updated_at DATETIME NOT NULL
+    );
+    
+    CREATE TABLE IF NOT EXISTS schedule_runs (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        schedule_id INTEGER NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+        trigger TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'running',
+        started_at DATETIME NOT NULL,
+        finished_at DATETIME,
+        result TEXT,
+        error TEXT
+    );
+    
+    CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule_id ON schedule_runs(schedule_id);
+    
+    CREATE TABLE IF NOT EXISTS sync_rules (
+        id INTEGER PRIMARY KEY DEFAULT 1,
+        rules TEXT NOT NULL,
+        updated_at DATETIME NOT NULL,
+        CONSTRAINT single_rules CHECK (id = 1)
+    );
+    
+    CREATE TABLE IF NOT EXISTS skipped_activities (
+        activity_id INTEGER PRIMARY KEY,
+        run_id INTEGER,
+        activity_name TEXT,
+        activity_type TEXT,
+        start_time TEXT,
+        reason TEXT NOT NULL,
+        skipped_at DATETIME NOT NULL
+    );
+    
+    CREATE TABLE IF NOT EXISTS activity_laps (
+        activity_id INTEGER NOT NULL REFERENCES activities(activity_id) ON DELETE CASCADE,
+        lap_index INTEGER NOT NULL,
+        start_time DATETIME NOT NULL,
+        duration REAL,
+        distance REAL,
+        avg_speed REAL,
+        max_speed REAL,
+        avg_heart_rate INTEGER,
+        max_heart_rate INTEGER,
+        avg_cadence INTEGER,
+        max_cadence INTEGER,
+        avg_power INTEGER,
+        max_power INTEGER,
+        calories INTEGER,
+        elevation_gain REAL,
+        elevation_loss REAL,
+        PRIMARY KEY (activity_id, lap_index)
+    );
+    
+    CREATE TABLE IF NOT EXISTS wellness (
+        date TEXT PRIMARY KEY,
+        data TEXT NOT NULL,
+        fetched_at DATETIME NOT NULL
+    );
     `
     
-    _, err := s.db.Exec(schema)
-    return err
+    if _, err := s.db.Exec(schema); err != nil {
+        return err
+    }
+    
+    return s.migrate()
 }
 
 func (s *SQLiteDB) GetActivities(limit, offset int) ([]Activity, error) {
-    query := `
-    SELECT id, activity_id, start_time, activity_type, duration, distance, 
-           max_heart_rate, avg_heart_rate, avg_power, calories, steps, 
-           elevation_gain, start_latitude, start_longitude,
-           filename, file_type, file_size, downloaded, created_at, last_sync
+    query := `SELECT ` + activityColumns + `
     FROM activities 
     ORDER BY start_time DESC 
     LIMIT ? OFFSET ?`
@@ -90,38 +272,7 @@ func (s *SQLiteDB) GetActivities(limit, offset int) ([]Activity, error) {
     }
     defer rows.Close()
     
-    var activities []Activity
-    for rows.Next() {
-        var a Activity
-        var startTime, createdAt, lastSync string
-        
-        err := rows.Scan(
-            &a.ID, &a.ActivityID, &startTime, &a.ActivityType,
-            &a.Duration, &a.Distance, &a.MaxHeartRate, &a.AvgHeartRate,
-            &a.AvgPower, &a.Calories, &a.Steps, &a.ElevationGain,
-            &a.StartLatitude, &a.StartLongitude,
-            &a.Filename, &a.FileType, &a.FileSize, &a.Downloaded,
-            &createdAt, &lastSync,
-        )
-        if err != nil {
-            return nil, err
-        }
-        
-        // Parse time strings
-        if a.StartTime, err = time.Parse("2006-01-02 15:04:05", startTime); err != nil {
-            return nil, err
-        }
-        if a.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
-            return nil, err
-        }
-        if a.LastSync, err = time.Parse("2006-01-02 15:04:05", lastSync); err != nil {
-            return nil, err
-        }
-        
-        activities = append(activities, a)
-    }
-    
-    return activities, nil
+    return scanActivities(rows)
 }
 
 func (s *SQLiteDB) ActivityExists(activityID int) (bool, error) {
@@ -139,89 +290,41 @@ func (s *SQLiteDB) DB() *sql.DB {
 }
 
 func (s *SQLiteDB) GetActivity(activityID int) (*Activity, error) {
-    query := `
-    SELECT id, activity_id, start_time, activity_type, duration, distance, 
-           max_heart_rate, avg_heart_rate, avg_power, calories, steps, 
-           elevation_gain, start_latitude, start_longitude,
-           filename, file_type, file_size, downloaded, created_at, last_sync
+    query := `SELECT ` + activityColumns + `
     FROM activities 
     WHERE activity_id = ?`
     
-    row := s.db.QueryRow(query, activityID)
-    
-    var a Activity
-    var startTime, createdAt, lastSync string
-    
-    err := row.Scan(
-        &a.ID, &a.ActivityID, &startTime, &a.ActivityType,
-        &a.Duration, &a.Distance, &a.MaxHeartRate, &a.AvgHeartRate,
-        &a.AvgPower, &a.Calories, &a.Steps, &a.ElevationGain,
-        &a.StartLatitude, &a.StartLongitude,
-        &a.Filename, &a.FileType, &a.FileSize, &a.Downloaded,
-        &createdAt, &lastSync,
-    )
+    a, err := scanActivity(s.db.QueryRow(query, activityID))
     if err != nil {
         if err == sql.ErrNoRows {
-            return nil, fmt.Errorf("activity not found")
+            return nil, ErrActivityNotFound
         }
         return nil, err
     }
     
-    // Parse time strings
-    if a.StartTime, err = time.Parse("2006-01-02 15:04:05", startTime); err != nil {
-        return nil, err
-    }
-    if a.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
-        return nil, err
-    }
-    if a.LastSync, err = time.Parse("2006-01-02 15:04:05", lastSync); err != nil {
-        return nil, err
-    }
-    
-    return &a, nil
+    return a, nil
 }
 
 func (s *SQLiteDB) CreateActivity(activity *Activity) error {
-	query := `
-	INSERT INTO activities (
-		activity_id, start_time, activity_type, duration, distance,
-		max_heart_rate, avg_heart_rate, avg_power, calories,
-		steps, elevation_gain, start_latitude, start_longitude,
-		filename, file_type, file_size, downloaded
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-    
-    _, err := s.db.Exec(query,
-	activity.ActivityID, activity.StartTime.Format("2006-01-02 15:04:05"),
-	activity.ActivityType, activity.Duration, activity.Distance,
-	activity.MaxHeartRate, activity.AvgHeartRate, activity.AvgPower,
-	activity.Calories, activity.Steps, activity.ElevationGain,
-	activity.StartLatitude, activity.StartLongitude,
-	activity.Filename, activity.FileType,
-	activity.FileSize, activity.Downloaded,
-    )
+	query := `INSERT INTO activities (` + strings.Join(activityWriteColumns, ", ") + `)
+	VALUES (` + placeholders(len(activityWriteColumns)) + `)`
+    
+    _, err := s.db.Exec(query, activityValues(activity)...)
     
     return err
 }
 
 func (s *SQLiteDB) UpdateActivity(activity *Activity) error {
-	query := `
-	UPDATE activities SET 
-		activity_type = ?, duration = ?, distance = ?,
-		max_heart_rate = ?, avg_heart_rate = ?, avg_power = ?,
-		calories = ?, steps = ?, elevation_gain = ?,
-		start_latitude = ?, start_longitude = ?,
-		filename = ?, file_type = ?, file_size = ?,
-		downloaded = ?, last_sync = CURRENT_TIMESTAMP
+	assignments := make([]string, 0, len(activityWriteColumns))
+	for _, column := range activityWriteColumns[1:] {
+		assignments = append(assignments, column+" = ?")
+	}
+	query := `UPDATE activities SET ` + strings.Join(assignments, ", ") + `,
+		last_sync = CURRENT_TIMESTAMP
 	WHERE activity_id = ?`
     
-    _, err := s.db.Exec(query,
-		activity.ActivityType, activity.Duration, activity.Distance,
-		activity.MaxHeartRate, activity.AvgHeartRate, activity.AvgPower,
-		activity.Calories, activity.Steps, activity.ElevationGain,
-		activity.StartLatitude, activity.StartLongitude,
-		activity.Filename, activity.FileType,
-		activity.FileSize, activity.Downloaded, activity.ActivityID,
-    )
+    values := activityValues(activity)
+    _, err := s.db.Exec(query, append(values[1:], activity.ActivityID)...)
     
     return err
 }
@@ -243,50 +346,84 @@ func (s *SQLiteDB) GetStats() (*Stats, error) {
     
     stats.Missing = stats.Total - stats.Downloaded
     
+    // Get count of activities deleted on Garmin Connect
+    err = s.db.QueryRow("SELECT COUNT(*) FROM activities WHERE remote_deleted = TRUE").Scan(&stats.RemoteDeleted)
+    if err != nil {
+        return nil, err
+    }
+    
     return stats, nil
 }
 
-func (s *SQLiteDB) FilterActivities(filters ActivityFilters) ([]Activity, error) {
-    query := `
-	SELECT id, activity_id, start_time, activity_type, duration, distance, 
-		   max_heart_rate, avg_heart_rate, avg_power, calories, steps, 
-		   elevation_gain, start_latitude, start_longitude,
-		   filename, file_type, file_size, downloaded, created_at, last_sync
-    FROM activities WHERE 1=1`
-    
-    var args []interface{}
-    var conditions []string
-    
-    // Build WHERE conditions
-    if filters.ActivityType != "" {
-        conditions = append(conditions, "activity_type = ?")
-        args = append(args, filters.ActivityType)
+// AverageFileSizes returns the average archived file size per activity
+// type and over all activities, for estimating download volume
+func (s *SQLiteDB) AverageFileSizes() (map[string]int64, int64, error) {
+    rows, err := s.db.Query(`
+    SELECT activity_type, AVG(file_size) FROM activities
+    WHERE downloaded = TRUE AND file_size > 0 GROUP BY activity_type`)
+    if err != nil {
+        return nil, 0, err
     }
+    defer rows.Close()
     
-    if filters.DateFrom != nil {
-        conditions = append(conditions, "start_time >= ?")
-        args = append(args, filters.DateFrom.Format("2006-01-02 15:04:05"))
+    byType := make(map[string]int64)
+    for rows.Next() {
+        var activityType sql.NullString
+        var avg float64
+        if err := rows.Scan(&activityType, &avg); err != nil {
+            return nil, 0, err
+        }
+        byType[activityType.String] = int64(avg)
     }
-    
-    if filters.DateTo != nil {
-        conditions = append(conditions, "start_time <= ?")
-        args = append(args, filters.DateTo.Format("2006-01-02 15:04:05"))
+    if err := rows.Err(); err != nil {
+        return nil, 0, err
     }
     
-    if filters.MinDistance > 0 {
-        conditions = append(conditions, "distance >= ?")
-        args = append(args, filters.MinDistance)
+    var overall sql.NullFloat64
+    err = s.db.QueryRow(`SELECT AVG(file_size) FROM activities WHERE downloaded = TRUE AND file_size > 0`).Scan(&overall)
+    if err != nil {
+        return nil, 0, err
     }
-    
-    if filters.MaxDistance > 0 {
-        conditions = append(conditions, "distance <= ?")
-        args = append(args, filters.MaxDistance)
+    return byType, int64(overall.Float64), nil
+}
+
+// activityYear is the year an activity started in: the UTC year of the
+// start time recorded in its file, or of start_time, which Garmin reports in
+// local time, for activities without one
+const activityYear = `CAST(strftime('%Y', COALESCE(file_start_time, start_time)) AS INTEGER)`
+
+// ActivityYears returns the distinct years activities started in, oldest
+// first, as matched by ActivityFilters.Year
+func (s *SQLiteDB) ActivityYears() ([]int, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT ` + activityYear + ` AS year
+	FROM activities ORDER BY year`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var years []int
+	for rows.Next() {
+		var year int
+		if err := rows.Scan(&year); err != nil {
+			return nil, err
+		}
+		years = append(years, year)
+	}
+	return years, rows.Err()
+}
+
+func (s *SQLiteDB) FilterActivities(filters ActivityFilters) ([]Activity, error) {
+    key, err := activitySortKey(filters.SortBy)
+    if err != nil {
+        return nil, err
     }
     
-    if filters.Downloaded != nil {
-        conditions = append(conditions, "downloaded = ?")
-        args = append(args, *filters.Downloaded)
-    }
+    query := `SELECT ` + activityColumns + `
+    FROM activities WHERE 1=1`
+    
+    // Build WHERE conditions
+    conditions, args := filterConditions(filters)
     
     // Add conditions to query
     if len(conditions) > 0 {
@@ -294,17 +431,7 @@ func (s *SQLiteDB) FilterActivities(filters ActivityFilters) ([]Activity, error)
     }
     
     // Add sorting
-    orderBy := "start_time"
-    if filters.SortBy != "" {
-        orderBy = filters.SortBy
-    }
-    
-    order := "DESC"
-    if filters.SortOrder == "asc" {
-        order = "ASC"
-    }
-    
-    query += fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
+    query += " ORDER BY " + key.orderBy(filters.SortOrder)
     
     // Add pagination
     if filters.Limit > 0 {
@@ -323,38 +450,245 @@ func (s *SQLiteDB) FilterActivities(filters ActivityFilters) ([]Activity, error)
     }
     defer rows.Close()
     
-    var activities []Activity
-    for rows.Next() {
-        var a Activity
-        var startTime, createdAt, lastSync string
-        
-        err := rows.Scan(
-		&a.ID, &a.ActivityID, &startTime, &a.ActivityType,
+    return scanActivities(rows)
+}
+
+// eachActivityPage is the number of rows EachActivity reads per query
+const eachActivityPage = 500
+
+// EachActivity calls fn for every activity FilterActivities would return,
+// in the same order, so callers can stream large result sets. Rows are read
+// a page at a time, continuing from the last row of the previous page, so
+// the database is not held locked while fn runs. It stops at the first
+// error from fn and returns it.
+func (s *SQLiteDB) EachActivity(filters ActivityFilters, fn func(*Activity) error) error {
+	key, err := activitySortKey(filters.SortBy)
+	if err != nil {
+		return err
+	}
+	conditions, args := filterConditions(filters)
+	cmp := "<"
+	if filters.SortOrder == "asc" {
+		cmp = ">"
+	}
+
+	remaining, offset := filters.Limit, filters.Offset
+	var last *Activity
+	for {
+		pageConditions, pageArgs := conditions, args
+		if last != nil {
+			pageConditions = append(pageConditions[:len(pageConditions):len(pageConditions)],
+				fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND activity_id %[2]s ?))", key.expr, cmp))
+			value := key.value(last)
+			pageArgs = append(pageArgs[:len(pageArgs):len(pageArgs)], value, value, last.ActivityID)
+		}
+
+		limit := eachActivityPage
+		if filters.Limit > 0 && remaining < limit {
+			limit = remaining
+		}
+		query := `SELECT ` + activityColumns + ` FROM activities`
+		if len(pageConditions) > 0 {
+			query += " WHERE " + strings.Join(pageConditions, " AND ")
+		}
+		query += " ORDER BY " + key.orderBy(filters.SortOrder) + " LIMIT ? OFFSET ?"
+
+		rows, err := s.db.Query(query, append(pageArgs, limit, offset)...)
+		if err != nil {
+			return err
+		}
+		page, err := scanActivities(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for i := range page {
+			if err := fn(&page[i]); err != nil {
+				return err
+			}
+		}
+
+		remaining -= len(page)
+		if len(page) < limit || (filters.Limit > 0 && remaining == 0) {
+			return nil
+		}
+		last, offset = &page[len(page)-1], 0
+	}
+}
+
+// sortKey is a column activities can be sorted by. expr never yields NULL,
+// so rows can be continued from with a plain comparison, and value returns
+// an activity's value of expr.
+type sortKey struct {
+	expr  string
+	value func(a *Activity) interface{}
+}
+
+// orderBy returns the ORDER BY clause for the key, breaking ties by
+// activity_id
+func (k sortKey) orderBy(sortOrder string) string {
+	order := "DESC"
+	if sortOrder == "asc" {
+		order = "ASC"
+	}
+	return fmt.Sprintf("%s %s, activity_id %s", k.expr, order, order)
+}
+
+// sortKeys are the columns FilterActivities can sort by
+var sortKeys = map[string]sortKey{
+	"start_time":     {"start_time", func(a *Activity) interface{} { return a.StartTime.UTC().Format(timeLayout) }},
+	"activity_id":    {"activity_id", func(a *Activity) interface{} { return a.ActivityID }},
+	"activity_name":  {"activity_name", func(a *Activity) interface{} { return a.ActivityName }},
+	"activity_type":  {"COALESCE(activity_type, '')", func(a *Activity) interface{} { return a.ActivityType }},
+	"duration":       {"COALESCE(duration, 0)", func(a *Activity) interface{} { return a.Duration }},
+	"distance":       {"COALESCE(distance, 0)", func(a *Activity) interface{} { return a.Distance }},
+	"max_heart_rate": {"COALESCE(max_heart_rate, 0)", func(a *Activity) interface{} { return a.MaxHeartRate }},
+	"avg_heart_rate": {"COALESCE(avg_heart_rate, 0)", func(a *Activity) interface{} { return a.AvgHeartRate }},
+	"avg_power":      {"COALESCE(avg_power, 0)", func(a *Activity) interface{} { return a.AvgPower }},
+	"calories":       {"COALESCE(calories, 0)", func(a *Activity) interface{} { return a.Calories }},
+	"steps":          {"COALESCE(steps, 0)", func(a *Activity) interface{} { return a.Steps }},
+	"elevation_gain": {"COALESCE(elevation_gain, 0)", func(a *Activity) interface{} { return a.ElevationGain }},
+}
+
+// Validate checks the sort fields of the filters
+func (f ActivityFilters) Validate() error {
+	if _, err := activitySortKey(f.SortBy); err != nil {
+		return err
+	}
+	switch f.SortOrder {
+	case "", "asc", "desc":
+		return nil
+	}
+	return fmt.Errorf("%w: order must be asc or desc", ErrInvalidSort)
+}
+
+// activitySortKey returns the sort key for a SortBy value, defaulting to
+// start_time
+func activitySortKey(sortBy string) (sortKey, error) {
+	if sortBy == "" {
+		sortBy = "start_time"
+	}
+	key, ok := sortKeys[sortBy]
+	if !ok {
+		return sortKey{}, fmt.Errorf("%w: unknown column %q", ErrInvalidSort, sortBy)
+	}
+	return key, nil
+}
+
+// filterConditions translates the filters into SQL conditions and their
+// arguments. Pagination and sorting fields are left to the caller.
+func filterConditions(filters ActivityFilters) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filters.ActivityType != "" {
+		conditions = append(conditions, "activity_type = ?")
+		args = append(args, filters.ActivityType)
+	}
+
+	if filters.DateFrom != nil {
+		conditions = append(conditions, "start_time >= ?")
+		args = append(args, filters.DateFrom.Format(timeLayout))
+	}
+
+	if filters.DateTo != nil {
+		conditions = append(conditions, "start_time <= ?")
+		args = append(args, filters.DateTo.Format(timeLayout))
+	}
+
+	if filters.Year != 0 {
+		conditions = append(conditions, activityYear+" = ?")
+		args = append(args, filters.Year)
+	}
+
+	if filters.MinDistance > 0 {
+		conditions = append(conditions, "distance >= ?")
+		args = append(args, filters.MinDistance)
+	}
+
+	if filters.MaxDistance > 0 {
+		conditions = append(conditions, "distance <= ?")
+		args = append(args, filters.MaxDistance)
+	}
+
+	if filters.MinDuration > 0 {
+		conditions = append(conditions, "duration >= ?")
+		args = append(args, filters.MinDuration)
+	}
+
+	if filters.MaxDuration > 0 {
+		conditions = append(conditions, "duration <= ?")
+		args = append(args, filters.MaxDuration)
+	}
+
+	if filters.Downloaded != nil {
+		conditions = append(conditions, "downloaded = ?")
+		args = append(args, *filters.Downloaded)
+	}
+
+	return conditions, args
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanActivity reads a row selected with activityColumns.
+func scanActivity(row rowScanner) (*Activity, error) {
+	var a Activity
+	var downloadedAt, fileStartTime, remoteDeletedAt sql.NullTime
+	err := row.Scan(
+		&a.ID, &a.ActivityID, &a.ActivityName, &a.StartTime, &a.ActivityType,
 		&a.Duration, &a.Distance, &a.MaxHeartRate, &a.AvgHeartRate,
 		&a.AvgPower, &a.Calories, &a.Steps, &a.ElevationGain,
 		&a.StartLatitude, &a.StartLongitude,
-		&a.Filename, &a.FileType, &a.FileSize, &a.Downloaded,
-		&createdAt, &lastSync,
-        )
-        if err != nil {
-            return nil, err
-        }
-        
-        // Parse times
-        a.StartTime, _ = time.Parse("2006-01-02 15:04:05", startTime)
-        a.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-        a.LastSync, _ = time.Parse("2006-01-02 15:04:05", lastSync)
-        
-        activities = append(activities, a)
-    }
-    
-    return activities, nil
+		&a.Filename, &a.FileType, &a.FileSize, &a.FileSHA256, &a.SourceFormat,
+		&a.Downloaded, &downloadedAt,
+		&a.Source, &a.DeviceSerial, &fileStartTime,
+		&a.SummaryHash, &a.Revision,
+		&a.RemoteDeleted, &remoteDeletedAt,
+		&a.CreatedAt, &a.LastSync,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if downloadedAt.Valid {
+		a.DownloadedAt = &downloadedAt.Time
+	}
+	if fileStartTime.Valid {
+		a.FileStartTime = &fileStartTime.Time
+	}
+	if remoteDeletedAt.Valid {
+		a.RemoteDeletedAt = &remoteDeletedAt.Time
+	}
+	return &a, nil
+}
+
+func scanActivities(rows *sql.Rows) ([]Activity, error) {
+	var activities []Activity
+	for rows.Next() {
+		a, err := scanActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, *a)
+	}
+	return activities, rows.Err()
 }
 
 func (s *SQLiteDB) Close() error {
     return s.db.Close()
 }
 
+// Backup writes a consistent copy of the database to path, which must not
+// exist yet
+func (s *SQLiteDB) Backup(path string) error {
+    _, err := s.db.Exec(`VACUUM INTO ?`, path)
+    return err
+}
+
 // NewSQLiteDBFromDB wraps an existing sql.DB connection
 func NewSQLiteDBFromDB(db *sql.DB) *SQLiteDB {
 	return &SQLiteDB{db: db}
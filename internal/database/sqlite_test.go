@@ -0,0 +1,56 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB returns an empty database with the full schema, backed by a
+// temporary file that is removed when the test ends
+func newTestDB(t *testing.T) *SQLiteDB {
+	t.Helper()
+	db, err := NewSQLiteDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testActivity returns a minimal activity row starting at the given time
+func testActivity(id int, start time.Time) *Activity {
+	return &Activity{
+		ActivityID:   id,
+		ActivityName: "Activity",
+		StartTime:    start,
+		ActivityType: "running",
+		Duration:     1800,
+		Distance:     5000,
+		Filename:     fmt.Sprintf("activities/activity_%d.fit", id),
+		FileType:     "fit",
+	}
+}
+
+// insertActivities stores the activities or fails the test
+func insertActivities(t *testing.T, db *SQLiteDB, activities ...*Activity) {
+	t.Helper()
+	for _, a := range activities {
+		if err := db.CreateActivity(a); err != nil {
+			t.Fatalf("CreateActivity(%d): %v", a.ActivityID, err)
+		}
+	}
+}
+
+// countRows returns the number of rows in a table matching a condition
+func countRows(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
@@ -0,0 +1,161 @@
+// internal/database/sync_runs.go
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrSyncRunNotFound is returned when no sync run matches an ID.
+var ErrSyncRunNotFound = errors.New("sync run not found")
+
+// SyncRun records one execution of the sync job
+type SyncRun struct {
+	ID         int64       `json:"id"`
+	Trigger    string      `json:"trigger"` // cron, manual or api
+	Status     string      `json:"status"`  // running, succeeded, failed or cancelled
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	Found      int         `json:"found"`
+	New        int         `json:"new"`
+	Updated    int         `json:"updated"`
+	Failed     int         `json:"failed"`
+	Skipped    int         `json:"skipped"` // filtered out by sync rules
+	Error      string      `json:"error,omitempty"`
+	Errors     []SyncError `json:"errors,omitempty"`
+}
+
+// SyncError records a failure to sync a single activity
+type SyncError struct {
+	ID         int64     `json:"id"`
+	RunID      int64     `json:"run_id"`
+	ActivityID int       `json:"activity_id"`
+	Stage      string    `json:"stage"` // download, parse, file, db or process
+	Message    string    `json:"message"`
+	Attempt    int       `json:"attempt"` // how many times this activity has failed so far
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const syncRunColumns = `id, trigger, status, started_at, finished_at, found, new, updated, failed, skipped, error`
+
+// CreateSyncRun records the start of a sync run.
+func (s *SQLiteDB) CreateSyncRun(trigger string) (*SyncRun, error) {
+	run := &SyncRun{Trigger: trigger, Status: "running", StartedAt: time.Now().UTC().Truncate(time.Second)}
+
+	result, err := s.db.Exec(`INSERT INTO sync_runs (trigger, status, started_at) VALUES (?, ?, ?)`,
+		run.Trigger, run.Status, run.StartedAt.Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	if run.ID, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// FinishSyncRun stores the final counts, status and error of a run.
+func (s *SQLiteDB) FinishSyncRun(run *SyncRun) error {
+	finished := time.Now().UTC().Truncate(time.Second)
+	run.FinishedAt = &finished
+
+	_, err := s.db.Exec(`
+	UPDATE sync_runs SET status = ?, finished_at = ?, found = ?, new = ?, updated = ?, failed = ?, skipped = ?, error = ?
+	WHERE id = ?`,
+		run.Status, finished.Format(timeLayout), run.Found, run.New, run.Updated, run.Failed, run.Skipped,
+		run.Error, run.ID)
+	return err
+}
+
+// RecordSyncError stores an activity failure. The attempt number counts all
+// failures of the activity across runs, including this one.
+func (s *SQLiteDB) RecordSyncError(runID int64, activityID int, stage, message string) (*SyncError, error) {
+	syncErr := &SyncError{
+		RunID:      runID,
+		ActivityID: activityID,
+		Stage:      stage,
+		Message:    message,
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+
+	err := s.db.QueryRow(`SELECT COUNT(*) + 1 FROM sync_errors WHERE activity_id = ?`, activityID).Scan(&syncErr.Attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`
+	INSERT INTO sync_errors (run_id, activity_id, stage, message, attempt, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)`,
+		runID, activityID, stage, message, syncErr.Attempt, syncErr.CreatedAt.Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	if syncErr.ID, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return syncErr, nil
+}
+
+// ListSyncRuns returns the most recent sync runs, newest first.
+func (s *SQLiteDB) ListSyncRuns(limit int) ([]SyncRun, error) {
+	rows, err := s.db.Query(`SELECT `+syncRunColumns+` FROM sync_runs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []SyncRun{}
+	for rows.Next() {
+		run, err := scanSyncRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// GetSyncRun returns a sync run together with its activity errors.
+func (s *SQLiteDB) GetSyncRun(id int64) (*SyncRun, error) {
+	run, err := scanSyncRun(s.db.QueryRow(`SELECT `+syncRunColumns+` FROM sync_runs WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSyncRunNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+	SELECT id, run_id, activity_id, stage, message, attempt, created_at
+	FROM sync_errors WHERE run_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	run.Errors = []SyncError{}
+	for rows.Next() {
+		var e SyncError
+		if err := rows.Scan(&e.ID, &e.RunID, &e.ActivityID, &e.Stage, &e.Message, &e.Attempt, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		run.Errors = append(run.Errors, e)
+	}
+	return run, rows.Err()
+}
+
+func scanSyncRun(row rowScanner) (*SyncRun, error) {
+	var run SyncRun
+	var finishedAt sql.NullTime
+	var runErr sql.NullString
+	err := row.Scan(&run.ID, &run.Trigger, &run.Status, &run.StartedAt, &finishedAt,
+		&run.Found, &run.New, &run.Updated, &run.Failed, &run.Skipped, &runErr)
+	if err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	run.Error = runErr.String
+	return &run, nil
+}
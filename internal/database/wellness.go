@@ -0,0 +1,13 @@
+// internal/database/wellness.go
+package database
+
+import "time"
+
+// SaveWellness inserts or replaces the stats of a day.
+func (s *SQLiteDB) SaveWellness(date string, data []byte) error {
+	_, err := s.db.Exec(`
+	INSERT INTO wellness (date, data, fetched_at) VALUES (?, ?, ?)
+	ON CONFLICT(date) DO UPDATE SET data = excluded.data, fetched_at = excluded.fetched_at`,
+		date, string(data), time.Now().UTC().Format(timeLayout))
+	return err
+}
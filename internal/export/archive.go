@@ -0,0 +1,75 @@
+package export
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// archiveWriter adds files to a streamed archive
+type archiveWriter interface {
+	// add writes a file of the given size read from r
+	add(name string, modTime time.Time, size int64, r io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func newZipArchive(w io.Writer) *zipArchive {
+	return &zipArchive{zw: zip.NewWriter(w)}
+}
+
+func (a *zipArchive) add(name string, modTime time.Time, size int64, r io.Reader) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+	header.SetMode(0644)
+	w, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(w, r, size)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+// tarGzArchive writes a gzip-compressed tarball; unlike ZIP, tar needs each
+// file's size before its content
+type tarGzArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarGzArchive(w io.Writer) *tarGzArchive {
+	gz := gzip.NewWriter(w)
+	return &tarGzArchive{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (a *tarGzArchive) add(name string, modTime time.Time, size int64, r io.Reader) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+	}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(a.tw, r, size)
+	return err
+}
+
+func (a *tarGzArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		a.gz.Close()
+		return err
+	}
+	return a.gz.Close()
+}
@@ -0,0 +1,168 @@
+package export
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+// Unit systems for activity summaries. Metric values are the stored ones:
+// distance and elevation in metres. Imperial converts distance to miles and
+// elevation to feet.
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+const (
+	metresPerMile = 1609.344
+	metresPerFoot = 0.3048
+)
+
+// column is one field of an activity row. value returns an int, int64,
+// float64, bool, string, time.Time or *time.Time so JSON output keeps its
+// type; CSV output formats it with csvValue.
+type column struct {
+	name  string
+	value func(a *database.Activity, units string) interface{}
+}
+
+// activityColumns lists every database.Activity field, named like its JSON
+// key, in the order manifests and summaries write them
+var activityColumns = []column{
+	{"id", func(a *database.Activity, _ string) interface{} { return a.ID }},
+	{"activity_id", func(a *database.Activity, _ string) interface{} { return a.ActivityID }},
+	{"activity_name", func(a *database.Activity, _ string) interface{} { return a.ActivityName }},
+	{"start_time", func(a *database.Activity, _ string) interface{} { return a.StartTime }},
+	{"activity_type", func(a *database.Activity, _ string) interface{} { return a.ActivityType }},
+	{"duration", func(a *database.Activity, _ string) interface{} { return a.Duration }},
+	{"distance", func(a *database.Activity, units string) interface{} { return distance(a.Distance, units) }},
+	{"max_heart_rate", func(a *database.Activity, _ string) interface{} { return a.MaxHeartRate }},
+	{"avg_heart_rate", func(a *database.Activity, _ string) interface{} { return a.AvgHeartRate }},
+	{"avg_power", func(a *database.Activity, _ string) interface{} { return a.AvgPower }},
+	{"calories", func(a *database.Activity, _ string) interface{} { return a.Calories }},
+	{"steps", func(a *database.Activity, _ string) interface{} { return a.Steps }},
+	{"elevation_gain", func(a *database.Activity, units string) interface{} { return elevation(a.ElevationGain, units) }},
+	{"start_latitude", func(a *database.Activity, _ string) interface{} { return a.StartLatitude }},
+	{"start_longitude", func(a *database.Activity, _ string) interface{} { return a.StartLongitude }},
+	{"filename", func(a *database.Activity, _ string) interface{} { return a.Filename }},
+	{"file_type", func(a *database.Activity, _ string) interface{} { return a.FileType }},
+	{"file_size", func(a *database.Activity, _ string) interface{} { return a.FileSize }},
+	{"file_sha256", func(a *database.Activity, _ string) interface{} { return a.FileSHA256 }},
+	{"source_format", func(a *database.Activity, _ string) interface{} { return a.SourceFormat }},
+	{"downloaded", func(a *database.Activity, _ string) interface{} { return a.Downloaded }},
+	{"downloaded_at", func(a *database.Activity, _ string) interface{} { return a.DownloadedAt }},
+	{"source", func(a *database.Activity, _ string) interface{} { return a.Source }},
+	{"device_serial", func(a *database.Activity, _ string) interface{} { return a.DeviceSerial }},
+	{"file_start_time", func(a *database.Activity, _ string) interface{} { return a.FileStartTime }},
+	{"summary_hash", func(a *database.Activity, _ string) interface{} { return a.SummaryHash }},
+	{"revision", func(a *database.Activity, _ string) interface{} { return a.Revision }},
+	{"remote_deleted", func(a *database.Activity, _ string) interface{} { return a.RemoteDeleted }},
+	{"remote_deleted_at", func(a *database.Activity, _ string) interface{} { return a.RemoteDeletedAt }},
+	{"created_at", func(a *database.Activity, _ string) interface{} { return a.CreatedAt }},
+	{"last_sync", func(a *database.Activity, _ string) interface{} { return a.LastSync }},
+}
+
+// selectColumns returns the named columns in the given order, or every
+// column if names is empty
+func selectColumns(names []string) ([]column, error) {
+	if len(names) == 0 {
+		return activityColumns, nil
+	}
+
+	columns := make([]column, 0, len(names))
+	for _, name := range names {
+		col, ok := findColumn(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidOptions, name)
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+func findColumn(name string) (column, bool) {
+	for _, col := range activityColumns {
+		if col.name == name {
+			return col, true
+		}
+	}
+	return column{}, false
+}
+
+// ColumnNames lists the columns available to summaries
+func ColumnNames() []string {
+	names := make([]string, len(activityColumns))
+	for i, col := range activityColumns {
+		names[i] = col.name
+	}
+	return names
+}
+
+func distance(metres float64, units string) float64 {
+	if units == UnitsImperial {
+		return round(metres/metresPerMile, 3)
+	}
+	return metres
+}
+
+func elevation(metres float64, units string) float64 {
+	if units == UnitsImperial {
+		return round(metres/metresPerFoot, 1)
+	}
+	return metres
+}
+
+func round(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+// csvValue formats a column value for CSV. Missing times are left empty.
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return csvValue(*v)
+	}
+	return fmt.Sprint(v)
+}
+
+// csvRow formats an activity's values for the given columns
+func csvRow(a *database.Activity, columns []column, units string) []string {
+	row := make([]string, 0, len(columns)+1)
+	for _, col := range columns {
+		row = append(row, csvValue(col.value(a, units)))
+	}
+	return row
+}
+
+// csvHeader returns the column names
+func csvHeader(columns []column) []string {
+	header := make([]string, 0, len(columns)+1)
+	for _, col := range columns {
+		header = append(header, col.name)
+	}
+	return header
+}
@@ -0,0 +1,100 @@
+package export
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+func TestActivityColumnsCoverAllFields(t *testing.T) {
+	typ := reflect.TypeOf(database.Activity{})
+	if len(activityColumns) != typ.NumField() {
+		t.Fatalf("%d columns, want one per database.Activity field (%d)", len(activityColumns), typ.NumField())
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		key := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if activityColumns[i].name != key {
+			t.Errorf("column %d = %q, want %q", i, activityColumns[i].name, key)
+		}
+	}
+}
+
+func TestUnitConversion(t *testing.T) {
+	tests := []struct {
+		name      string
+		metres    float64
+		units     string
+		distance  float64
+		elevation float64
+	}{
+		{"metric unchanged", 10000.123, UnitsMetric, 10000.123, 10000.123},
+		{"imperial one mile", 1609.344, UnitsImperial, 1, 5280},
+		{"imperial rounds", 10000, UnitsImperial, 6.214, 32808.4},
+		{"imperial zero", 0, UnitsImperial, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := distance(tt.metres, tt.units); got != tt.distance {
+				t.Errorf("distance(%v, %q) = %v, want %v", tt.metres, tt.units, got, tt.distance)
+			}
+			if got := elevation(tt.metres, tt.units); got != tt.elevation {
+				t.Errorf("elevation(%v, %q) = %v, want %v", tt.metres, tt.units, got, tt.elevation)
+			}
+		})
+	}
+}
+
+func TestCSVValue(t *testing.T) {
+	at := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	var missing *time.Time
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"string", "Morning Run", "Morning Run"},
+		{"int", 3600, "3600"},
+		{"int64", int64(1 << 40), "1099511627776"},
+		{"float", 6.214, "6.214"},
+		{"whole float", 10000.0, "10000"},
+		{"bool", true, "true"},
+		{"time", at, "2024-05-01T07:30:00Z"},
+		{"zero time", time.Time{}, ""},
+		{"time pointer", &at, "2024-05-01T07:30:00Z"},
+		{"nil time pointer", missing, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvValue(tt.value); got != tt.want {
+				t.Errorf("csvValue(%#v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectColumns(t *testing.T) {
+	columns, err := selectColumns(nil)
+	if err != nil {
+		t.Fatalf("selectColumns(nil): %v", err)
+	}
+	if len(columns) != len(activityColumns) {
+		t.Errorf("selectColumns(nil) returned %d columns, want all %d", len(columns), len(activityColumns))
+	}
+
+	columns, err = selectColumns([]string{"distance", " activity_id ", "start_time"})
+	if err != nil {
+		t.Fatalf("selectColumns: %v", err)
+	}
+	want := []string{"distance", "activity_id", "start_time"}
+	if got := csvHeader(columns); !reflect.DeepEqual(got, want) {
+		t.Errorf("selected columns = %v, want %v", got, want)
+	}
+
+	if _, err := selectColumns([]string{"activity_id", "pace"}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("unknown column error = %v, want ErrInvalidOptions", err)
+	}
+}
@@ -0,0 +1,355 @@
+// Package export writes the activity archive out in bulk.
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/convert"
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+// Archive formats
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// FormatOriginal selects each activity's stored file as is
+const FormatOriginal = "original"
+
+// pageSize is the number of activity rows loaded at a time
+const pageSize = 200
+
+// ErrInvalidOptions is returned for malformed export options
+var ErrInvalidOptions = errors.New("invalid export options")
+
+// Options selects the activities to export and the shape of the archive
+type Options struct {
+	ActivityType string
+
+	// From and To limit the export to activities starting in [From, To). A
+	// zero bound is open.
+	From time.Time
+	To   time.Time
+
+	// Formats lists the file formats written for each activity: original,
+	// fit, gpx or tcx. It defaults to original.
+	Formats []string
+
+	// Archive is ArchiveZip (default) or ArchiveTarGz
+	Archive string
+
+	// Cursor resumes an export after the activities of an earlier one, and
+	// Limit caps the number of activities in this archive. Together they
+	// split a huge archive into chunks; see NextCursor.
+	Cursor string
+	Limit  int
+}
+
+// Validate checks the options and fills in defaults
+func (o *Options) Validate() error {
+	switch o.Archive {
+	case "":
+		o.Archive = ArchiveZip
+	case ArchiveZip, ArchiveTarGz:
+	default:
+		return fmt.Errorf("%w: archive must be %s or %s", ErrInvalidOptions, ArchiveZip, ArchiveTarGz)
+	}
+
+	if len(o.Formats) == 0 {
+		o.Formats = []string{FormatOriginal}
+	}
+	for _, format := range o.Formats {
+		switch format {
+		case FormatOriginal, "fit", convert.FormatGPX, convert.FormatTCX:
+		default:
+			return fmt.Errorf("%w: unknown format %q", ErrInvalidOptions, format)
+		}
+	}
+
+	if o.Limit < 0 {
+		return fmt.Errorf("%w: limit must not be negative", ErrInvalidOptions)
+	}
+	if o.Cursor != "" {
+		if _, err := database.DecodeCursor(o.Cursor); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidOptions, err)
+		}
+	}
+	return nil
+}
+
+// ContentType returns the MIME type of the archive
+func (o *Options) ContentType() string {
+	if o.Archive == ArchiveTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// filters returns the activity filters matching the options
+func (o *Options) filters() database.ActivityFilters {
+	downloaded := true
+	filters := database.ActivityFilters{
+		ActivityType: o.ActivityType,
+		Downloaded:   &downloaded,
+		Cursor:       o.Cursor,
+		Limit:        pageSize,
+	}
+	if !o.From.IsZero() {
+		filters.DateFrom = &o.From
+	}
+	if !o.To.IsZero() {
+		// DateTo is inclusive, the window end is not
+		to := o.To.Add(-time.Second)
+		filters.DateTo = &to
+	}
+	return filters
+}
+
+// Result summarises a finished export
+type Result struct {
+	Activities int      `json:"activities"`
+	Files      int      `json:"files"`
+	Errors     []string `json:"errors"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// manifestEntry is one activity in manifest.json
+type manifestEntry struct {
+	database.Activity
+	Files []string `json:"files"`
+}
+
+// Exporter streams activity archives
+type Exporter struct {
+	db *database.SQLiteDB
+}
+
+func New(db *database.SQLiteDB) *Exporter {
+	return &Exporter{db: db}
+}
+
+// NextCursor returns the cursor that continues an export limited by
+// opts.Limit, or "" if the export covers every remaining activity. It is
+// known before the archive is written, so it can go in a response header.
+func (e *Exporter) NextCursor(opts Options) (string, error) {
+	if opts.Limit == 0 {
+		return "", nil
+	}
+	return e.db.CursorAfter(opts.filters(), opts.Limit)
+}
+
+// Write streams an archive of the selected activities to w. Each activity's
+// files go under activities/, named by activity ID, followed by
+// manifest.csv and manifest.json describing the exported activities. Only
+// one activity's converted files are held in memory at a time; the
+// manifests are spooled to temporary files.
+//
+// Activities whose files cannot be read or converted are still listed in
+// the manifests and their errors reported in the result and manifest.json.
+// Errors writing the archive itself abort the export, as the stream is left
+// mid-entry. Validate must have been called on opts.
+func (e *Exporter) Write(ctx context.Context, w io.Writer, opts Options) (*Result, error) {
+	result := &Result{Errors: []string{}}
+	nextCursor, err := e.NextCursor(opts)
+	if err != nil {
+		return nil, err
+	}
+	result.NextCursor = nextCursor
+
+	var archive archiveWriter
+	if opts.Archive == ArchiveTarGz {
+		archive = newTarGzArchive(w)
+	} else {
+		archive = newZipArchive(w)
+	}
+
+	csvFile, err := os.CreateTemp("", "garminsync-manifest-*.csv")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(csvFile.Name())
+	defer csvFile.Close()
+	jsonFile, err := os.CreateTemp("", "garminsync-manifest-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(jsonFile.Name())
+	defer jsonFile.Close()
+
+	csvWriter := csv.NewWriter(csvFile)
+	csvWriter.Write(append(csvHeader(activityColumns), "files"))
+	io.WriteString(jsonFile, `{"activities": [`)
+
+	filters := opts.filters()
+	for done := false; !done; {
+		page, err := e.db.ListActivities(filters)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range page.Activities {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if opts.Limit > 0 && result.Activities == opts.Limit {
+				done = true
+				break
+			}
+			activity := &page.Activities[i]
+
+			files, err := e.writeActivity(archive, activity, opts.Formats, result)
+			if err != nil {
+				return nil, err
+			}
+			result.Activities++
+
+			row := csvRow(activity, activityColumns, UnitsMetric)
+			csvWriter.Write(append(row, strings.Join(files, ";")))
+
+			entry, err := json.Marshal(manifestEntry{Activity: *activity, Files: files})
+			if err != nil {
+				return nil, err
+			}
+			if result.Activities > 1 {
+				io.WriteString(jsonFile, ",")
+			}
+			if _, err := jsonFile.Write(append([]byte("\n  "), entry...)); err != nil {
+				return nil, err
+			}
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		filters.Cursor = page.NextCursor
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return nil, err
+	}
+	trailer, err := json.Marshal(struct {
+		Errors     []string `json:"errors"`
+		NextCursor string   `json:"next_cursor,omitempty"`
+	}{result.Errors, result.NextCursor})
+	if err != nil {
+		return nil, err
+	}
+	// Splice the errors and cursor in after the activities array
+	fmt.Fprintf(jsonFile, "\n], %s\n", trailer[1:])
+
+	now := time.Now()
+	for _, manifest := range []struct {
+		name string
+		file *os.File
+	}{{"manifest.csv", csvFile}, {"manifest.json", jsonFile}} {
+		if err := addFile(archive, manifest.name, now, manifest.file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// writeActivity adds an activity's files in each format to the archive and
+// returns their names. Failures to read or convert the stored file are
+// recorded in the result; an error is only returned if the archive could
+// not be written.
+func (e *Exporter) writeActivity(archive archiveWriter, activity *database.Activity, formats []string, result *Result) ([]string, error) {
+	files := []string{}
+	stored := activity.FileFormat()
+	fail := func(format string, err error) {
+		result.Errors = append(result.Errors, fmt.Sprintf("activity %d (%s): %v", activity.ActivityID, format, err))
+	}
+
+	var converted *convert.Activity
+	for _, format := range formats {
+		if format == FormatOriginal {
+			format = stored
+		}
+		name := fmt.Sprintf("activities/%d.%s", activity.ActivityID, format)
+		if containsString(files, name) {
+			continue
+		}
+
+		if format == stored {
+			f, err := os.Open(activity.Filename)
+			if err != nil {
+				fail(format, err)
+				continue
+			}
+			info, err := f.Stat()
+			if err != nil {
+				f.Close()
+				fail(format, err)
+				continue
+			}
+			err = archive.add(name, info.ModTime(), info.Size(), f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to write activity %d to the archive: %w", activity.ActivityID, err)
+			}
+			files = append(files, name)
+			continue
+		}
+
+		if format == "fit" {
+			fail(format, fmt.Errorf("cannot convert a %s file to FIT", stored))
+			continue
+		}
+		if converted == nil {
+			parsed, err := convert.FromFile(activity.Filename, activity.ActivityName, activity.ActivityType)
+			if err != nil {
+				fail(format, err)
+				continue
+			}
+			converted = &parsed
+		}
+		var buf bytes.Buffer
+		if err := convert.Write(&buf, format, *converted); err != nil {
+			fail(format, err)
+			continue
+		}
+		if err := archive.add(name, activity.StartTime, int64(buf.Len()), &buf); err != nil {
+			return nil, fmt.Errorf("failed to write activity %d to the archive: %w", activity.ActivityID, err)
+		}
+		files = append(files, name)
+	}
+
+	result.Files += len(files)
+	return files, nil
+}
+
+// addFile adds an open file to the archive from its start
+func addFile(archive archiveWriter, name string, modTime time.Time, f *os.File) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return archive.add(name, modTime, info.Size(), f)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
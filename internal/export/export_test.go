@@ -0,0 +1,277 @@
+package export
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/parser"
+)
+
+const exportGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="52.0000" lon="4.0000"><ele>10</ele><time>2024-05-01T07:30:00Z</time></trkpt>
+<trkpt lat="52.0010" lon="4.0000"><ele>12</ele><time>2024-05-01T07:31:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+
+// exportActivities returns three downloaded GPX activities a day apart;
+// activity 2's file is missing
+func exportActivities(t *testing.T) []database.Activity {
+	t.Helper()
+	dir := t.TempDir()
+	start := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	var activities []database.Activity
+	for id := 1; id <= 3; id++ {
+		filename := filepath.Join(dir, fmt.Sprintf("%d.gpx", id))
+		if id != 2 {
+			if err := os.WriteFile(filename, []byte(exportGPX), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		activities = append(activities, database.Activity{
+			ActivityID:   id,
+			ActivityName: fmt.Sprintf("Run %d", id),
+			ActivityType: "running",
+			StartTime:    start.Add(time.Duration(id) * 24 * time.Hour),
+			Filename:     filename,
+			FileType:     "gpx",
+			Downloaded:   true,
+		})
+	}
+	return activities
+}
+
+// readArchive returns the contents of a ZIP or tar.gz archive by file name
+func readArchive(t *testing.T, archive string, data []byte) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	if archive == ArchiveZip {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("reading the zip archive: %v", err)
+		}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("reading %s: %v", f.Name, err)
+			}
+			files[f.Name] = string(content)
+		}
+		return files
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("reading the tar.gz archive: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading the tar.gz archive: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("reading %s: %v", header.Name, err)
+		}
+		files[header.Name] = string(content)
+	}
+	return files
+}
+
+type testManifest struct {
+	Activities []struct {
+		ActivityID int      `json:"activity_id"`
+		Files      []string `json:"files"`
+	} `json:"activities"`
+	Errors     []string `json:"errors"`
+	NextCursor string   `json:"next_cursor"`
+}
+
+func writeArchive(t *testing.T, e *Exporter, opts Options) (*Result, map[string]string, testManifest) {
+	t.Helper()
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	var buf bytes.Buffer
+	result, err := e.Write(context.Background(), &buf, opts)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	files := readArchive(t, opts.Archive, buf.Bytes())
+	var manifest testManifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &manifest); err != nil {
+		t.Fatalf("manifest.json: %v\n%s", err, files["manifest.json"])
+	}
+	return result, files, manifest
+}
+
+func TestWrite(t *testing.T) {
+	for _, archive := range []string{ArchiveZip, ArchiveTarGz} {
+		t.Run(archive, func(t *testing.T) {
+			e := newTestExporter(t, exportActivities(t)...)
+			result, files, manifest := writeArchive(t, e, Options{Formats: []string{FormatOriginal, "tcx"}, Archive: archive})
+
+			if result.Activities != 3 || result.Files != 4 || len(result.Errors) != 2 || result.NextCursor != "" {
+				t.Errorf("result = %+v, want 3 activities, 4 files and activity 2's errors", result)
+			}
+			for _, err := range result.Errors {
+				if !strings.HasPrefix(err, "activity 2 ") {
+					t.Errorf("error %q, want only activity 2 to fail", err)
+				}
+			}
+
+			// Stored files go in as they are, converted ones parse back
+			if len(files) != 6 {
+				t.Errorf("archive holds %d files, want 4 activity files and 2 manifests", len(files))
+			}
+			for _, id := range []int{1, 3} {
+				if got := files[fmt.Sprintf("activities/%d.gpx", id)]; got != exportGPX {
+					t.Errorf("activities/%d.gpx = %q, want the stored file", id, got)
+				}
+				tcx := files[fmt.Sprintf("activities/%d.tcx", id)]
+				if metrics, err := parser.NewParser().ParseTCX([]byte(tcx)); err != nil || metrics.Duration != time.Minute {
+					t.Errorf("activities/%d.tcx does not parse back to the activity: %v", id, err)
+				}
+			}
+
+			// Both manifests list every activity, including the failed one
+			if len(manifest.Activities) != 3 || len(manifest.Errors) != 2 || manifest.NextCursor != "" {
+				t.Fatalf("manifest.json = %+v, want 3 activities and 2 errors", manifest)
+			}
+			for i, want := range []struct {
+				id    int
+				files []string
+			}{
+				{3, []string{"activities/3.gpx", "activities/3.tcx"}},
+				{2, []string{}},
+				{1, []string{"activities/1.gpx", "activities/1.tcx"}},
+			} {
+				got := manifest.Activities[i]
+				if got.ActivityID != want.id || strings.Join(got.Files, ";") != strings.Join(want.files, ";") {
+					t.Errorf("manifest.json activity %d = %+v, want %d with %v", i, got, want.id, want.files)
+				}
+			}
+
+			rows, err := csv.NewReader(strings.NewReader(files["manifest.csv"])).ReadAll()
+			if err != nil {
+				t.Fatalf("manifest.csv: %v", err)
+			}
+			if len(rows) != 4 || rows[0][1] != "activity_id" || rows[0][len(rows[0])-1] != "files" {
+				t.Fatalf("manifest.csv = %v, want a header and 3 rows", rows)
+			}
+			for i, want := range []string{"activities/3.gpx;activities/3.tcx", "", "activities/1.gpx;activities/1.tcx"} {
+				if got := rows[i+1][len(rows[i+1])-1]; got != want {
+					t.Errorf("manifest.csv row %d files = %q, want %q", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteResumesFromCursor(t *testing.T) {
+	e := newTestExporter(t, exportActivities(t)...)
+	opts := Options{Archive: ArchiveTarGz, Limit: 2}
+
+	result, files, manifest := writeArchive(t, e, opts)
+	if result.Activities != 2 || result.NextCursor == "" || manifest.NextCursor != result.NextCursor {
+		t.Fatalf("first chunk = %+v with manifest cursor %q, want 2 activities and a next cursor", result, manifest.NextCursor)
+	}
+	if len(manifest.Activities) != 2 || manifest.Activities[0].ActivityID != 3 || manifest.Activities[1].ActivityID != 2 {
+		t.Errorf("first chunk = %+v, want activities 3 and 2", manifest.Activities)
+	}
+	if _, ok := files["activities/1.gpx"]; ok {
+		t.Errorf("first chunk holds activity 1, past its limit")
+	}
+
+	opts.Cursor = result.NextCursor
+	result, files, manifest = writeArchive(t, e, opts)
+	if result.Activities != 1 || result.NextCursor != "" || manifest.NextCursor != "" {
+		t.Errorf("second chunk = %+v, want the last activity and no next cursor", result)
+	}
+	if len(manifest.Activities) != 1 || manifest.Activities[0].ActivityID != 1 || files["activities/1.gpx"] != exportGPX {
+		t.Errorf("second chunk = %+v, want activity 1", manifest.Activities)
+	}
+}
+
+// failingArchive fails every add
+type failingArchive struct{ adds int }
+
+func (a *failingArchive) add(name string, modTime time.Time, size int64, r io.Reader) error {
+	a.adds++
+	return io.ErrShortWrite
+}
+
+func (a *failingArchive) Close() error { return nil }
+
+func TestWriteActivityArchiveErrors(t *testing.T) {
+	activities := exportActivities(t)
+	e := newTestExporter(t)
+
+	tests := []struct {
+		name     string
+		activity database.Activity
+		formats  []string
+		fatal    bool
+	}{
+		// Unreadable sources only fail the activity
+		{"missing file", activities[1], []string{FormatOriginal, "tcx"}, false},
+		// The archive is left mid-entry, so the export is aborted
+		{"stored file", activities[0], []string{FormatOriginal, "tcx"}, true},
+		{"converted file", activities[2], []string{"tcx"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := &failingArchive{}
+			result := &Result{}
+			files, err := e.writeActivity(archive, &tt.activity, tt.formats, result)
+			if tt.fatal && (!errors.Is(err, io.ErrShortWrite) || len(result.Errors) != 0 || archive.adds != 1) {
+				t.Errorf("writeActivity = %v with errors %v after %d adds, want the archive error at once",
+					err, result.Errors, archive.adds)
+			}
+			if !tt.fatal && (err != nil || len(files) != 0 || len(result.Errors) != 2) {
+				t.Errorf("writeActivity = %v, %v with errors %v; want both formats failed", files, err, result.Errors)
+			}
+		})
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestWriteFailingWriter(t *testing.T) {
+	e := newTestExporter(t, exportActivities(t)...)
+	for _, archive := range []string{ArchiveZip, ArchiveTarGz} {
+		opts := Options{Archive: archive}
+		if err := opts.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if result, err := e.Write(context.Background(), errWriter{}, opts); !errors.Is(err, io.ErrClosedPipe) || result != nil {
+			t.Errorf("%s: Write = %+v, %v; want the writer's error", archive, result, err)
+		}
+	}
+}
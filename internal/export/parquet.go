@@ -0,0 +1,446 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/models"
+	"github.com/sstent/garminsync-go/internal/parquet"
+	"github.com/sstent/garminsync-go/internal/parser"
+)
+
+// Parquet datasets, each written to its own subdirectory
+const (
+	DatasetActivities = "activities" // one row per activity summary
+	DatasetLaps       = "laps"       // one row per lap
+	DatasetRecords    = "records"    // one row per record of the activity file, usually every second
+)
+
+var datasets = []string{DatasetActivities, DatasetLaps, DatasetRecords}
+
+// defaultPartition names the partition of activities without a type, as
+// Hive does for null partition values
+const defaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// maxParquetErrors caps the errors kept in a ParquetResult
+const maxParquetErrors = 100
+
+// ParquetOptions configures a Parquet export
+type ParquetOptions struct {
+	// Dir receives one subdirectory per dataset. Only those subdirectories
+	// are replaced; other files in Dir are left alone.
+	Dir string
+
+	// Datasets lists the datasets to write; empty means all of them
+	Datasets []string
+}
+
+// Validate checks the options and fills in defaults
+func (o *ParquetOptions) Validate() error {
+	if o.Dir == "" {
+		return fmt.Errorf("%w: an output directory is required", ErrInvalidOptions)
+	}
+	if len(o.Datasets) == 0 {
+		o.Datasets = datasets
+	}
+	return ValidateDatasets(o.Datasets)
+}
+
+// ValidateDatasets checks that every name is a Parquet dataset
+func ValidateDatasets(names []string) error {
+	for _, name := range names {
+		if !containsString(datasets, name) {
+			return fmt.Errorf("%w: unknown dataset %q", ErrInvalidOptions, name)
+		}
+	}
+	return nil
+}
+
+// ParquetResult summarises a Parquet export
+type ParquetResult struct {
+	Dir        string    `json:"dir"`
+	Datasets   []string  `json:"datasets"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Activities int       `json:"activities"`
+	Laps       int       `json:"laps"`
+	Records    int       `json:"records"`
+	Files      int       `json:"files"`
+	Failed     int       `json:"failed"`
+	Errors     []string  `json:"errors"`
+}
+
+func (r *ParquetResult) fail(activity *database.Activity, err error) {
+	r.Failed++
+	if len(r.Errors) < maxParquetErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf("activity %d: %v", activity.ActivityID, err))
+	}
+}
+
+// WriteParquet writes the selected datasets as Parquet files partitioned
+// Hive-style by the year the activity started in and its type:
+//
+//	<dir>/<dataset>/year=2024/activity_type=running/part-0.parquet
+//
+// The year is that of the UTC start time recorded in the activity file, or
+// of Garmin's local start_time for activities without one. DuckDB
+// (read_parquet with hive_partitioning) and Spark add year and
+// activity_type back as columns. Laps come from the database; records are
+// parsed from the stored activity files, so activities without a file have
+// none.
+//
+// The datasets are built in a staging directory inside dir and swapped in
+// together once all are complete. If any of them cannot be swapped in, the
+// ones already moved are put back, so dir holds either the previous export
+// of every selected dataset or the new one. Activities whose files fail to
+// parse are reported in the result without failing the export.
+func (e *Exporter) WriteParquet(ctx context.Context, opts ParquetOptions) (*ParquetResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	result := &ParquetResult{Dir: opts.Dir, Datasets: opts.Datasets, StartedAt: time.Now(), Errors: []string{}}
+
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	stage, err := os.MkdirTemp(opts.Dir, ".staging-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+	for _, dataset := range opts.Datasets {
+		if err := os.Mkdir(filepath.Join(stage, dataset), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	years, err := e.db.ActivityYears()
+	if err != nil {
+		return nil, err
+	}
+	p := &parquetExport{
+		db:      e.db,
+		stage:   stage,
+		result:  result,
+		parser:  parser.NewParser(),
+		writers: make(map[string]*partitionWriter),
+	}
+	for _, dataset := range opts.Datasets {
+		p.writers[dataset] = nil
+	}
+	defer p.abort()
+
+	for _, year := range years {
+		filters := database.ActivityFilters{
+			Year:      year,
+			SortBy:    "activity_type",
+			SortOrder: "asc",
+		}
+
+		// Sorting by type keeps each partition's rows together, so only
+		// one file per dataset is open at a time
+		err := e.db.EachActivity(filters, func(activity *database.Activity) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return p.add(year, activity)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := p.closePartition(); err != nil {
+		return nil, err
+	}
+
+	if err := swapDatasets(stage, opts.Dir, opts.Datasets); err != nil {
+		return nil, err
+	}
+	result.FinishedAt = time.Now()
+	return result, nil
+}
+
+// swapDatasets replaces the datasets in dir with those built in stage,
+// moving the previous ones into stage. On failure every rename already
+// done is undone, so the datasets in dir stay those of one export.
+func swapDatasets(stage, dir string, names []string) error {
+	type rename struct{ from, to string }
+	var done []rename
+	move := func(from, to string) error {
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		done = append(done, rename{from, to})
+		return nil
+	}
+
+	var err error
+	for _, name := range names {
+		dst := filepath.Join(dir, name)
+		if err = move(dst, filepath.Join(stage, "old-"+name)); err != nil && !os.IsNotExist(err) {
+			break
+		}
+		if err = move(filepath.Join(stage, name), dst); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	for i := len(done) - 1; i >= 0; i-- {
+		os.Rename(done[i].to, done[i].from)
+	}
+	return err
+}
+
+// parquetExport is the state of a running WriteParquet
+type parquetExport struct {
+	db     *database.SQLiteDB
+	stage  string
+	result *ParquetResult
+	parser *parser.Parser
+
+	// partition is the year and activity type being written, and writers
+	// the open file of each selected dataset in it, opened on first row
+	partition string
+	writers   map[string]*partitionWriter
+}
+
+func (p *parquetExport) add(year int, activity *database.Activity) error {
+	activityType := activity.ActivityType
+	if activityType == "" {
+		activityType = defaultPartition
+	}
+	partition := filepath.Join("year="+strconv.Itoa(year), "activity_type="+url.PathEscape(activityType))
+	if partition != p.partition {
+		if err := p.closePartition(); err != nil {
+			return err
+		}
+		p.partition = partition
+	}
+
+	if _, ok := p.writers[DatasetActivities]; ok {
+		w, err := p.writer(DatasetActivities)
+		if err != nil {
+			return err
+		}
+		if err := w.Write(activityRow(activity)...); err != nil {
+			return err
+		}
+		p.result.Activities++
+	}
+
+	if _, ok := p.writers[DatasetLaps]; ok {
+		laps, err := p.db.GetActivityLaps(activity.ActivityID)
+		if err != nil {
+			return err
+		}
+		for i := range laps {
+			w, err := p.writer(DatasetLaps)
+			if err != nil {
+				return err
+			}
+			if err := w.Write(lapRow(&laps[i])...); err != nil {
+				return err
+			}
+		}
+		p.result.Laps += len(laps)
+	}
+
+	if _, ok := p.writers[DatasetRecords]; ok && activity.Downloaded && activity.Filename != "" {
+		metrics, err := p.parser.ParseFile(activity.Filename)
+		if err != nil {
+			p.result.fail(activity, err)
+			return nil
+		}
+		for i := range metrics.Records {
+			w, err := p.writer(DatasetRecords)
+			if err != nil {
+				return err
+			}
+			if err := w.Write(recordRow(activity.ActivityID, &metrics.Records[i])...); err != nil {
+				return err
+			}
+		}
+		p.result.Records += len(metrics.Records)
+	}
+	return nil
+}
+
+// writer returns the open file of a dataset in the current partition
+func (p *parquetExport) writer(dataset string) (*parquet.Writer, error) {
+	if w := p.writers[dataset]; w != nil {
+		return w.pw, nil
+	}
+
+	dir := filepath.Join(p.stage, dataset, p.partition)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(dir, "part-0.parquet"))
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(f)
+	w := &partitionWriter{file: f, buf: bw, pw: parquet.NewWriter(bw, datasetColumns[dataset])}
+	p.writers[dataset] = w
+	p.result.Files++
+	return w.pw, nil
+}
+
+// closePartition finishes the files of the current partition
+func (p *parquetExport) closePartition() error {
+	for dataset, w := range p.writers {
+		if w == nil {
+			continue
+		}
+		p.writers[dataset] = nil
+		if err := w.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abort closes any files left open by a failed export
+func (p *parquetExport) abort() {
+	for _, w := range p.writers {
+		if w != nil {
+			w.file.Close()
+		}
+	}
+}
+
+type partitionWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+	pw   *parquet.Writer
+}
+
+func (w *partitionWriter) close() error {
+	err := w.pw.Close()
+	if err == nil {
+		err = w.buf.Flush()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// datasetColumns are the Parquet columns of each dataset. activity_type is
+// left out: it is a partition key.
+var datasetColumns = map[string][]parquet.Column{
+	DatasetActivities: activityParquetColumns(),
+	DatasetLaps: {
+		{Name: "activity_id", Type: parquet.Int64},
+		{Name: "lap_index", Type: parquet.Int32},
+		{Name: "start_time", Type: parquet.Timestamp, Optional: true},
+		{Name: "duration", Type: parquet.Double},
+		{Name: "distance", Type: parquet.Double},
+		{Name: "avg_speed", Type: parquet.Double},
+		{Name: "max_speed", Type: parquet.Double},
+		{Name: "avg_heart_rate", Type: parquet.Int32},
+		{Name: "max_heart_rate", Type: parquet.Int32},
+		{Name: "avg_cadence", Type: parquet.Int32},
+		{Name: "max_cadence", Type: parquet.Int32},
+		{Name: "avg_power", Type: parquet.Int32},
+		{Name: "max_power", Type: parquet.Int32},
+		{Name: "calories", Type: parquet.Int32},
+		{Name: "elevation_gain", Type: parquet.Double},
+		{Name: "elevation_loss", Type: parquet.Double},
+	},
+	DatasetRecords: {
+		{Name: "activity_id", Type: parquet.Int64},
+		{Name: "time", Type: parquet.Timestamp, Optional: true},
+		{Name: "latitude", Type: parquet.Double, Optional: true},
+		{Name: "longitude", Type: parquet.Double, Optional: true},
+		{Name: "altitude", Type: parquet.Double, Optional: true},
+		{Name: "distance", Type: parquet.Double},
+		{Name: "speed", Type: parquet.Double},
+		{Name: "heart_rate", Type: parquet.Int32},
+		{Name: "cadence", Type: parquet.Int32},
+		{Name: "power", Type: parquet.Int32},
+		{Name: "temperature", Type: parquet.Double, Optional: true},
+	},
+}
+
+// activityParquetColumns maps the summary columns to Parquet columns by the
+// type of their values. Times are optional, as unset times are written as
+// nulls.
+func activityParquetColumns() []parquet.Column {
+	var columns []parquet.Column
+	for _, col := range activityColumns {
+		if col.name == "activity_type" {
+			continue
+		}
+		pc := parquet.Column{Name: col.name}
+		switch col.value(&database.Activity{}, UnitsMetric).(type) {
+		case int, int64:
+			pc.Type = parquet.Int64
+		case float64:
+			pc.Type = parquet.Double
+		case bool:
+			pc.Type = parquet.Boolean
+		case string:
+			pc.Type = parquet.String
+		case time.Time, *time.Time:
+			pc.Type, pc.Optional = parquet.Timestamp, true
+		}
+		columns = append(columns, pc)
+	}
+	return columns
+}
+
+func activityRow(a *database.Activity) []interface{} {
+	row := make([]interface{}, 0, len(activityColumns)-1)
+	for _, col := range activityColumns {
+		if col.name == "activity_type" {
+			continue
+		}
+		row = append(row, nullTime(col.value(a, UnitsMetric)))
+	}
+	return row
+}
+
+func lapRow(lap *database.Lap) []interface{} {
+	return []interface{}{
+		lap.ActivityID, lap.Index, nullTime(lap.StartTime), lap.Duration, lap.Distance,
+		lap.AvgSpeed, lap.MaxSpeed, lap.AvgHeartRate, lap.MaxHeartRate,
+		lap.AvgCadence, lap.MaxCadence, lap.AvgPower, lap.MaxPower, lap.Calories,
+		lap.ElevationGain, lap.ElevationLoss,
+	}
+}
+
+func recordRow(activityID int, r *models.Record) []interface{} {
+	var latitude, longitude, altitude, temperature interface{}
+	if r.HasPosition {
+		latitude, longitude = r.Latitude, r.Longitude
+	}
+	if r.HasAltitude {
+		altitude = r.Altitude
+	}
+	if r.HasTemperature {
+		temperature = r.Temperature
+	}
+	return []interface{}{
+		activityID, nullTime(r.Time), latitude, longitude, altitude,
+		r.Distance, r.Speed, r.HeartRate, r.Cadence, r.Power, temperature,
+	}
+}
+
+// nullTime turns zero times into nulls and leaves other values alone
+func nullTime(v interface{}) interface{} {
+	if t, ok := v.(time.Time); ok && t.IsZero() {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+func TestWriteParquetPartitions(t *testing.T) {
+	// Garmin's start_time is local; the evening run in New York started
+	// in 2024 by the UTC time recorded in its file
+	fileStart := time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)
+	e := newTestExporter(t,
+		database.Activity{
+			ActivityID:    1,
+			StartTime:     time.Date(2023, 12, 31, 19, 30, 0, 0, time.UTC),
+			FileStartTime: &fileStart,
+			ActivityType:  "running",
+			Filename:      "activities/1.fit",
+		},
+		database.Activity{
+			ActivityID:   2,
+			StartTime:    time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC),
+			ActivityType: "running",
+			Filename:     "activities/2.fit",
+		},
+		database.Activity{
+			ActivityID: 3,
+			StartTime:  time.Date(2023, 6, 2, 8, 0, 0, 0, time.UTC),
+			Filename:   "activities/3.fit",
+		},
+	)
+
+	dir := t.TempDir()
+	other := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(other, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second run replaces the datasets of the first
+	for run := 0; run < 2; run++ {
+		result, err := e.WriteParquet(context.Background(), ParquetOptions{Dir: dir})
+		if err != nil {
+			t.Fatalf("WriteParquet: %v", err)
+		}
+		if result.Activities != 3 || result.Files != 3 {
+			t.Errorf("run %d: %d activities in %d files, want 3 in 3", run, result.Activities, result.Files)
+		}
+	}
+
+	want := []string{
+		"activities/year=2023/activity_type=__HIVE_DEFAULT_PARTITION__/part-0.parquet",
+		"activities/year=2023/activity_type=running/part-0.parquet",
+		"activities/year=2024/activity_type=running/part-0.parquet",
+		"notes.txt",
+	}
+	if got := listFiles(t, dir); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("files =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSwapDatasetsRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	stage := filepath.Join(dir, ".staging-test")
+	for _, path := range []string{
+		filepath.Join(dir, DatasetActivities, "old"),
+		filepath.Join(dir, DatasetLaps, "old"),
+		filepath.Join(stage, DatasetActivities, "new"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The staged laps dataset is missing, so its swap fails after the
+	// activities dataset was already swapped in
+	if err := swapDatasets(stage, dir, []string{DatasetActivities, DatasetLaps}); err == nil {
+		t.Fatal("swapDatasets succeeded without a staged laps dataset")
+	}
+
+	want := []string{
+		".staging-test/activities/new",
+		"activities/old",
+		"laps/old",
+	}
+	if got := listFiles(t, dir); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("files =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// listFiles returns the sorted slash-separated paths of the files under dir
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
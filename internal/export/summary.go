@@ -0,0 +1,130 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+// Summary formats
+const (
+	SummaryCSV   = "csv"
+	SummaryJSONL = "jsonl"
+)
+
+// SummaryOptions selects the activities and fields of a summary export
+type SummaryOptions struct {
+	// Filters are applied as by database.FilterActivities
+	Filters database.ActivityFilters
+
+	// Columns lists the fields written, in order; empty means all of them.
+	// See ColumnNames.
+	Columns []string
+
+	// Units is UnitsMetric (default) or UnitsImperial
+	Units string
+}
+
+// Validate checks the options and fills in defaults
+func (o *SummaryOptions) Validate() error {
+	switch o.Units {
+	case "":
+		o.Units = UnitsMetric
+	case UnitsMetric, UnitsImperial:
+	default:
+		return fmt.Errorf("%w: units must be %s or %s", ErrInvalidOptions, UnitsMetric, UnitsImperial)
+	}
+	if err := o.Filters.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidOptions, err)
+	}
+	_, err := selectColumns(o.Columns)
+	return err
+}
+
+// SummaryContentType returns the MIME type of a summary format
+func SummaryContentType(format string) string {
+	if format == SummaryJSONL {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// WriteSummaries streams one row per matching activity to w as CSV, with a
+// header row, or as JSON Lines, and returns the number of rows. Rows are
+// written as they are read from the database.
+func (e *Exporter) WriteSummaries(ctx context.Context, w io.Writer, format string, opts SummaryOptions) (int, error) {
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+	columns, _ := selectColumns(opts.Columns)
+
+	var writeRow func(a *database.Activity) error
+	var flush func() error
+	switch format {
+	case SummaryCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader(columns))
+		writeRow = func(a *database.Activity) error {
+			return cw.Write(csvRow(a, columns, opts.Units))
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case SummaryJSONL:
+		bw := bufio.NewWriter(w)
+		writeRow = func(a *database.Activity) error {
+			line, err := json.Marshal(jsonRow{a: a, columns: columns, units: opts.Units})
+			if err != nil {
+				return err
+			}
+			bw.Write(line)
+			return bw.WriteByte('\n')
+		}
+		flush = bw.Flush
+	default:
+		return 0, fmt.Errorf("%w: format must be %s or %s", ErrInvalidOptions, SummaryCSV, SummaryJSONL)
+	}
+
+	rows := 0
+	err := e.db.EachActivity(opts.Filters, func(a *database.Activity) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows++
+		return writeRow(a)
+	})
+	if err != nil {
+		return rows, err
+	}
+	return rows, flush()
+}
+
+// jsonRow marshals the selected columns of an activity as a JSON object,
+// keeping the column order
+type jsonRow struct {
+	a       *database.Activity
+	columns []column
+	units   string
+}
+
+func (r jsonRow) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, col := range r.columns {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		key, _ := json.Marshal(col.name)
+		value, err := json.Marshal(col.value(r.a, r.units))
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, key...), ':'), value...)
+	}
+	return append(buf, '}'), nil
+}
@@ -0,0 +1,139 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestExporter(t *testing.T, activities ...database.Activity) *Exporter {
+	t.Helper()
+	db, err := database.NewSQLiteDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for i := range activities {
+		if _, err := db.UpsertActivity(&activities[i]); err != nil {
+			t.Fatalf("UpsertActivity: %v", err)
+		}
+	}
+	return New(db)
+}
+
+func summaryActivities() []database.Activity {
+	return []database.Activity{
+		{
+			ActivityID:    1,
+			ActivityName:  "Morning Run",
+			StartTime:     time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC),
+			ActivityType:  "running",
+			Distance:      10000,
+			ElevationGain: 120,
+			Filename:      "activities/1.fit",
+			Downloaded:    true,
+		},
+		{
+			ActivityID:    2,
+			ActivityName:  "Ride, \"long\"",
+			StartTime:     time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC),
+			ActivityType:  "cycling",
+			Distance:      1609.344,
+			ElevationGain: 30.48,
+			Filename:      "activities/2.fit",
+		},
+	}
+}
+
+func TestWriteSummaries(t *testing.T) {
+	e := newTestExporter(t, summaryActivities()...)
+	columns := []string{"activity_id", "activity_name", "start_time", "distance", "elevation_gain", "downloaded", "downloaded_at"}
+	ascending := database.ActivityFilters{SortBy: "start_time", SortOrder: "asc"}
+
+	tests := []struct {
+		name   string
+		format string
+		units  string
+		want   string
+	}{
+		{
+			name:   "csv metric",
+			format: SummaryCSV,
+			want: "activity_id,activity_name,start_time,distance,elevation_gain,downloaded,downloaded_at\n" +
+				"1,Morning Run,2024-05-01T07:30:00Z,10000,120,true,\n" +
+				"2,\"Ride, \"\"long\"\"\",2024-05-02T09:00:00Z,1609.344,30.48,false,\n",
+		},
+		{
+			name:   "csv imperial",
+			format: SummaryCSV,
+			units:  UnitsImperial,
+			want: "activity_id,activity_name,start_time,distance,elevation_gain,downloaded,downloaded_at\n" +
+				"1,Morning Run,2024-05-01T07:30:00Z,6.214,393.7,true,\n" +
+				"2,\"Ride, \"\"long\"\"\",2024-05-02T09:00:00Z,1,100,false,\n",
+		},
+		{
+			name:   "jsonl imperial",
+			format: SummaryJSONL,
+			units:  UnitsImperial,
+			want: `{"activity_id":1,"activity_name":"Morning Run","start_time":"2024-05-01T07:30:00Z","distance":6.214,"elevation_gain":393.7,"downloaded":true,"downloaded_at":null}` + "\n" +
+				`{"activity_id":2,"activity_name":"Ride, \"long\"","start_time":"2024-05-02T09:00:00Z","distance":1,"elevation_gain":100,"downloaded":false,"downloaded_at":null}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rows, err := e.WriteSummaries(context.Background(), &buf, tt.format,
+				SummaryOptions{Filters: ascending, Columns: columns, Units: tt.units})
+			if err != nil {
+				t.Fatalf("WriteSummaries: %v", err)
+			}
+			if rows != 2 {
+				t.Errorf("rows = %d, want 2", rows)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteSummariesInvalidOptions(t *testing.T) {
+	e := newTestExporter(t)
+	tests := []struct {
+		name   string
+		format string
+		opts   SummaryOptions
+	}{
+		{"unknown format", "xlsx", SummaryOptions{}},
+		{"unknown units", SummaryCSV, SummaryOptions{Units: "nautical"}},
+		{"unknown column", SummaryJSONL, SummaryOptions{Columns: []string{"pace"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := e.WriteSummaries(context.Background(), &buf, tt.format, tt.opts); !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("WriteSummaries error = %v, want ErrInvalidOptions", err)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("wrote %q before rejecting the options", buf.String())
+			}
+		})
+	}
+}
+
+func TestSummaryOptionsDefaultUnits(t *testing.T) {
+	opts := SummaryOptions{}
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if opts.Units != UnitsMetric {
+		t.Errorf("Units = %q, want %q", opts.Units, UnitsMetric)
+	}
+}
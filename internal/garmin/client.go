@@ -8,6 +8,7 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -27,6 +28,11 @@ func NewClient() *Client {
 	}
 }
 
+// SetBaseURL points the client at another garmin-api instance
+func (c *Client) SetBaseURL(baseURL string) {
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
 type GarminActivity struct {
 	ActivityID       int                    `json:"activityId"`
 	ActivityName     string                 `json:"activityName"`
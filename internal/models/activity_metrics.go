@@ -4,7 +4,9 @@ import "time"
 
 // ActivityMetrics contains all metrics extracted from activity files
 type ActivityMetrics struct {
+	Name           string // only GPX files carry a name
 	ActivityType   string
+	DeviceSerial   string // serial number of the recording device, if known
 	StartTime      time.Time
 	Duration       time.Duration
 	Distance       float64 // in meters
@@ -18,4 +20,44 @@ type ActivityMetrics struct {
 	MinTemperature float64 // in °C
 	MaxTemperature float64 // in °C
 	AvgTemperature float64 // in °C
+	Laps           []Lap
+	Records        []Record // per-sample data streams, in time order
+}
+
+// Record is one sample of an activity's data streams, usually one per
+// second. Fields the file did not record are zero; the Has flags tell
+// recorded zeros apart.
+type Record struct {
+	Time           time.Time
+	Latitude       float64 // in degrees
+	Longitude      float64 // in degrees
+	HasPosition    bool
+	Altitude       float64 // in meters
+	HasAltitude    bool
+	Distance       float64 // cumulative, in meters
+	Speed          float64 // in m/s
+	HeartRate      int
+	Cadence        int
+	Power          int
+	Temperature    float64 // in °C
+	HasTemperature bool
+}
+
+// Lap holds the summary of one lap of an activity
+type Lap struct {
+	Index         int
+	StartTime     time.Time
+	Duration      time.Duration // timer time, excluding pauses
+	Distance      float64       // in meters
+	AvgSpeed      float64       // in m/s
+	MaxSpeed      float64       // in m/s
+	AvgHeartRate  int
+	MaxHeartRate  int
+	AvgCadence    int
+	MaxCadence    int
+	AvgPower      int
+	MaxPower      int
+	Calories      int
+	ElevationGain float64 // in meters
+	ElevationLoss float64 // in meters
 }
@@ -0,0 +1,93 @@
+package parquet
+
+import "encoding/binary"
+
+// Thrift compact protocol type IDs
+const (
+	compactTrue   = 1
+	compactFalse  = 2
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter encodes Thrift structs with the compact protocol, which
+// Parquet uses for page headers and the file footer. Only the parts the
+// writer needs are implemented.
+type compactWriter struct {
+	buf  []byte
+	last []int16 // last field ID written in each open struct
+}
+
+func (w *compactWriter) beginStruct() {
+	w.last = append(w.last, 0)
+}
+
+func (w *compactWriter) endStruct() {
+	w.buf = append(w.buf, 0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *compactWriter) fieldHeader(id int16, typ byte) {
+	top := len(w.last) - 1
+	if delta := id - w.last[top]; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.varint(int64(id))
+	}
+	w.last[top] = id
+}
+
+func (w *compactWriter) varint(v int64) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(v<<1^v>>63))
+}
+
+func (w *compactWriter) binary(b []byte) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *compactWriter) i32(id int16, v int32) {
+	w.fieldHeader(id, compactI32)
+	w.varint(int64(v))
+}
+
+func (w *compactWriter) i64(id int16, v int64) {
+	w.fieldHeader(id, compactI64)
+	w.varint(v)
+}
+
+func (w *compactWriter) bool(id int16, v bool) {
+	if v {
+		w.fieldHeader(id, compactTrue)
+	} else {
+		w.fieldHeader(id, compactFalse)
+	}
+}
+
+func (w *compactWriter) string(id int16, s string) {
+	w.fieldHeader(id, compactBinary)
+	w.binary([]byte(s))
+}
+
+// structField starts a nested struct field; close it with endStruct
+func (w *compactWriter) structField(id int16) {
+	w.fieldHeader(id, compactStruct)
+	w.beginStruct()
+}
+
+// listField starts a list field of n elements. Struct elements are written
+// with beginStruct and endStruct, other elements with their element
+// method.
+func (w *compactWriter) listField(id int16, elem byte, n int) {
+	w.fieldHeader(id, compactList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|elem)
+	} else {
+		w.buf = append(w.buf, 0xf0|elem)
+		w.buf = binary.AppendUvarint(w.buf, uint64(n))
+	}
+}
@@ -0,0 +1,164 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestCompactWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *compactWriter)
+		want  []byte
+	}{
+		{
+			name:  "short field header",
+			write: func(w *compactWriter) { w.i32(1, 3); w.i64(3, -1) },
+			want:  []byte{0x15, 0x06, 0x26, 0x01, 0x00},
+		},
+		{
+			name:  "long field header",
+			write: func(w *compactWriter) { w.i32(20, 1) },
+			want:  []byte{0x05, 0x28, 0x02, 0x00},
+		},
+		{
+			name:  "decreasing field id",
+			write: func(w *compactWriter) { w.i32(5, 0); w.i32(2, 0) },
+			want:  []byte{0x55, 0x00, 0x05, 0x04, 0x00, 0x00},
+		},
+		{
+			name:  "booleans",
+			write: func(w *compactWriter) { w.bool(1, true); w.bool(2, false) },
+			want:  []byte{0x11, 0x12, 0x00},
+		},
+		{
+			name:  "string",
+			write: func(w *compactWriter) { w.string(4, "ab") },
+			want:  []byte{0x48, 0x02, 'a', 'b', 0x00},
+		},
+		{
+			name: "nested struct restarts field ids",
+			write: func(w *compactWriter) {
+				w.i32(2, 0)
+				w.structField(3)
+				w.i32(1, 0)
+				w.endStruct()
+				w.i32(4, 0)
+			},
+			want: []byte{0x25, 0x00, 0x1c, 0x15, 0x00, 0x00, 0x15, 0x00, 0x00},
+		},
+		{
+			name: "short list",
+			write: func(w *compactWriter) {
+				w.listField(1, compactI32, 2)
+				w.varint(1)
+				w.varint(-2)
+			},
+			want: []byte{0x19, 0x25, 0x02, 0x03, 0x00},
+		},
+		{
+			name: "long list",
+			write: func(w *compactWriter) {
+				w.listField(1, compactI32, 20)
+				for i := 0; i < 20; i++ {
+					w.varint(0)
+				}
+			},
+			want: append(append([]byte{0x19, 0xf5, 0x14}, make([]byte, 20)...), 0x00),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := compactWriter{}
+			w.beginStruct()
+			tt.write(&w)
+			w.endStruct()
+			if !bytes.Equal(w.buf, tt.want) {
+				t.Errorf("encoded % x, want % x", w.buf, tt.want)
+			}
+		})
+	}
+}
+
+// compactReader decodes Thrift compact structs into maps from field ID to
+// value, so tests can inspect what the writer produced. Integers decode as
+// int64, binaries as []byte, lists as []interface{} and structs as maps.
+type compactReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *compactReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		panic("compactReader: unexpected end of input")
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *compactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		panic("compactReader: bad varint")
+	}
+	r.pos += n
+	return v
+}
+
+func (r *compactReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *compactReader) readStruct() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.varint())
+		}
+		switch typ := header & 0x0f; typ {
+		case compactTrue:
+			fields[id] = true
+		case compactFalse:
+			fields[id] = false
+		default:
+			fields[id] = r.readValue(typ)
+		}
+		last = id
+	}
+}
+
+func (r *compactReader) readValue(typ byte) interface{} {
+	switch typ {
+	case compactI32, compactI64:
+		return r.varint()
+	case compactBinary:
+		n := int(r.uvarint())
+		b := r.buf[r.pos : r.pos+n]
+		r.pos += n
+		return b
+	case compactList:
+		header := r.byte()
+		n, elem := int(header>>4), header&0x0f
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.readValue(elem)
+		}
+		return list
+	case compactStruct:
+		return r.readStruct()
+	}
+	panic(fmt.Sprintf("compactReader: unsupported type %d", typ))
+}
@@ -0,0 +1,459 @@
+// Package parquet writes flat Apache Parquet files. It covers what the
+// activity exports need: a handful of column types, optional (nullable)
+// columns, plain encoding and gzip compression. Files are readable by
+// DuckDB, Spark, pandas and other Parquet readers.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is the type of a column's values
+type Type int
+
+const (
+	Boolean   Type = iota // bool
+	Int32                 // int or int32
+	Int64                 // int, int32 or int64
+	Double                // float64
+	String                // string, as UTF-8
+	Timestamp             // time.Time, stored as UTC milliseconds
+)
+
+// Column describes one column of a file
+type Column struct {
+	Name     string
+	Type     Type
+	Optional bool // values may be nil
+}
+
+// ErrClosed is returned when writing to a closed Writer
+var ErrClosed = errors.New("parquet: writer is closed")
+
+// DefaultRowGroupSize is the number of rows buffered before a row group is
+// written out
+const DefaultRowGroupSize = 65536
+
+// magic starts and ends every Parquet file
+const magic = "PAR1"
+
+// Parquet enum values from parquet.thrift
+const (
+	physicalBoolean   = 0
+	physicalInt32     = 1
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecGzip = 2
+
+	pageTypeData = 0
+)
+
+// Writer writes rows to a Parquet file. Rows are buffered in memory and
+// written a row group at a time; Close writes the last row group and the
+// footer.
+type Writer struct {
+	// RowGroupSize is the number of rows per row group; it defaults to
+	// DefaultRowGroupSize
+	RowGroupSize int
+
+	w         io.Writer
+	offset    int64
+	columns   []Column
+	buffers   []columnBuffer
+	rows      int
+	numRows   int64
+	rowGroups []rowGroup
+	err       error
+}
+
+// columnBuffer holds the values of one column in the current row group
+type columnBuffer struct {
+	values bytes.Buffer // plain-encoded values, nulls omitted
+	bools  []bool       // boolean values, bit-packed when the page is written
+	defs   []bool       // definition levels of an optional column: false for null
+}
+
+// columnChunk records where a column of a row group was written
+type columnChunk struct {
+	offset           int64
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type rowGroup struct {
+	chunks    []columnChunk
+	numRows   int64
+	totalSize int64
+}
+
+func NewWriter(w io.Writer, columns []Column) *Writer {
+	return &Writer{
+		w:       w,
+		columns: columns,
+		buffers: make([]columnBuffer, len(columns)),
+	}
+}
+
+// Write adds a row holding one value per column, in column order
+func (w *Writer) Write(row ...interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("parquet: row has %d values, want %d", len(row), len(w.columns))
+	}
+
+	// Check every value before buffering any, so a bad row leaves the
+	// buffers intact
+	for i, value := range row {
+		if err := checkValue(w.columns[i], value); err != nil {
+			return err
+		}
+	}
+	for i, value := range row {
+		w.buffers[i].add(w.columns[i], value)
+	}
+
+	w.rows++
+	size := w.RowGroupSize
+	if size <= 0 {
+		size = DefaultRowGroupSize
+	}
+	if w.rows >= size {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes any buffered rows and the file footer. It does not close
+// the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.rows > 0 || w.offset == 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+
+	footer := w.footer()
+	buf := append(footer, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(buf[len(footer):], uint32(len(footer)))
+	buf = append(buf, magic...)
+	if err := w.write(buf); err != nil {
+		return err
+	}
+	w.err = ErrClosed
+	return nil
+}
+
+func (w *Writer) write(p []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+// flush writes the buffered rows as a row group, one data page per column.
+// A file with no rows gets only its leading magic number.
+func (w *Writer) flush() error {
+	if w.offset == 0 {
+		if err := w.write([]byte(magic)); err != nil {
+			return err
+		}
+	}
+	if w.rows == 0 {
+		return nil
+	}
+
+	group := rowGroup{numRows: int64(w.rows)}
+	for i := range w.columns {
+		chunk, err := w.writePage(w.columns[i], &w.buffers[i])
+		if err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.totalSize += chunk.uncompressedSize
+		w.buffers[i] = columnBuffer{}
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.numRows += group.numRows
+	w.rows = 0
+	return nil
+}
+
+func (w *Writer) writePage(col Column, buf *columnBuffer) (columnChunk, error) {
+	var page bytes.Buffer
+	if col.Optional {
+		levels := encodeLevels(buf.defs)
+		binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+		page.Write(levels)
+	}
+	if col.Type == Boolean {
+		page.Write(packBools(buf.bools))
+	} else {
+		page.Write(buf.values.Bytes())
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(page.Bytes())
+	if err := gz.Close(); err != nil {
+		return columnChunk{}, err
+	}
+
+	header := pageHeader(w.rows, page.Len(), compressed.Len())
+	chunk := columnChunk{
+		offset:           w.offset,
+		numValues:        int64(w.rows),
+		uncompressedSize: int64(len(header) + page.Len()),
+		compressedSize:   int64(len(header) + compressed.Len()),
+	}
+	if err := w.write(header); err != nil {
+		return chunk, err
+	}
+	return chunk, w.write(compressed.Bytes())
+}
+
+// pageHeader encodes the PageHeader struct of a data page
+func pageHeader(numValues, uncompressedSize, compressedSize int) []byte {
+	header := compactWriter{}
+	header.beginStruct()
+	header.i32(1, pageTypeData)
+	header.i32(2, int32(uncompressedSize))
+	header.i32(3, int32(compressedSize))
+	header.structField(5)
+	header.i32(1, int32(numValues))
+	header.i32(2, encodingPlain)
+	header.i32(3, encodingRLE)
+	header.i32(4, encodingRLE)
+	header.endStruct()
+	header.endStruct()
+	return header.buf
+}
+
+// footer encodes the FileMetaData struct
+func (w *Writer) footer() []byte {
+	meta := compactWriter{}
+	meta.beginStruct()
+	meta.i32(1, 1)
+
+	// The schema is a root group followed by its leaf columns
+	meta.listField(2, compactStruct, len(w.columns)+1)
+	meta.beginStruct()
+	meta.string(4, "schema")
+	meta.i32(5, int32(len(w.columns)))
+	meta.endStruct()
+	for _, col := range w.columns {
+		writeSchemaElement(&meta, col)
+	}
+
+	meta.i64(3, w.numRows)
+	meta.listField(4, compactStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		meta.beginStruct()
+		meta.listField(1, compactStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			col := w.columns[i]
+			meta.beginStruct()
+			meta.i64(2, chunk.offset)
+			meta.structField(3)
+			meta.i32(1, physicalType(col.Type))
+			meta.listField(2, compactI32, 2)
+			meta.varint(encodingPlain)
+			meta.varint(encodingRLE)
+			meta.listField(3, compactBinary, 1)
+			meta.binary([]byte(col.Name))
+			meta.i32(4, codecGzip)
+			meta.i64(5, chunk.numValues)
+			meta.i64(6, chunk.uncompressedSize)
+			meta.i64(7, chunk.compressedSize)
+			meta.i64(9, chunk.offset)
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.i64(2, group.totalSize)
+		meta.i64(3, group.numRows)
+		meta.endStruct()
+	}
+	meta.string(6, "garminsync")
+	meta.endStruct()
+	return meta.buf
+}
+
+func writeSchemaElement(meta *compactWriter, col Column) {
+	meta.beginStruct()
+	meta.i32(1, physicalType(col.Type))
+	if col.Optional {
+		meta.i32(3, repetitionOptional)
+	} else {
+		meta.i32(3, repetitionRequired)
+	}
+	meta.string(4, col.Name)
+
+	switch col.Type {
+	case String:
+		meta.i32(6, convertedUTF8)
+		meta.structField(10)
+		meta.structField(1) // StringType
+		meta.endStruct()
+		meta.endStruct()
+	case Timestamp:
+		meta.i32(6, convertedTimestampMillis)
+		meta.structField(10)
+		meta.structField(8) // TimestampType
+		meta.bool(1, true)  // isAdjustedToUTC
+		meta.structField(2)
+		meta.structField(1) // MILLIS
+		meta.endStruct()
+		meta.endStruct()
+		meta.endStruct()
+		meta.endStruct()
+	}
+	meta.endStruct()
+}
+
+func physicalType(t Type) int32 {
+	switch t {
+	case Boolean:
+		return physicalBoolean
+	case Int32:
+		return physicalInt32
+	case Double:
+		return physicalDouble
+	case String:
+		return physicalByteArray
+	}
+	return physicalInt64
+}
+
+// checkValue reports whether a value can be stored in a column
+func checkValue(col Column, value interface{}) error {
+	if isNull(value) {
+		if !col.Optional {
+			return fmt.Errorf("parquet: column %s is not optional", col.Name)
+		}
+		return nil
+	}
+
+	ok := false
+	switch value.(type) {
+	case bool:
+		ok = col.Type == Boolean
+	case int:
+		ok = col.Type == Int32 || col.Type == Int64
+	case int32:
+		ok = col.Type == Int32 || col.Type == Int64
+	case int64:
+		ok = col.Type == Int64
+	case float64:
+		ok = col.Type == Double
+	case string:
+		ok = col.Type == String
+	case time.Time, *time.Time:
+		ok = col.Type == Timestamp
+	}
+	if !ok {
+		return fmt.Errorf("parquet: column %s cannot hold %T", col.Name, value)
+	}
+	if v, isInt := value.(int); isInt && col.Type == Int32 && (v < math.MinInt32 || v > math.MaxInt32) {
+		return fmt.Errorf("parquet: value %d overflows column %s", v, col.Name)
+	}
+	return nil
+}
+
+func isNull(value interface{}) bool {
+	if t, ok := value.(*time.Time); ok {
+		return t == nil
+	}
+	return value == nil
+}
+
+// add buffers a value checked by checkValue
+func (b *columnBuffer) add(col Column, value interface{}) {
+	null := isNull(value)
+	if col.Optional {
+		b.defs = append(b.defs, !null)
+	}
+	if null {
+		return
+	}
+
+	var scratch [8]byte
+	switch v := value.(type) {
+	case bool:
+		b.bools = append(b.bools, v)
+	case int:
+		b.putInt(col, int64(v))
+	case int32:
+		b.putInt(col, int64(v))
+	case int64:
+		b.putInt(col, v)
+	case float64:
+		binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+		b.values.Write(scratch[:])
+	case string:
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)))
+		b.values.Write(scratch[:4])
+		b.values.WriteString(v)
+	case time.Time:
+		b.putInt(col, v.UnixMilli())
+	case *time.Time:
+		b.putInt(col, v.UnixMilli())
+	}
+}
+
+func (b *columnBuffer) putInt(col Column, v int64) {
+	var scratch [8]byte
+	if col.Type == Int32 {
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(int32(v)))
+		b.values.Write(scratch[:4])
+		return
+	}
+	binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+	b.values.Write(scratch[:])
+}
+
+// encodeLevels writes definition levels of bit width 1 as a single
+// bit-packed run of the RLE/bit-packing hybrid encoding
+func encodeLevels(defs []bool) []byte {
+	groups := (len(defs) + 7) / 8
+	buf := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	return append(buf, packBools(defs)...)
+}
+
+// packBools packs booleans eight to a byte, least significant bit first
+func packBools(values []bool) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
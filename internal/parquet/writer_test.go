@@ -0,0 +1,292 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPageHeader(t *testing.T) {
+	want := []byte{
+		0x15, 0x00, // type: DATA_PAGE
+		0x15, 0x28, // uncompressed_page_size: 20
+		0x15, 0x50, // compressed_page_size: 40
+		0x2c,       // data_page_header
+		0x15, 0x06, //   num_values: 3
+		0x15, 0x00, //   encoding: PLAIN
+		0x15, 0x06, //   definition_level_encoding: RLE
+		0x15, 0x06, //   repetition_level_encoding: RLE
+		0x00,
+		0x00,
+	}
+	if got := pageHeader(3, 20, 40); !bytes.Equal(got, want) {
+		t.Errorf("pageHeader = % x, want % x", got, want)
+	}
+}
+
+func TestFooter(t *testing.T) {
+	w := &Writer{
+		columns: []Column{
+			{Name: "name", Type: String, Optional: true},
+			{Name: "t", Type: Timestamp},
+		},
+		numRows: 2,
+		rowGroups: []rowGroup{{
+			chunks: []columnChunk{
+				{offset: 4, numValues: 2, uncompressedSize: 30, compressedSize: 40},
+				{offset: 50, numValues: 2, uncompressedSize: 25, compressedSize: 35},
+			},
+			numRows:   2,
+			totalSize: 55,
+		}},
+	}
+
+	var want []byte
+	for _, part := range [][]byte{
+		{0x15, 0x02},             // version: 1
+		{0x19, 0x3c},             // schema: 3 elements
+		{0x48, 0x06},             //   root name
+		[]byte("schema"),         //
+		{0x15, 0x04, 0x00},       //   num_children: 2
+		{0x15, 0x0c},             //   name: type BYTE_ARRAY
+		{0x25, 0x02},             //     repetition_type: OPTIONAL
+		{0x18, 0x04},             //     name
+		[]byte("name"),           //
+		{0x25, 0x00},             //     converted_type: UTF8
+		{0x4c, 0x1c, 0x00},       //     logicalType: STRING
+		{0x00, 0x00},             //
+		{0x15, 0x04},             //   t: type INT64
+		{0x25, 0x00},             //     repetition_type: REQUIRED
+		{0x18, 0x01, 't'},        //     name
+		{0x25, 0x12},             //     converted_type: TIMESTAMP_MILLIS
+		{0x4c, 0x8c, 0x11},       //     logicalType: TIMESTAMP, isAdjustedToUTC
+		{0x1c, 0x1c, 0x00},       //       unit: MILLIS
+		{0x00, 0x00, 0x00},       //
+		{0x00},                   //
+		{0x16, 0x04},             // num_rows: 2
+		{0x19, 0x1c},             // row_groups: 1 element
+		{0x19, 0x2c},             //   columns: 2 elements
+		{0x26, 0x08, 0x1c},       //     file_offset: 4, meta_data
+		{0x15, 0x0c},             //       type: BYTE_ARRAY
+		{0x19, 0x25, 0x00, 0x06}, //       encodings: PLAIN, RLE
+		{0x19, 0x18, 0x04},       //       path_in_schema
+		[]byte("name"),           //
+		{0x15, 0x04},             //       codec: GZIP
+		{0x16, 0x04},             //       num_values: 2
+		{0x16, 0x3c},             //       total_uncompressed_size: 30
+		{0x16, 0x50},             //       total_compressed_size: 40
+		{0x26, 0x08},             //       data_page_offset: 4
+		{0x00, 0x00},             //
+		{0x26, 0x64, 0x1c},       //     file_offset: 50, meta_data
+		{0x15, 0x04},             //       type: INT64
+		{0x19, 0x25, 0x00, 0x06}, //       encodings: PLAIN, RLE
+		{0x19, 0x18, 0x01, 't'},  //       path_in_schema
+		{0x15, 0x04},             //       codec: GZIP
+		{0x16, 0x04},             //       num_values: 2
+		{0x16, 0x32},             //       total_uncompressed_size: 25
+		{0x16, 0x46},             //       total_compressed_size: 35
+		{0x26, 0x64},             //       data_page_offset: 50
+		{0x00, 0x00},             //
+		{0x16, 0x6e},             //   total_byte_size: 55
+		{0x16, 0x04},             //   num_rows: 2
+		{0x00},                   //
+		{0x28, 0x0a},             // created_by
+		[]byte("garminsync"),
+		{0x00},
+	} {
+		want = append(want, part...)
+	}
+
+	if got := w.footer(); !bytes.Equal(got, want) {
+		t.Errorf("footer =\n% x\nwant\n% x", got, want)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	columns := []Column{
+		{Name: "id", Type: Int64},
+		{Name: "done", Type: Boolean},
+		{Name: "flag", Type: Boolean, Optional: true},
+		{Name: "at", Type: Timestamp, Optional: true},
+		{Name: "heart_rate", Type: Int32, Optional: true},
+		{Name: "name", Type: String, Optional: true},
+		{Name: "speed", Type: Double},
+	}
+	first := time.Date(2024, 5, 1, 7, 30, 0, 123e6, time.UTC)
+	second := time.Date(2024, 5, 2, 9, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	var missing *time.Time
+	rows := [][]interface{}{
+		{int64(1), true, nil, first, 150, "Morning Run", 2.5},
+		{2, false, true, missing, nil, nil, 3.25},
+		{int64(3), true, false, &second, int32(160), "Ride ß", 0.0},
+	}
+	want := [][]interface{}{
+		{int64(1), true, nil, first, int32(150), "Morning Run", 2.5},
+		{int64(2), false, true, nil, nil, nil, 3.25},
+		{int64(3), true, false, second.UTC(), int32(160), "Ride ß", 0.0},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, columns)
+	w.RowGroupSize = 2
+	for _, row := range rows {
+		if err := w.Write(row...); err != nil {
+			t.Fatalf("Write(%v): %v", row, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := w.Write(rows[0]...); err != ErrClosed {
+		t.Errorf("Write after Close = %v, want ErrClosed", err)
+	}
+
+	got, groups := readFile(t, buf.Bytes(), columns)
+	if groups != 2 {
+		t.Errorf("row groups = %d, want 2", groups)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestWriteRejectsBadValues(t *testing.T) {
+	columns := []Column{
+		{Name: "id", Type: Int64},
+		{Name: "heart_rate", Type: Int32, Optional: true},
+	}
+	tests := []struct {
+		name string
+		row  []interface{}
+	}{
+		{"null in required column", []interface{}{nil, 1}},
+		{"wrong type", []interface{}{"1", 1}},
+		{"int64 in int32 column", []interface{}{1, int64(1)}},
+		{"int32 overflow", []interface{}{1, math.MaxInt32 + 1}},
+		{"too few values", []interface{}{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWriter(io.Discard, columns)
+			if err := w.Write(tt.row...); err == nil {
+				t.Errorf("Write(%v) succeeded", tt.row)
+			}
+			if w.rows != 0 {
+				t.Errorf("%d rows buffered after a rejected row", w.rows)
+			}
+		})
+	}
+}
+
+// readFile decodes a file written by Writer back into rows, following the
+// footer to each column chunk, and returns them with the number of row
+// groups
+func readFile(t *testing.T, data []byte, columns []Column) ([][]interface{}, int) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte(magic)) || !bytes.HasSuffix(data, []byte(magic)) {
+		t.Fatalf("file does not start and end with %s", magic)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &compactReader{buf: data[len(data)-8-footerLen : len(data)-8]}
+	meta := footer.readStruct()
+
+	var rows [][]interface{}
+	groups := meta[4].([]interface{})
+	for _, g := range groups {
+		group := g.(map[int16]interface{})
+		numRows := int(group[3].(int64))
+		chunks := group[1].([]interface{})
+		groupRows := make([][]interface{}, numRows)
+		for i := range groupRows {
+			groupRows[i] = make([]interface{}, len(columns))
+		}
+
+		for c, col := range columns {
+			chunkMeta := chunks[c].(map[int16]interface{})[3].(map[int16]interface{})
+			offset := int(chunkMeta[9].(int64))
+			r := &compactReader{buf: data[offset:]}
+			header := r.readStruct()
+			if n := header[5].(map[int16]interface{})[1].(int64); int(n) != numRows {
+				t.Fatalf("column %s: page has %d values, want %d", col.Name, n, numRows)
+			}
+			compressed := data[offset+r.pos : offset+r.pos+int(header[3].(int64))]
+			gz, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("column %s: %v", col.Name, err)
+			}
+			page, err := io.ReadAll(gz)
+			if err != nil {
+				t.Fatalf("column %s: %v", col.Name, err)
+			}
+			if len(page) != int(header[2].(int64)) {
+				t.Fatalf("column %s: page is %d bytes, header says %d", col.Name, len(page), header[2])
+			}
+			for i, v := range decodePage(t, col, page, numRows) {
+				groupRows[i][c] = v
+			}
+		}
+		rows = append(rows, groupRows...)
+	}
+
+	if n := meta[3].(int64); int(n) != len(rows) {
+		t.Errorf("footer num_rows = %d, read %d rows", n, len(rows))
+	}
+	return rows, len(groups)
+}
+
+// decodePage decodes the plain-encoded values of a data page, with nil for
+// nulls of an optional column
+func decodePage(t *testing.T, col Column, page []byte, numRows int) []interface{} {
+	t.Helper()
+	defined := make([]bool, numRows)
+	for i := range defined {
+		defined[i] = true
+	}
+	if col.Optional {
+		n := binary.LittleEndian.Uint32(page)
+		levels := page[4 : 4+n]
+		header, size := binary.Uvarint(levels)
+		if header&1 != 1 || int(header>>1) != (numRows+7)/8 {
+			t.Fatalf("column %s: unexpected definition level run header %#x", col.Name, header)
+		}
+		for i := range defined {
+			defined[i] = levels[size+i/8]&(1<<(i%8)) != 0
+		}
+		page = page[4+n:]
+	}
+
+	values := make([]interface{}, numRows)
+	bit := 0
+	for i := range values {
+		if !defined[i] {
+			continue
+		}
+		switch col.Type {
+		case Boolean:
+			values[i] = page[bit/8]&(1<<(bit%8)) != 0
+			bit++
+		case Int32:
+			values[i] = int32(binary.LittleEndian.Uint32(page))
+			page = page[4:]
+		case Int64:
+			values[i] = int64(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case Double:
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case String:
+			n := binary.LittleEndian.Uint32(page)
+			values[i] = string(page[4 : 4+n])
+			page = page[4+n:]
+		case Timestamp:
+			values[i] = time.UnixMilli(int64(binary.LittleEndian.Uint64(page))).UTC()
+			page = page[8:]
+		}
+	}
+	return values
+}
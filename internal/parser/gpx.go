@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/models"
+)
+
+// gpxFile is the subset of GPX 1.0/1.1 read by ParseGPX. Element names are
+// matched without their namespace, so Garmin's TrackPointExtension v1 and v2
+// are both understood.
+type gpxFile struct {
+	Metadata struct {
+		Time string `xml:"time"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []struct {
+				Lat        float64  `xml:"lat,attr"`
+				Lon        float64  `xml:"lon,attr"`
+				Elevation  *float64 `xml:"ele"`
+				Time       string   `xml:"time"`
+				Extensions struct {
+					TrackPoint struct {
+						HeartRate   int      `xml:"hr"`
+						Cadence     int      `xml:"cad"`
+						Temperature *float64 `xml:"atemp"`
+					} `xml:"TrackPointExtension"`
+					Power int `xml:"power"`
+				} `xml:"extensions"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// ParseGPX extracts activity metrics from a GPX file. Totals are computed
+// from the track points, since GPX has no summary of its own.
+func (p *Parser) ParseGPX(data []byte) (*models.ActivityMetrics, error) {
+	var doc gpxFile
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode GPX file: %w", err)
+	}
+	if len(doc.Tracks) == 0 {
+		return nil, fmt.Errorf("no tracks found in GPX file")
+	}
+
+	var records []models.Record
+	for _, track := range doc.Tracks {
+		for _, segment := range track.Segments {
+			for _, pt := range segment.Points {
+				record := models.Record{
+					Latitude:    pt.Lat,
+					Longitude:   pt.Lon,
+					HasPosition: true,
+					HeartRate:   pt.Extensions.TrackPoint.HeartRate,
+					Cadence:     pt.Extensions.TrackPoint.Cadence,
+					Power:       pt.Extensions.Power,
+				}
+				if pt.Time != "" {
+					t, err := time.Parse(time.RFC3339, strings.TrimSpace(pt.Time))
+					if err != nil {
+						return nil, fmt.Errorf("invalid GPX point time %q", pt.Time)
+					}
+					record.Time = t
+				}
+				if pt.Elevation != nil {
+					record.Altitude, record.HasAltitude = *pt.Elevation, true
+				}
+				if pt.Extensions.TrackPoint.Temperature != nil {
+					record.Temperature, record.HasTemperature = *pt.Extensions.TrackPoint.Temperature, true
+				}
+				records = append(records, record)
+			}
+		}
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no track points found in GPX file")
+	}
+
+	metrics := trackSummary(records)
+	if metrics.StartTime.IsZero() {
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(doc.Metadata.Time)); err == nil {
+			metrics.StartTime = t
+		}
+	}
+	if metrics.StartTime.IsZero() {
+		return nil, fmt.Errorf("GPX file has no timestamps")
+	}
+	metrics.Name = strings.TrimSpace(doc.Tracks[0].Name)
+	metrics.ActivityType = strings.ToLower(strings.TrimSpace(doc.Tracks[0].Type))
+	return metrics, nil
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="Garmin Connect" xmlns="http://www.topografix.com/GPX/1/1"
+  xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v2">
+  <metadata><time>2024-05-01T07:00:00Z</time></metadata>
+  <trk>
+    <name> Morning Run </name>
+    <type>Running</type>
+    <trkseg>
+      <trkpt lat="52.0000" lon="4.0000">
+        <ele>10.0</ele>
+        <time>2024-05-01T07:30:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension>
+          <gpxtpx:atemp>18.0</gpxtpx:atemp><gpxtpx:hr>140</gpxtpx:hr><gpxtpx:cad>85</gpxtpx:cad>
+        </gpxtpx:TrackPointExtension><power>200</power></extensions>
+      </trkpt>
+      <trkpt lat="52.0010" lon="4.0000">
+        <ele>15.0</ele>
+        <time>2024-05-01T07:31:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension>
+          <gpxtpx:atemp>20.0</gpxtpx:atemp><gpxtpx:hr>160</gpxtpx:hr>
+        </gpxtpx:TrackPointExtension><power>300</power></extensions>
+      </trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="52.0020" lon="4.0000">
+        <ele>12.0</ele>
+        <time>2024-05-01T07:32:30Z</time>
+      </trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestParseGPX(t *testing.T) {
+	metrics, err := NewParser().ParseData([]byte(testGPX))
+	if err != nil {
+		t.Fatalf("ParseData: %v", err)
+	}
+
+	start := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	if !metrics.StartTime.Equal(start) || metrics.Duration != 150*time.Second {
+		t.Errorf("start %v, duration %v; want %v, 2m30s", metrics.StartTime, metrics.Duration, start)
+	}
+	leg := haversine(52, 4, 52.001, 4)
+	if math.Abs(metrics.Distance-2*leg) > 0.01 {
+		t.Errorf("distance = %.2f, want %.2f across both segments", metrics.Distance, 2*leg)
+	}
+	if metrics.Name != "Morning Run" || metrics.ActivityType != "running" {
+		t.Errorf("name %q, type %q; want Morning Run, running", metrics.Name, metrics.ActivityType)
+	}
+	if metrics.ElevationGain != 5 || metrics.ElevationLoss != 3 {
+		t.Errorf("elevation +%v -%v, want +5 -3", metrics.ElevationGain, metrics.ElevationLoss)
+	}
+	if metrics.AvgHeartRate != 150 || metrics.MaxHeartRate != 160 || metrics.AvgPower != 250 {
+		t.Errorf("heart rate avg %d max %d, power %d; want 150, 160, 250",
+			metrics.AvgHeartRate, metrics.MaxHeartRate, metrics.AvgPower)
+	}
+	if metrics.MinTemperature != 18 || metrics.MaxTemperature != 20 || metrics.AvgTemperature != 19 {
+		t.Errorf("temperature %v/%v/%v, want 18/19/20", metrics.MinTemperature, metrics.AvgTemperature, metrics.MaxTemperature)
+	}
+	if len(metrics.Laps) != 0 {
+		t.Errorf("%d laps, want none from a GPX track", len(metrics.Laps))
+	}
+
+	if len(metrics.Records) != 3 {
+		t.Fatalf("%d records, want 3", len(metrics.Records))
+	}
+	first, last := metrics.Records[0], metrics.Records[2]
+	if first.HeartRate != 140 || first.Cadence != 85 || first.Power != 200 || !first.HasTemperature || !first.HasAltitude {
+		t.Errorf("first record = %+v, want the extension values", first)
+	}
+	if last.HasTemperature || last.HeartRate != 0 || math.Abs(last.Distance-2*leg) > 0.01 {
+		t.Errorf("last record = %+v, want no extensions and the cumulative distance", last)
+	}
+}
+
+func TestParseGPXMetadataTime(t *testing.T) {
+	doc := `<gpx><metadata><time>2024-05-01T07:00:00Z</time></metadata>
+<trk><trkseg><trkpt lat="52" lon="4"/><trkpt lat="52.001" lon="4"/></trkseg></trk></gpx>`
+	metrics, err := NewParser().ParseGPX([]byte(doc))
+	if err != nil {
+		t.Fatalf("ParseGPX: %v", err)
+	}
+	if want := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC); !metrics.StartTime.Equal(want) {
+		t.Errorf("start = %v, want the metadata time %v", metrics.StartTime, want)
+	}
+}
+
+func TestParseGPXErrors(t *testing.T) {
+	tests := []struct {
+		name, doc, want string
+	}{
+		{"not xml", "<gpx", "failed to decode GPX"},
+		{"no tracks", "<gpx></gpx>", "no tracks"},
+		{"no points", "<gpx><trk><trkseg></trkseg></trk></gpx>", "no track points"},
+		{"bad time", `<gpx><trk><trkseg><trkpt lat="1" lon="1"><time>yesterday</time></trkpt></trkseg></trk></gpx>`, "invalid GPX point time"},
+		{"no timestamps", `<gpx><trk><trkseg><trkpt lat="1" lon="1"/></trkseg></trk></gpx>`, "no timestamps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser().ParseGPX([]byte(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseGPX error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
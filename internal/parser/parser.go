@@ -2,15 +2,28 @@ package parser
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/tormoder/fit"
 	"github.com/sstent/garminsync-go/internal/models"
 )
 
-// Parser handles FIT file parsing
+// ErrUnsupportedFormat is returned by ParseData for files that are not FIT,
+// GPX or TCX
+var ErrUnsupportedFormat = errors.New("unsupported file format")
+
+// ErrNotActivity is returned for valid FIT files that hold something other
+// than an activity, such as settings or monitoring data
+var ErrNotActivity = errors.New("not an activity file")
+
+// Parser handles FIT, GPX and TCX file parsing
 type Parser struct{}
 
 func NewParser() *Parser {
@@ -18,12 +31,6 @@ func NewParser() *Parser {
 }
 
 func (p *Parser) ParseFile(filename string) (*models.ActivityMetrics, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
@@ -32,11 +39,30 @@ func (p *Parser) ParseFile(filename string) (*models.ActivityMetrics, error) {
 	return p.ParseData(data)
 }
 
+// ParseData parses a FIT, GPX or TCX file, detecting the format from its
+// content
 func (p *Parser) ParseData(data []byte) (*models.ActivityMetrics, error) {
+	switch format := DetectFormat(data); format {
+	case "fit":
+		return p.ParseFIT(data)
+	case "gpx":
+		return p.ParseGPX(data)
+	case "tcx":
+		return p.ParseTCX(data)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// ParseFIT extracts activity metrics and laps from a FIT activity file
+func (p *Parser) ParseFIT(data []byte) (*models.ActivityMetrics, error) {
 	fitFile, err := fit.Decode(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode FIT file: %w", err)
 	}
+	if fitFile.Type() != fit.FileTypeActivity {
+		return nil, fmt.Errorf("%w: FIT file type %v", ErrNotActivity, fitFile.Type())
+	}
 
 	activity, err := fitFile.Activity()
 	if err != nil {
@@ -49,17 +75,163 @@ func (p *Parser) ParseData(data []byte) (*models.ActivityMetrics, error) {
 
 	session := activity.Sessions[0]
 	metrics := &models.ActivityMetrics{
+		ActivityType:  sportType(session.Sport),
 		StartTime:     session.StartTime,
-		Duration:      time.Duration(session.TotalTimerTime) * time.Second,
-		Distance:      float64(session.TotalDistance),
-		AvgHeartRate:  int(session.AvgHeartRate),
-		MaxHeartRate:  int(session.MaxHeartRate),
-		AvgPower:      int(session.AvgPower),
-		Calories:      int(session.TotalCalories),
-		ElevationGain: float64(session.TotalAscent),
-		ElevationLoss: float64(session.TotalDescent),
+		Duration:      seconds(session.GetTotalTimerTimeScaled()),
+		Distance:      scaled(session.GetTotalDistanceScaled()),
+		AvgHeartRate:  uint8Value(session.AvgHeartRate),
+		MaxHeartRate:  uint8Value(session.MaxHeartRate),
+		AvgPower:      uint16Value(session.AvgPower),
+		Calories:      uint16Value(session.TotalCalories),
+		ElevationGain: float64(uint16Value(session.TotalAscent)),
+		ElevationLoss: float64(uint16Value(session.TotalDescent)),
 		Steps:         0, // FIT sessions don't include steps
 	}
+	if serial := fitFile.FileId.SerialNumber; serial != 0 {
+		metrics.DeviceSerial = strconv.FormatUint(uint64(serial), 10)
+	}
+	if session.AvgTemperature != math.MaxInt8 {
+		metrics.AvgTemperature = float64(session.AvgTemperature)
+	}
+	if session.MaxTemperature != math.MaxInt8 {
+		metrics.MaxTemperature = float64(session.MaxTemperature)
+	}
+	if session.MinTemperature != math.MaxInt8 {
+		metrics.MinTemperature = float64(session.MinTemperature)
+	}
+
+	for i, lap := range activity.Laps {
+		metrics.Laps = append(metrics.Laps, models.Lap{
+			Index:         i,
+			StartTime:     lap.StartTime,
+			Duration:      seconds(lap.GetTotalTimerTimeScaled()),
+			Distance:      scaled(lap.GetTotalDistanceScaled()),
+			AvgSpeed:      scaled(lap.GetAvgSpeedScaled()),
+			MaxSpeed:      scaled(lap.GetMaxSpeedScaled()),
+			AvgHeartRate:  uint8Value(lap.AvgHeartRate),
+			MaxHeartRate:  uint8Value(lap.MaxHeartRate),
+			AvgCadence:    uint8Value(lap.AvgCadence),
+			MaxCadence:    uint8Value(lap.MaxCadence),
+			AvgPower:      uint16Value(lap.AvgPower),
+			MaxPower:      uint16Value(lap.MaxPower),
+			Calories:      uint16Value(lap.TotalCalories),
+			ElevationGain: float64(uint16Value(lap.TotalAscent)),
+			ElevationLoss: float64(uint16Value(lap.TotalDescent)),
+		})
+	}
+
+	for _, record := range activity.Records {
+		metrics.Records = append(metrics.Records, fitRecord(record))
+	}
 
 	return metrics, nil
 }
+
+// fitRecord converts a FIT record message, preferring the enhanced
+// altitude and speed fields where a device wrote them
+func fitRecord(msg *fit.RecordMsg) models.Record {
+	record := models.Record{
+		Time:      msg.Timestamp,
+		Distance:  scaled(msg.GetDistanceScaled()),
+		HeartRate: uint8Value(msg.HeartRate),
+		Cadence:   uint8Value(msg.Cadence),
+		Power:     uint16Value(msg.Power),
+	}
+	if !msg.PositionLat.Invalid() && !msg.PositionLong.Invalid() {
+		record.Latitude = msg.PositionLat.Degrees()
+		record.Longitude = msg.PositionLong.Degrees()
+		record.HasPosition = true
+	}
+
+	altitude := msg.GetEnhancedAltitudeScaled()
+	if math.IsNaN(altitude) {
+		altitude = msg.GetAltitudeScaled()
+	}
+	if !math.IsNaN(altitude) {
+		record.Altitude, record.HasAltitude = altitude, true
+	}
+
+	speed := msg.GetEnhancedSpeedScaled()
+	if math.IsNaN(speed) {
+		speed = msg.GetSpeedScaled()
+	}
+	record.Speed = scaled(speed)
+
+	if msg.Temperature != math.MaxInt8 {
+		record.Temperature, record.HasTemperature = float64(msg.Temperature), true
+	}
+	return record
+}
+
+// FIT marks fields a device did not record with the type's maximum value;
+// these helpers map such fields to zero.
+
+func uint8Value(v uint8) int {
+	if v == math.MaxUint8 {
+		return 0
+	}
+	return int(v)
+}
+
+func uint16Value(v uint16) int {
+	if v == math.MaxUint16 {
+		return 0
+	}
+	return int(v)
+}
+
+// scaled maps the NaN returned by the fit package's Get*Scaled accessors
+// for invalid fields to zero
+func scaled(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(scaled(v) * float64(time.Second))
+}
+
+// sportType converts a FIT sport such as CrossCountrySkiing into the
+// snake_case form Garmin Connect uses for activity types
+func sportType(sport fit.Sport) string {
+	if sport == fit.SportInvalid {
+		return ""
+	}
+	var b strings.Builder
+	for i, r := range sport.String() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// DetectFormat sniffs the format of an activity file from its content. It
+// returns "fit", "zip", "gpx", "tcx" or "unknown".
+func DetectFormat(data []byte) string {
+	switch {
+	case len(data) >= 12 && string(data[8:12]) == ".FIT":
+		return "fit"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return "zip"
+	}
+
+	// XML formats: look at the start of the document only
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	switch {
+	case bytes.Contains(head, []byte("<TrainingCenterDatabase")):
+		return "tcx"
+	case bytes.Contains(head, []byte("<gpx")):
+		return "gpx"
+	}
+	return "unknown"
+}
@@ -0,0 +1,174 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/models"
+)
+
+// tcxSports maps TCX sports onto Garmin Connect activity types
+var tcxSports = map[string]string{
+	"Running": "running",
+	"Biking":  "cycling",
+	"Other":   "other",
+}
+
+// tcxFile is the subset of TrainingCenterDatabase v2 read by ParseTCX
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		ID    string `xml:"Id"`
+		Laps  []struct {
+			StartTime        string  `xml:"StartTime,attr"`
+			TotalTimeSeconds float64 `xml:"TotalTimeSeconds"`
+			DistanceMeters   float64 `xml:"DistanceMeters"`
+			MaximumSpeed     float64 `xml:"MaximumSpeed"`
+			Calories         int     `xml:"Calories"`
+			AvgHeartRate     int     `xml:"AverageHeartRateBpm>Value"`
+			MaxHeartRate     int     `xml:"MaximumHeartRateBpm>Value"`
+			Cadence          int     `xml:"Cadence"`
+			Extensions       struct {
+				AvgSpeed float64 `xml:"LX>AvgSpeed"`
+				AvgWatts int     `xml:"LX>AvgWatts"`
+				MaxWatts int     `xml:"LX>MaxWatts"`
+				Cadence  int     `xml:"LX>AvgRunCadence"`
+			} `xml:"Extensions"`
+			Trackpoints []struct {
+				Time       string   `xml:"Time"`
+				Latitude   *float64 `xml:"Position>LatitudeDegrees"`
+				Longitude  *float64 `xml:"Position>LongitudeDegrees"`
+				Altitude   *float64 `xml:"AltitudeMeters"`
+				Distance   float64  `xml:"DistanceMeters"`
+				HeartRate  int      `xml:"HeartRateBpm>Value"`
+				Cadence    int      `xml:"Cadence"`
+				Extensions struct {
+					Speed      float64 `xml:"TPX>Speed"`
+					Watts      int     `xml:"TPX>Watts"`
+					RunCadence int     `xml:"TPX>RunCadence"`
+				} `xml:"Extensions"`
+			} `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+		Creator struct {
+			UnitID string `xml:"UnitId"`
+		} `xml:"Creator"`
+	} `xml:"Activities>Activity"`
+}
+
+// ParseTCX extracts activity metrics from the first activity of a TCX file.
+// Duration, distance and calories come from the lap totals; the remaining
+// statistics are computed from the track points.
+func (p *Parser) ParseTCX(data []byte) (*models.ActivityMetrics, error) {
+	var doc tcxFile
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode TCX file: %w", err)
+	}
+	if len(doc.Activities) == 0 {
+		return nil, fmt.Errorf("no activities found in TCX file")
+	}
+	activity := doc.Activities[0]
+	if len(activity.Laps) == 0 {
+		return nil, fmt.Errorf("no laps found in TCX file")
+	}
+
+	var records []models.Record
+	var laps []models.Lap
+	var duration, distance float64
+	var calories int
+	for i, lap := range activity.Laps {
+		start, err := time.Parse(time.RFC3339, strings.TrimSpace(lap.StartTime))
+		if err != nil {
+			return nil, fmt.Errorf("invalid TCX lap start time %q", lap.StartTime)
+		}
+
+		var lapRecords []models.Record
+		for _, tp := range lap.Trackpoints {
+			t, err := time.Parse(time.RFC3339, strings.TrimSpace(tp.Time))
+			if err != nil {
+				return nil, fmt.Errorf("invalid TCX trackpoint time %q", tp.Time)
+			}
+			record := models.Record{
+				Time:      t,
+				Distance:  tp.Distance,
+				Speed:     tp.Extensions.Speed,
+				HeartRate: tp.HeartRate,
+				Cadence:   tp.Cadence,
+				Power:     tp.Extensions.Watts,
+			}
+			if record.Cadence == 0 {
+				record.Cadence = tp.Extensions.RunCadence
+			}
+			if tp.Latitude != nil && tp.Longitude != nil {
+				record.Latitude, record.Longitude, record.HasPosition = *tp.Latitude, *tp.Longitude, true
+			}
+			if tp.Altitude != nil {
+				record.Altitude, record.HasAltitude = *tp.Altitude, true
+			}
+			lapRecords = append(lapRecords, record)
+		}
+
+		// Summarise a copy, so the activity summary below fills in
+		// cumulative distances across laps
+		summary := trackSummary(append([]models.Record(nil), lapRecords...))
+		cadence := lap.Cadence
+		if cadence == 0 {
+			cadence = lap.Extensions.Cadence
+		}
+		maxPower := lap.Extensions.MaxWatts
+		if maxPower == 0 {
+			for _, record := range lapRecords {
+				if record.Power > maxPower {
+					maxPower = record.Power
+				}
+			}
+		}
+		avgPower := lap.Extensions.AvgWatts
+		if avgPower == 0 {
+			avgPower = summary.AvgPower
+		}
+		avgSpeed := lap.Extensions.AvgSpeed
+		if avgSpeed == 0 && lap.TotalTimeSeconds > 0 {
+			avgSpeed = lap.DistanceMeters / lap.TotalTimeSeconds
+		}
+
+		laps = append(laps, models.Lap{
+			Index:         i,
+			StartTime:     start,
+			Duration:      time.Duration(lap.TotalTimeSeconds * float64(time.Second)),
+			Distance:      lap.DistanceMeters,
+			AvgSpeed:      avgSpeed,
+			MaxSpeed:      lap.MaximumSpeed,
+			AvgHeartRate:  lap.AvgHeartRate,
+			MaxHeartRate:  lap.MaxHeartRate,
+			AvgCadence:    cadence,
+			AvgPower:      avgPower,
+			MaxPower:      maxPower,
+			Calories:      lap.Calories,
+			ElevationGain: summary.ElevationGain,
+			ElevationLoss: summary.ElevationLoss,
+		})
+		records = append(records, lapRecords...)
+		duration += lap.TotalTimeSeconds
+		distance += lap.DistanceMeters
+		calories += lap.Calories
+	}
+
+	metrics := trackSummary(records)
+	metrics.StartTime = laps[0].StartTime
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(activity.ID)); err == nil {
+		metrics.StartTime = t
+	}
+	metrics.Duration = time.Duration(duration * float64(time.Second))
+	metrics.Distance = distance
+	metrics.Calories = calories
+	metrics.ActivityType = tcxSports[activity.Sport]
+	metrics.DeviceSerial = strings.TrimSpace(activity.Creator.UnitID)
+	if metrics.DeviceSerial == "0" {
+		metrics.DeviceSerial = ""
+	}
+	metrics.Laps = laps
+	return metrics, nil
+}
@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTCX = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+  xmlns:ns3="http://www.garmin.com/xmlschemas/ActivityExtension/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2024-05-01T07:29:58Z</Id>
+      <Lap StartTime="2024-05-01T07:30:00Z">
+        <TotalTimeSeconds>600</TotalTimeSeconds>
+        <DistanceMeters>5000</DistanceMeters>
+        <MaximumSpeed>11.5</MaximumSpeed>
+        <Calories>150</Calories>
+        <AverageHeartRateBpm><Value>140</Value></AverageHeartRateBpm>
+        <MaximumHeartRateBpm><Value>155</Value></MaximumHeartRateBpm>
+        <Cadence>88</Cadence>
+        <Track>
+          <Trackpoint>
+            <Time>2024-05-01T07:30:00Z</Time>
+            <Position><LatitudeDegrees>52.0</LatitudeDegrees><LongitudeDegrees>4.0</LongitudeDegrees></Position>
+            <AltitudeMeters>10</AltitudeMeters>
+            <DistanceMeters>0</DistanceMeters>
+            <HeartRateBpm><Value>130</Value></HeartRateBpm>
+            <Extensions><ns3:TPX><ns3:Speed>8.0</ns3:Speed><ns3:Watts>180</ns3:Watts></ns3:TPX></Extensions>
+          </Trackpoint>
+          <Trackpoint>
+            <Time>2024-05-01T07:40:00Z</Time>
+            <AltitudeMeters>16</AltitudeMeters>
+            <DistanceMeters>5000</DistanceMeters>
+            <HeartRateBpm><Value>150</Value></HeartRateBpm>
+            <Extensions><ns3:TPX><ns3:Watts>220</ns3:Watts></ns3:TPX></Extensions>
+          </Trackpoint>
+        </Track>
+      </Lap>
+      <Lap StartTime="2024-05-01T07:40:00Z">
+        <TotalTimeSeconds>300</TotalTimeSeconds>
+        <DistanceMeters>2000</DistanceMeters>
+        <Calories>60</Calories>
+        <Extensions><ns3:LX><ns3:AvgSpeed>6.5</ns3:AvgSpeed><ns3:AvgWatts>150</ns3:AvgWatts><ns3:MaxWatts>400</ns3:MaxWatts></ns3:LX></Extensions>
+        <Track>
+          <Trackpoint>
+            <Time>2024-05-01T07:45:00Z</Time>
+            <AltitudeMeters>12</AltitudeMeters>
+            <DistanceMeters>7000</DistanceMeters>
+          </Trackpoint>
+        </Track>
+      </Lap>
+      <Creator><UnitId>3312345678</UnitId></Creator>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+func TestParseTCX(t *testing.T) {
+	metrics, err := NewParser().ParseData([]byte(testTCX))
+	if err != nil {
+		t.Fatalf("ParseData: %v", err)
+	}
+
+	// The activity Id wins over the first lap's start time
+	if want := time.Date(2024, 5, 1, 7, 29, 58, 0, time.UTC); !metrics.StartTime.Equal(want) {
+		t.Errorf("start = %v, want %v", metrics.StartTime, want)
+	}
+	if metrics.Duration != 900*time.Second || metrics.Distance != 7000 || metrics.Calories != 210 {
+		t.Errorf("duration %v, distance %v, calories %d; want the lap totals 15m, 7000, 210",
+			metrics.Duration, metrics.Distance, metrics.Calories)
+	}
+	if metrics.ActivityType != "cycling" || metrics.DeviceSerial != "3312345678" {
+		t.Errorf("type %q, serial %q; want cycling, 3312345678", metrics.ActivityType, metrics.DeviceSerial)
+	}
+	if metrics.AvgHeartRate != 140 || metrics.MaxHeartRate != 150 || metrics.AvgPower != 200 {
+		t.Errorf("heart rate avg %d max %d, power %d; want 140, 150, 200 from the track points",
+			metrics.AvgHeartRate, metrics.MaxHeartRate, metrics.AvgPower)
+	}
+	if len(metrics.Records) != 3 || metrics.Records[2].Distance != 7000 || metrics.Records[0].Speed != 8 {
+		t.Errorf("records = %+v, want 3 with the recorded distances", metrics.Records)
+	}
+
+	if len(metrics.Laps) != 2 {
+		t.Fatalf("%d laps, want 2", len(metrics.Laps))
+	}
+	first, second := metrics.Laps[0], metrics.Laps[1]
+	if first.Index != 0 || !first.StartTime.Equal(time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)) ||
+		first.Duration != 600*time.Second || first.Distance != 5000 || first.Calories != 150 {
+		t.Errorf("first lap = %+v, want the lap totals", first)
+	}
+	// Without an LX extension, speed comes from the totals and power from
+	// the track points
+	if first.AvgSpeed != 5000.0/600 || first.MaxSpeed != 11.5 || first.AvgCadence != 88 ||
+		first.AvgPower != 200 || first.MaxPower != 220 || first.AvgHeartRate != 140 || first.MaxHeartRate != 155 {
+		t.Errorf("first lap = %+v, want computed speed and power", first)
+	}
+	if first.ElevationGain != 6 || first.ElevationLoss != 0 {
+		t.Errorf("first lap elevation +%v -%v, want +6 -0", first.ElevationGain, first.ElevationLoss)
+	}
+	if second.Index != 1 || second.AvgSpeed != 6.5 || second.AvgPower != 150 || second.MaxPower != 400 {
+		t.Errorf("second lap = %+v, want the LX extension values", second)
+	}
+}
+
+func TestParseTCXSerialZero(t *testing.T) {
+	doc := strings.Replace(testTCX, "<UnitId>3312345678</UnitId>", "<UnitId>0</UnitId>", 1)
+	metrics, err := NewParser().ParseTCX([]byte(doc))
+	if err != nil {
+		t.Fatalf("ParseTCX: %v", err)
+	}
+	if metrics.DeviceSerial != "" {
+		t.Errorf("serial = %q, want none for unit 0", metrics.DeviceSerial)
+	}
+}
+
+func TestParseTCXErrors(t *testing.T) {
+	tests := []struct {
+		name, doc, want string
+	}{
+		{"not xml", "<TrainingCenterDatabase", "failed to decode TCX"},
+		{"no activities", "<TrainingCenterDatabase><Activities/></TrainingCenterDatabase>", "no activities"},
+		{"no laps", `<TrainingCenterDatabase><Activities><Activity Sport="Running"/></Activities></TrainingCenterDatabase>`, "no laps"},
+		{"bad lap time", `<TrainingCenterDatabase><Activities><Activity><Lap StartTime="noon"/></Activity></Activities></TrainingCenterDatabase>`, "invalid TCX lap start time"},
+		{"bad point time", `<TrainingCenterDatabase><Activities><Activity><Lap StartTime="2024-05-01T07:30:00Z">
+<Track><Trackpoint><Time>later</Time></Trackpoint></Track></Lap></Activity></Activities></TrainingCenterDatabase>`, "invalid TCX trackpoint time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser().ParseTCX([]byte(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseTCX error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"math"
+
+	"github.com/sstent/garminsync-go/internal/models"
+)
+
+// earthRadius is the mean Earth radius in meters, used for track distances
+const earthRadius = 6371008.8
+
+// trackSummary computes activity totals from the records of a GPX or TCX
+// track: elapsed time, distance along the track, elevation change, and heart
+// rate, power and temperature statistics. Records without a recorded
+// distance get the cumulative track distance.
+func trackSummary(records []models.Record) *models.ActivityMetrics {
+	metrics := &models.ActivityMetrics{Records: records}
+	if len(records) == 0 {
+		return metrics
+	}
+	metrics.StartTime = records[0].Time
+	metrics.Duration = records[len(records)-1].Time.Sub(records[0].Time)
+
+	var hrSum, hrCount, powerSum, powerCount, tempCount int
+	var tempSum float64
+	var prev *models.Record
+	for i := range records {
+		record := &records[i]
+
+		if record.HeartRate > 0 {
+			hrSum += record.HeartRate
+			hrCount++
+			if record.HeartRate > metrics.MaxHeartRate {
+				metrics.MaxHeartRate = record.HeartRate
+			}
+		}
+		if record.Power > 0 {
+			powerSum += record.Power
+			powerCount++
+		}
+		if record.HasTemperature {
+			if tempCount == 0 || record.Temperature < metrics.MinTemperature {
+				metrics.MinTemperature = record.Temperature
+			}
+			if tempCount == 0 || record.Temperature > metrics.MaxTemperature {
+				metrics.MaxTemperature = record.Temperature
+			}
+			tempSum += record.Temperature
+			tempCount++
+		}
+
+		if prev != nil {
+			if prev.HasPosition && record.HasPosition {
+				metrics.Distance += haversine(prev.Latitude, prev.Longitude, record.Latitude, record.Longitude)
+			}
+			if prev.HasAltitude && record.HasAltitude {
+				if delta := record.Altitude - prev.Altitude; delta > 0 {
+					metrics.ElevationGain += delta
+				} else {
+					metrics.ElevationLoss -= delta
+				}
+			}
+		}
+		if record.Distance == 0 {
+			record.Distance = metrics.Distance
+		}
+		prev = record
+	}
+
+	if hrCount > 0 {
+		metrics.AvgHeartRate = hrSum / hrCount
+	}
+	if powerCount > 0 {
+		metrics.AvgPower = powerSum / powerCount
+	}
+	if tempCount > 0 {
+		metrics.AvgTemperature = tempSum / float64(tempCount)
+	}
+	return metrics
+}
+
+// haversine returns the great-circle distance in meters between two points
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
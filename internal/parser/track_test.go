@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/models"
+)
+
+func TestHaversine(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 52, 4, 52, 4, 0},
+		{"one degree of latitude", 0, 0, 1, 0, 111195.08},
+		{"one degree of longitude at the equator", 0, 0, 0, 1, 111195.08},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111195.08},
+		{"Amsterdam to Paris", 52.3676, 4.9041, 48.8566, 2.3522, 430000},
+	}
+	for _, tt := range tests {
+		got := haversine(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+		// Within 0.1%, enough to catch a wrong radius or unit
+		if math.Abs(got-tt.want) > tt.want*0.001+0.01 {
+			t.Errorf("%s: haversine = %.2f, want %.2f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTrackSummary(t *testing.T) {
+	start := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	records := []models.Record{
+		{Time: start, Latitude: 0, Longitude: 0, HasPosition: true, Altitude: 100, HasAltitude: true, HeartRate: 120},
+		{Time: start.Add(time.Minute), HeartRate: 0, Temperature: -2, HasTemperature: true},
+		{Time: start.Add(2 * time.Minute), Latitude: 0, Longitude: 0.01, HasPosition: true, Altitude: 90, HasAltitude: true, HeartRate: 150, Power: 250},
+		{Time: start.Add(3 * time.Minute), Latitude: 0, Longitude: 0.02, HasPosition: true, Altitude: 95, HasAltitude: true, Temperature: 4, HasTemperature: true},
+		{Time: start.Add(4 * time.Minute), Distance: 5000},
+	}
+
+	metrics := trackSummary(records)
+	if !metrics.StartTime.Equal(start) || metrics.Duration != 4*time.Minute {
+		t.Errorf("start %v, duration %v; want %v, 4m", metrics.StartTime, metrics.Duration, start)
+	}
+	// Distance only accumulates between consecutive points with a position,
+	// so only the last leg counts
+	leg := haversine(0, 0.01, 0, 0.02)
+	if math.Abs(metrics.Distance-leg) > 0.01 {
+		t.Errorf("distance = %.2f, want %.2f", metrics.Distance, leg)
+	}
+	if metrics.ElevationGain != 5 || metrics.ElevationLoss != 0 {
+		t.Errorf("elevation +%v -%v, want +5 -0 between consecutive altitudes", metrics.ElevationGain, metrics.ElevationLoss)
+	}
+	if metrics.AvgHeartRate != 135 || metrics.MaxHeartRate != 150 || metrics.AvgPower != 250 {
+		t.Errorf("heart rate avg %d max %d, power %d; want 135, 150, 250 ignoring zeros",
+			metrics.AvgHeartRate, metrics.MaxHeartRate, metrics.AvgPower)
+	}
+	if metrics.MinTemperature != -2 || metrics.MaxTemperature != 4 || metrics.AvgTemperature != 1 {
+		t.Errorf("temperature %v/%v/%v, want -2/1/4", metrics.MinTemperature, metrics.AvgTemperature, metrics.MaxTemperature)
+	}
+
+	// Records without a distance get the cumulative track distance;
+	// recorded ones are kept
+	for i, want := range []float64{0, 0, 0, leg, 5000} {
+		if got := metrics.Records[i].Distance; math.Abs(got-want) > 0.01 {
+			t.Errorf("record %d distance = %.2f, want %.2f", i, got, want)
+		}
+	}
+}
+
+func TestTrackSummaryEmpty(t *testing.T) {
+	metrics := trackSummary(nil)
+	if !metrics.StartTime.IsZero() || metrics.Duration != 0 || metrics.Distance != 0 {
+		t.Errorf("trackSummary(nil) = %+v, want zero metrics", metrics)
+	}
+}
@@ -0,0 +1,338 @@
+// internal/processors/influx.go
+package processors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	stdsync "sync"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/models"
+	"github.com/sstent/garminsync-go/internal/sync"
+)
+
+// Influx measurements
+const (
+	MeasurementActivity = "activity"        // one point per activity summary
+	MeasurementRecord   = "activity_record" // one point per record, usually every second
+)
+
+const (
+	defaultInfluxBatchSize  = 5000
+	defaultInfluxMaxRetries = 3
+	influxRetryDelay        = time.Second
+	influxMaxRetryDelay     = 30 * time.Second
+)
+
+// InfluxOptions configures an Influx processor
+type InfluxOptions struct {
+	// Target is "-" for stdout, an http(s) write endpoint such as
+	// http://localhost:8086/api/v2/write?org=me&bucket=garmin or
+	// http://localhost:8086/write?db=garmin, or a file to append to
+	Target string
+
+	// Token, if set, is sent to HTTP endpoints as "Authorization: Token ..."
+	Token string
+
+	// BatchSize is the number of lines per write, default 5000
+	BatchSize int
+
+	// MaxRetries is how often a failed HTTP write is retried, with
+	// exponential backoff, default 3. Only network errors, 429 and 5xx
+	// responses are retried.
+	MaxRetries int
+}
+
+// Influx writes activities as InfluxDB line protocol with nanosecond
+// timestamps: a summary point per activity and a point per record of its
+// file, tagged with activity_id and activity_type.
+type Influx struct {
+	opts       InfluxOptions
+	client     *http.Client
+	retryDelay time.Duration // first retry delay, doubled on each retry
+
+	mu   stdsync.Mutex // serialises writes to out
+	out  io.Writer     // stdout or file targets
+	file *os.File
+}
+
+func NewInflux(opts InfluxOptions) (*Influx, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultInfluxBatchSize
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultInfluxMaxRetries
+	}
+
+	x := &Influx{opts: opts, retryDelay: influxRetryDelay}
+	switch {
+	case opts.Target == "" || opts.Target == "-":
+		x.out = os.Stdout
+	case strings.HasPrefix(opts.Target, "http://") || strings.HasPrefix(opts.Target, "https://"):
+		x.client = &http.Client{}
+	default:
+		f, err := os.OpenFile(opts.Target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		x.out, x.file = f, f
+	}
+	return x, nil
+}
+
+func (x *Influx) Name() string {
+	return "influx"
+}
+
+// Close closes a file target
+func (x *Influx) Close() error {
+	if x.file != nil {
+		return x.file.Close()
+	}
+	return nil
+}
+
+// Process writes the activity summary and its records
+func (x *Influx) Process(ctx context.Context, activity *sync.ProcessedActivity) error {
+	return x.Write(ctx, activity.Activity, activity.Metrics)
+}
+
+// Write encodes an activity and the records of its parsed file, which may
+// be nil, and writes them in batches of BatchSize lines
+func (x *Influx) Write(ctx context.Context, activity *database.Activity, metrics *models.ActivityMetrics) error {
+	var batch bytes.Buffer
+	lines := 0
+	add := func(line []byte) error {
+		batch.Write(line)
+		batch.WriteByte('\n')
+		lines++
+		if lines < x.opts.BatchSize {
+			return nil
+		}
+		err := x.send(ctx, batch.Bytes())
+		batch.Reset()
+		lines = 0
+		return err
+	}
+
+	if err := add(summaryLine(activity)); err != nil {
+		return err
+	}
+	if metrics != nil {
+		tags := recordTags(activity)
+		for i := range metrics.Records {
+			line := recordLine(tags, &metrics.Records[i])
+			if line == nil {
+				continue
+			}
+			if err := add(line); err != nil {
+				return err
+			}
+		}
+	}
+	if lines == 0 {
+		return nil
+	}
+	return x.send(ctx, batch.Bytes())
+}
+
+// send writes one batch to the target
+func (x *Influx) send(ctx context.Context, batch []byte) error {
+	if x.client == nil {
+		x.mu.Lock()
+		defer x.mu.Unlock()
+		_, err := x.out.Write(batch)
+		return err
+	}
+
+	delay := x.retryDelay
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := x.post(ctx, batch)
+		if err == nil || retryAfter < 0 || attempt == x.opts.MaxRetries {
+			return err
+		}
+
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > influxMaxRetryDelay {
+			delay = influxMaxRetryDelay
+		}
+	}
+}
+
+// post sends a batch to the HTTP endpoint. On failure retryAfter is the
+// delay the server asked for, zero if it did not say, or negative if the
+// write must not be retried.
+func (x *Influx) post(ctx context.Context, batch []byte) (retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, x.opts.Target, bytes.NewReader(batch))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if x.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+x.opts.Token)
+	}
+
+	resp, err := x.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return -1, ctx.Err()
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, nil
+	}
+	err = fmt.Errorf("influx returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return -1, err
+	}
+	if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, err
+	}
+	return 0, err
+}
+
+// summaryLine encodes the activity summary point, timestamped with the UTC
+// start time recorded in the file, so it lines up with the record points,
+// or with Garmin's start time for activities without one
+func summaryLine(a *database.Activity) []byte {
+	line := []byte(MeasurementActivity)
+	line = appendTag(line, "activity_id", strconv.Itoa(a.ActivityID))
+	line = appendTag(line, "activity_type", a.ActivityType)
+	line = appendTag(line, "source", a.Source)
+
+	line = append(line, ' ')
+	line = appendStringField(line, "name", a.ActivityName)
+	line = appendIntField(line, "duration", int64(a.Duration))
+	line = appendFloatField(line, "distance", a.Distance)
+	line = appendIntField(line, "max_heart_rate", int64(a.MaxHeartRate))
+	line = appendIntField(line, "avg_heart_rate", int64(a.AvgHeartRate))
+	line = appendFloatField(line, "avg_power", a.AvgPower)
+	line = appendIntField(line, "calories", int64(a.Calories))
+	line = appendIntField(line, "steps", int64(a.Steps))
+	line = appendFloatField(line, "elevation_gain", a.ElevationGain)
+	if a.FileStartTime != nil {
+		return appendTimestamp(line, *a.FileStartTime)
+	}
+	return appendTimestamp(line, a.StartTime)
+}
+
+// recordTags returns the measurement and tags shared by an activity's
+// record points
+func recordTags(a *database.Activity) []byte {
+	tags := []byte(MeasurementRecord)
+	tags = appendTag(tags, "activity_id", strconv.Itoa(a.ActivityID))
+	return appendTag(tags, "activity_type", a.ActivityType)
+}
+
+// recordLine encodes a record point, or returns nil for records without a
+// time. Values the file did not record are left out; heart rate, cadence
+// and power are left out when zero, as the parser uses zero for missing.
+func recordLine(tags []byte, r *models.Record) []byte {
+	if r.Time.IsZero() {
+		return nil
+	}
+
+	line := append(append(make([]byte, 0, len(tags)+200), tags...), ' ')
+	line = appendFloatField(line, "distance", r.Distance)
+	line = appendFloatField(line, "speed", r.Speed)
+	if r.HasPosition {
+		line = appendFloatField(line, "latitude", r.Latitude)
+		line = appendFloatField(line, "longitude", r.Longitude)
+	}
+	if r.HasAltitude {
+		line = appendFloatField(line, "altitude", r.Altitude)
+	}
+	if r.HeartRate > 0 {
+		line = appendIntField(line, "heart_rate", int64(r.HeartRate))
+	}
+	if r.Cadence > 0 {
+		line = appendIntField(line, "cadence", int64(r.Cadence))
+	}
+	if r.Power > 0 {
+		line = appendIntField(line, "power", int64(r.Power))
+	}
+	if r.HasTemperature {
+		line = appendFloatField(line, "temperature", r.Temperature)
+	}
+	return appendTimestamp(line, r.Time)
+}
+
+// Line protocol escaping: tag keys, tag values and field keys escape commas,
+// equals signs and spaces; string field values escape quotes and
+// backslashes. Newlines are not allowed anywhere and become spaces, escaped
+// in keys and tag values.
+var (
+	keyEscaper    = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+	stringEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", " ", "\r", " ")
+)
+
+// appendTag adds a tag; tags with empty values are left out
+func appendTag(line []byte, key, value string) []byte {
+	if value == "" {
+		return line
+	}
+	line = append(line, ',')
+	line = append(line, keyEscaper.Replace(key)...)
+	line = append(line, '=')
+	return append(line, keyEscaper.Replace(value)...)
+}
+
+// fieldKey starts a field. Fields follow the space after the tags and are
+// separated by commas.
+func fieldKey(line []byte, key string) []byte {
+	if line[len(line)-1] != ' ' {
+		line = append(line, ',')
+	}
+	line = append(line, keyEscaper.Replace(key)...)
+	return append(line, '=')
+}
+
+func appendStringField(line []byte, key, value string) []byte {
+	line = fieldKey(line, key)
+	line = append(line, '"')
+	line = append(line, stringEscaper.Replace(value)...)
+	return append(line, '"')
+}
+
+func appendIntField(line []byte, key string, value int64) []byte {
+	line = fieldKey(line, key)
+	line = strconv.AppendInt(line, value, 10)
+	return append(line, 'i')
+}
+
+// appendFloatField adds a float field; NaN and infinities cannot be
+// represented and are left out
+func appendFloatField(line []byte, key string, value float64) []byte {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return line
+	}
+	line = fieldKey(line, key)
+	return strconv.AppendFloat(line, value, 'f', -1, 64)
+}
+
+func appendTimestamp(line []byte, t time.Time) []byte {
+	line = append(line, ' ')
+	return strconv.AppendInt(line, t.UnixNano(), 10)
+}
@@ -0,0 +1,260 @@
+package processors
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	stdsync "sync"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/models"
+)
+
+// influxStub is an httptest write endpoint that answers with the given
+// statuses in turn, then 204, and records each request body
+type influxStub struct {
+	*httptest.Server
+
+	mu         stdsync.Mutex
+	statuses   []int
+	retryAfter string
+	bodies     []string
+	times      []time.Time
+	auth       string
+}
+
+func newInfluxStub(t *testing.T, statuses ...int) *influxStub {
+	t.Helper()
+	stub := &influxStub{statuses: statuses}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		stub.bodies = append(stub.bodies, string(body))
+		stub.times = append(stub.times, time.Now())
+		stub.auth = r.Header.Get("Authorization")
+
+		status := http.StatusNoContent
+		if len(stub.statuses) > 0 {
+			status, stub.statuses = stub.statuses[0], stub.statuses[1:]
+		}
+		if status == http.StatusTooManyRequests && stub.retryAfter != "" {
+			w.Header().Set("Retry-After", stub.retryAfter)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *influxStub) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func newTestInflux(t *testing.T, opts InfluxOptions) *Influx {
+	t.Helper()
+	x, err := NewInflux(opts)
+	if err != nil {
+		t.Fatalf("NewInflux: %v", err)
+	}
+	x.retryDelay = time.Millisecond
+	return x
+}
+
+func testMetrics(records int) *models.ActivityMetrics {
+	start := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	metrics := &models.ActivityMetrics{}
+	for i := 0; i < records; i++ {
+		metrics.Records = append(metrics.Records, models.Record{
+			Time:     start.Add(time.Duration(i) * time.Second),
+			Distance: float64(i) * 3,
+			Speed:    3,
+		})
+	}
+	return metrics
+}
+
+func TestInfluxBatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		records int
+		want    []int // lines per request
+	}{
+		{"summary only", 0, []int{1}},
+		{"exact batches", 5, []int{3, 3}},
+		{"partial last batch", 6, []int{3, 3, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newInfluxStub(t)
+			x := newTestInflux(t, InfluxOptions{Target: stub.URL, Token: "secret", BatchSize: 3})
+			activity := &database.Activity{ActivityID: 1, ActivityType: "running"}
+			if err := x.Write(context.Background(), activity, testMetrics(tt.records)); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			bodies := stub.requests()
+			if len(bodies) != len(tt.want) {
+				t.Fatalf("%d requests, want %d", len(bodies), len(tt.want))
+			}
+			for i, body := range bodies {
+				if n := strings.Count(body, "\n"); n != tt.want[i] || !strings.HasSuffix(body, "\n") {
+					t.Errorf("request %d has %d lines, want %d:\n%s", i, n, tt.want[i], body)
+				}
+			}
+			if !strings.HasPrefix(bodies[0], MeasurementActivity+",") {
+				t.Errorf("first line is not the summary point:\n%s", bodies[0])
+			}
+			if stub.auth != "Token secret" {
+				t.Errorf("Authorization = %q, want %q", stub.auth, "Token secret")
+			}
+		})
+	}
+}
+
+func TestInfluxRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		maxRetries int
+		requests   int
+		wantErr    bool
+	}{
+		{"retries 503", []int{503}, 3, 2, false},
+		{"retries 429", []int{429, 429}, 3, 3, false},
+		{"gives up after MaxRetries", []int{500, 502, 503, 504}, 2, 3, true},
+		{"retries disabled", []int{503}, -1, 1, true},
+		{"no retry on 400", []int{400}, 3, 1, true},
+		{"no retry on 401", []int{401}, 3, 1, true},
+		{"no retry on 404", []int{404}, 3, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newInfluxStub(t, tt.statuses...)
+			x := newTestInflux(t, InfluxOptions{Target: stub.URL, MaxRetries: tt.maxRetries})
+			err := x.Write(context.Background(), &database.Activity{ActivityID: 1}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Write error = %v, want error %v", err, tt.wantErr)
+			}
+
+			bodies := stub.requests()
+			if len(bodies) != tt.requests {
+				t.Fatalf("%d requests, want %d", len(bodies), tt.requests)
+			}
+			for i := 1; i < len(bodies); i++ {
+				if bodies[i] != bodies[0] {
+					t.Errorf("retry %d sent %q, want the same batch %q", i, bodies[i], bodies[0])
+				}
+			}
+		})
+	}
+}
+
+func TestInfluxRetryAfter(t *testing.T) {
+	stub := newInfluxStub(t, http.StatusTooManyRequests)
+	stub.retryAfter = "1"
+	x := newTestInflux(t, InfluxOptions{Target: stub.URL})
+	if err := x.Write(context.Background(), &database.Activity{ActivityID: 1}, nil); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if len(stub.times) != 2 {
+		t.Fatalf("%d requests, want 2", len(stub.times))
+	}
+	if wait := stub.times[1].Sub(stub.times[0]); wait < time.Second {
+		t.Errorf("retried after %v, want at least the 1s Retry-After", wait)
+	}
+}
+
+func TestInfluxRetryCancelled(t *testing.T) {
+	stub := newInfluxStub(t, http.StatusServiceUnavailable)
+	x := newTestInflux(t, InfluxOptions{Target: stub.URL})
+	x.retryDelay = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := x.Write(ctx, &database.Activity{ActivityID: 1}, nil); err != context.DeadlineExceeded {
+		t.Errorf("Write error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSummaryLine(t *testing.T) {
+	local := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	fileStart := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	activity := &database.Activity{
+		ActivityID:    42,
+		ActivityName:  `Say "hi" \ bye` + "\nnow",
+		ActivityType:  "trail running",
+		Source:        database.SourceGarmin,
+		StartTime:     local,
+		Duration:      3600,
+		Distance:      10000.5,
+		MaxHeartRate:  170,
+		AvgHeartRate:  150,
+		Calories:      700,
+		ElevationGain: 120,
+	}
+	fields := `name="Say \"hi\" \\ bye now",duration=3600i,distance=10000.5,max_heart_rate=170i,` +
+		`avg_heart_rate=150i,avg_power=0,calories=700i,steps=0i,elevation_gain=120`
+	tags := `activity,activity_id=42,activity_type=trail\ running,source=garmin`
+
+	want := tags + " " + fields + " " + strconv.FormatInt(local.UnixNano(), 10)
+	if got := string(summaryLine(activity)); got != want {
+		t.Errorf("summaryLine without file start =\n%s\nwant\n%s", got, want)
+	}
+
+	activity.FileStartTime = &fileStart
+	want = tags + " " + fields + " " + strconv.FormatInt(fileStart.UnixNano(), 10)
+	if got := string(summaryLine(activity)); got != want {
+		t.Errorf("summaryLine with file start =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAppendTag(t *testing.T) {
+	tests := []struct {
+		key, value string
+		want       string
+	}{
+		{"activity_type", "running", "m,activity_type=running"},
+		{"activity_type", "", "m"},
+		{"my key", "a,b=c d", `m,my\ key=a\,b\=c\ d`},
+		{"k=1", "x", `m,k\=1=x`},
+		{"name", "line\nbreak\rhere", `m,name=line\ break\ here`},
+		{"path", `C:\dir "x"`, `m,path=C:\dir\ "x"`},
+	}
+	for _, tt := range tests {
+		if got := string(appendTag([]byte("m"), tt.key, tt.value)); got != tt.want {
+			t.Errorf("appendTag(%q, %q) = %s, want %s", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestAppendStringField(t *testing.T) {
+	tests := []struct {
+		line, key, value string
+		want             string
+	}{
+		{"m ", "name", "Morning Run", `m name="Morning Run"`},
+		{"m a=1i", "name", "x", `m a=1i,name="x"`},
+		{"m ", "name", `say "hi"`, `m name="say \"hi\""`},
+		{"m ", "name", `back\slash`, `m name="back\\slash"`},
+		{"m ", "name", "two\nlines\r", `m name="two lines "`},
+		{"m ", "my key,x=y", "v", `m my\ key\,x\=y="v"`},
+		{"m ", "name", "", `m name=""`},
+	}
+	for _, tt := range tests {
+		if got := string(appendStringField([]byte(tt.line), tt.key, tt.value)); got != tt.want {
+			t.Errorf("appendStringField(%q, %q, %q) = %s, want %s", tt.line, tt.key, tt.value, got, tt.want)
+		}
+	}
+}
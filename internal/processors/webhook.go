@@ -0,0 +1,64 @@
+// internal/processors/webhook.go
+package processors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sstent/garminsync-go/internal/sync"
+)
+
+// Webhook posts a JSON notification for every synced activity
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// webhookPayload is the body posted for each activity
+type webhookPayload struct {
+	Event    string      `json:"event"`
+	Outcome  string      `json:"outcome"`
+	Activity interface{} `json:"activity"`
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: &http.Client{}}
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Process posts the stored activity; the request is bounded by ctx
+func (w *Webhook) Process(ctx context.Context, activity *sync.ProcessedActivity) error {
+	body, err := json.Marshal(webhookPayload{
+		Event:    "activity.synced",
+		Outcome:  activity.Outcome,
+		Activity: activity.Activity,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+// internal/scheduler/scheduler.go
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	stdsync "sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/sync"
+)
+
+// ErrInvalidSchedule is returned for cron expressions that cannot be parsed
+var ErrInvalidSchedule = errors.New("invalid cron expression")
+
+// Status is the daemon configuration together with scheduler state
+type Status struct {
+	database.DaemonConfig
+	NextRun *time.Time `json:"next_run,omitempty"`
+}
+
+// Scheduler runs syncs on the schedule stored in daemon_config, plus the
+// named schedules in the schedules table, and can be reconfigured while
+// running.
+type Scheduler struct {
+	db          *database.SQLiteDB
+	syncer      *sync.SyncService
+	coordinator *sync.Coordinator
+	cron        *cron.Cron
+
+	// ctx is cancelled on Stop to interrupt running schedule jobs
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      stdsync.Mutex
+	entry   cron.EntryID
+	running bool
+	entries map[int64]cron.EntryID // named schedules by ID
+	active  map[int64]bool         // named schedules currently running
+}
+
+func New(db *database.SQLiteDB, syncer *sync.SyncService, coordinator *sync.Coordinator) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		db:          db,
+		syncer:      syncer,
+		coordinator: coordinator,
+		cron:        cron.New(),
+		ctx:         ctx,
+		cancel:      cancel,
+		entries:     make(map[int64]cron.EntryID),
+		active:      make(map[int64]bool),
+	}
+}
+
+// ParseSchedule validates a standard five-field cron expression or a
+// descriptor such as @hourly.
+func ParseSchedule(expr string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	return schedule, nil
+}
+
+// Start loads the daemon configuration and starts the scheduler
+func (s *Scheduler) Start() error {
+	config, err := s.db.GetDaemonConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load daemon config: %w", err)
+	}
+
+	schedules, err := s.db.ListSchedules()
+	if err != nil {
+		return fmt.Errorf("failed to load schedules: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.apply(config); err != nil {
+		return err
+	}
+	for i := range schedules {
+		if err := s.register(&schedules[i]); err != nil {
+			log.Printf("Schedule %q not registered: %v", schedules[i].Name, err)
+		}
+	}
+	s.cron.Start()
+	s.running = true
+	return nil
+}
+
+// Stop stops the scheduler and waits for scheduled jobs to return. It does
+// not cancel a sync that is already running.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+
+	s.cancel()
+	<-s.cron.Stop().Done()
+	if err := s.db.SetDaemonStatus(database.DaemonStopped); err != nil {
+		log.Printf("Failed to update daemon status: %v", err)
+	}
+}
+
+// Status returns the stored configuration and the next scheduled run
+func (s *Scheduler) Status() (*Status, error) {
+	config, err := s.db.GetDaemonConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{DaemonConfig: *config}
+	s.mu.Lock()
+	if s.entry != 0 {
+		next := s.cron.Entry(s.entry).Next
+		if !next.IsZero() {
+			status.NextRun = &next
+		}
+	}
+	s.mu.Unlock()
+	return status, nil
+}
+
+// Update validates and stores a new schedule and applies it immediately
+func (s *Scheduler) Update(enabled bool, expr string) (*Status, error) {
+	if _, err := ParseSchedule(expr); err != nil {
+		return nil, err
+	}
+	if err := s.db.UpdateDaemonSchedule(enabled, expr); err != nil {
+		return nil, err
+	}
+
+	config, err := s.db.GetDaemonConfig()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	err = s.apply(config)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.Status()
+}
+
+// apply replaces the registered job with one for the given configuration.
+// s.mu must be held.
+func (s *Scheduler) apply(config *database.DaemonConfig) error {
+	if s.entry != 0 {
+		s.cron.Remove(s.entry)
+		s.entry = 0
+	}
+
+	if !config.Enabled {
+		log.Println("Scheduled sync disabled")
+		return s.setIdleStatus(database.DaemonDisabled, config)
+	}
+
+	schedule, err := ParseSchedule(config.ScheduleCron)
+	if err != nil {
+		return err
+	}
+	s.entry = s.cron.Schedule(schedule, cron.FuncJob(s.runScheduled))
+	log.Printf("Scheduled sync: %s", config.ScheduleCron)
+	return s.setIdleStatus(database.DaemonIdle, config)
+}
+
+// setIdleStatus stores the status unless a scheduled sync is in progress,
+// which will set its own status when it finishes
+func (s *Scheduler) setIdleStatus(status string, config *database.DaemonConfig) error {
+	if config.Status == database.DaemonRunning {
+		if job, ok := s.coordinator.Status(); ok && job.Running() {
+			return nil
+		}
+	}
+	return s.db.SetDaemonStatus(status)
+}
+
+// runScheduled starts a sync through the coordinator and records the run
+// in daemon_config once it finished
+func (s *Scheduler) runScheduled() {
+	log.Println("Starting scheduled sync...")
+	job, err := s.coordinator.Start(sync.Options{Trigger: sync.TriggerCron})
+	if err != nil {
+		log.Printf("Scheduled sync skipped: %v (job %d)", err, job.ID)
+		return
+	}
+
+	if err := s.db.MarkDaemonRun(job.StartedAt); err != nil {
+		log.Printf("Failed to update daemon status: %v", err)
+	}
+
+	job, _ = s.coordinator.Wait(job.ID)
+
+	status := database.DaemonIdle
+	if job.Phase == sync.PhaseFailed {
+		status = database.DaemonFailed
+	}
+	s.mu.Lock()
+	if !s.running {
+		status = database.DaemonStopped
+	}
+	s.mu.Unlock()
+	if err := s.db.SetDaemonStatus(status); err != nil {
+		log.Printf("Failed to update daemon status: %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package scheduler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/garmin"
+	"github.com/sstent/garminsync-go/internal/sync"
+)
+
+// Schedules used by the tests only fire on New Year's Day and Christmas,
+// so cron never runs a job while a test is running
+const (
+	newYear   = "0 0 1 1 *"
+	christmas = "0 12 25 12 *"
+)
+
+// newTestScheduler returns a scheduler over a temporary database whose
+// syncs list no activities from a stub Garmin server
+func newTestScheduler(t *testing.T) (*Scheduler, *database.SQLiteDB) {
+	t.Helper()
+	t.Setenv("GARMIN_EMAIL", "athlete@example.com")
+	t.Setenv("GARMIN_PASSWORD", "secret")
+
+	dir := t.TempDir()
+	db, err := database.NewSQLiteDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	t.Cleanup(server.Close)
+	client := garmin.NewClient()
+	client.SetBaseURL(server.URL)
+
+	syncer := sync.NewSyncService(client, db, dir)
+	return New(db, syncer, sync.NewCoordinator(syncer)), db
+}
+
+// startScheduler starts s with the given daemon schedule and stops it when
+// the test ends
+func startScheduler(t *testing.T, s *Scheduler, enabled bool, expr string) {
+	t.Helper()
+	if err := s.db.UpdateDaemonSchedule(enabled, expr); err != nil {
+		t.Fatalf("UpdateDaemonSchedule: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(s.Stop)
+}
+
+// nextRun is when the cron expression fires next after now
+func nextRun(t *testing.T, expr string) time.Time {
+	t.Helper()
+	schedule, err := ParseSchedule(expr)
+	if err != nil {
+		t.Fatalf("ParseSchedule(%q): %v", expr, err)
+	}
+	return schedule.Next(time.Now())
+}
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		expr  string
+		valid bool
+	}{
+		{"0 * * * *", true},
+		{"*/15 6-22 * * 1-5", true},
+		{"@hourly", true},
+		{"@every 90m", true},
+		{"", false},
+		{"* * * *", false},
+		{"0 0 * * * *", false},
+		{"61 * * * *", false},
+		{"@fortnightly", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseSchedule(tt.expr)
+		if tt.valid && err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.expr, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("ParseSchedule(%q) = %v, want ErrInvalidSchedule", tt.expr, err)
+		}
+	}
+}
+
+func TestSchedulerStartLoadsConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		wantStatus string
+		wantNext   bool
+	}{
+		{"enabled", true, database.DaemonIdle, true},
+		{"disabled", false, database.DaemonDisabled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestScheduler(t)
+			startScheduler(t, s, tt.enabled, newYear)
+
+			status, err := s.Status()
+			if err != nil {
+				t.Fatalf("Status: %v", err)
+			}
+			if status.Enabled != tt.enabled || status.ScheduleCron != newYear || status.Status != tt.wantStatus {
+				t.Errorf("Status = %+v, want enabled %v, %q, %s", status, tt.enabled, newYear, tt.wantStatus)
+			}
+			if tt.wantNext && (status.NextRun == nil || !status.NextRun.Equal(nextRun(t, newYear))) {
+				t.Errorf("NextRun = %v, want %v", status.NextRun, nextRun(t, newYear))
+			}
+			if !tt.wantNext && status.NextRun != nil {
+				t.Errorf("NextRun = %v, want none", status.NextRun)
+			}
+		})
+	}
+}
+
+func TestSchedulerStartRejectsStoredInvalidCron(t *testing.T) {
+	s, db := newTestScheduler(t)
+	if err := db.UpdateDaemonSchedule(true, "not a schedule"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("Start = %v, want ErrInvalidSchedule", err)
+	}
+}
+
+func TestSchedulerUpdateReregisters(t *testing.T) {
+	s, db := newTestScheduler(t)
+	startScheduler(t, s, true, newYear)
+
+	status, err := s.Update(true, christmas)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if status.NextRun == nil || !status.NextRun.Equal(nextRun(t, christmas)) {
+		t.Errorf("NextRun = %v, want %v", status.NextRun, nextRun(t, christmas))
+	}
+	if n := len(s.cron.Entries()); n != 1 {
+		t.Errorf("%d cron entries, want the old one replaced", n)
+	}
+
+	// An invalid expression leaves the stored and registered schedule alone
+	if _, err := s.Update(true, "* * *"); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("Update with invalid cron = %v, want ErrInvalidSchedule", err)
+	}
+	config, err := db.GetDaemonConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ScheduleCron != christmas || len(s.cron.Entries()) != 1 {
+		t.Errorf("after invalid update: cron %q, %d entries; want %q, 1", config.ScheduleCron, len(s.cron.Entries()), christmas)
+	}
+
+	status, err = s.Update(false, christmas)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if status.Enabled || status.Status != database.DaemonDisabled || status.NextRun != nil {
+		t.Errorf("Status = %+v, want disabled without a next run", status)
+	}
+	if n := len(s.cron.Entries()); n != 0 {
+		t.Errorf("%d cron entries after disabling, want 0", n)
+	}
+}
+
+func TestRunScheduledRecordsRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		wantStatus string
+	}{
+		{"succeeded", "secret", database.DaemonIdle},
+		{"failed", "", database.DaemonFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newTestScheduler(t)
+			t.Setenv("GARMIN_PASSWORD", tt.password)
+			startScheduler(t, s, true, newYear)
+
+			before := time.Now().Add(-time.Second)
+			s.runScheduled()
+
+			config, err := db.GetDaemonConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", config.Status, tt.wantStatus)
+			}
+			if config.LastRun == nil || config.LastRun.Before(before) {
+				t.Errorf("last_run = %v, want the start of this run", config.LastRun)
+			}
+			job, ok := s.coordinator.Status()
+			if !ok || job.Trigger != sync.TriggerCron {
+				t.Errorf("coordinator job = %+v, %v; want a cron-triggered sync", job, ok)
+			}
+		})
+	}
+}
+
+func TestStopRecordsStoppedStatus(t *testing.T) {
+	s, db := newTestScheduler(t)
+	if err := db.UpdateDaemonSchedule(true, newYear); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	s.Stop()
+
+	config, err := db.GetDaemonConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Status != database.DaemonStopped {
+		t.Errorf("status = %q, want %q", config.Status, database.DaemonStopped)
+	}
+}
@@ -0,0 +1,355 @@
+// internal/scheduler/schedules.go
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/export"
+	"github.com/sstent/garminsync-go/internal/sync"
+)
+
+// Job kinds of named schedules
+const (
+	KindIncremental = "incremental" // incremental sync
+	KindFull        = "full"        // sync listing the whole account
+	KindReconcile   = "reconcile"   // detect activities deleted on Garmin Connect
+	KindVerify      = "verify"      // archive integrity check
+	KindWellness    = "wellness"    // daily stats fetch
+	KindBackup      = "backup"      // database backup
+	KindParquet     = "parquet"     // Parquet export for analytics
+)
+
+var kinds = []string{KindIncremental, KindFull, KindReconcile, KindVerify, KindWellness, KindBackup, KindParquet}
+
+var (
+	// ErrInvalidScheduleConfig is returned for schedules with a bad name,
+	// kind or parameters
+	ErrInvalidScheduleConfig = errors.New("invalid schedule")
+	// ErrScheduleRunning is returned when a schedule is triggered while a
+	// previous run of it has not finished
+	ErrScheduleRunning = errors.New("schedule is already running")
+)
+
+// Schedule run states besides running, succeeded and failed
+const runSkipped = "skipped"
+
+// JobParams are the parameters a schedule can pass to its job. Each kind
+// only looks at its own fields.
+type JobParams struct {
+	Repair *bool `json:"repair,omitempty"` // verify: re-download missing or corrupt files, default true
+	Days   int   `json:"days,omitempty"`   // wellness: days to fetch, today included, default 1
+	Keep   int   `json:"keep,omitempty"`   // backup: backups to keep, default 7
+
+	Dir      string   `json:"dir,omitempty"`      // parquet: output directory, default <data dir>/parquet
+	Datasets []string `json:"datasets,omitempty"` // parquet: activities, laps and/or records, default all
+}
+
+// ScheduleStatus is a named schedule together with its scheduler state
+type ScheduleStatus struct {
+	database.Schedule
+	NextRun *time.Time `json:"next_run,omitempty"`
+	Running bool       `json:"running"`
+}
+
+// ParseParams decodes and validates the parameters of a schedule
+func ParseParams(raw json.RawMessage) (*JobParams, error) {
+	var params JobParams
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return &params, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&params); err != nil {
+		return nil, fmt.Errorf("%w: params: %v", ErrInvalidScheduleConfig, err)
+	}
+	if params.Days < 0 || params.Keep < 0 {
+		return nil, fmt.Errorf("%w: params must not be negative", ErrInvalidScheduleConfig)
+	}
+	if err := export.ValidateDatasets(params.Datasets); err != nil {
+		return nil, fmt.Errorf("%w: params: %v", ErrInvalidScheduleConfig, err)
+	}
+	return &params, nil
+}
+
+// ValidateSchedule checks the name, kind, cron expression and parameters
+// of a schedule
+func ValidateSchedule(schedule *database.Schedule) error {
+	schedule.Name = strings.TrimSpace(schedule.Name)
+	if schedule.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidScheduleConfig)
+	}
+
+	known := false
+	for _, kind := range kinds {
+		if schedule.Kind == kind {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("%w: unknown kind %q (expected one of %s)",
+			ErrInvalidScheduleConfig, schedule.Kind, strings.Join(kinds, ", "))
+	}
+
+	if _, err := ParseSchedule(schedule.ScheduleCron); err != nil {
+		return err
+	}
+	_, err := ParseParams(schedule.Params)
+	return err
+}
+
+// Schedules returns all named schedules with their next run times
+func (s *Scheduler) Schedules() ([]ScheduleStatus, error) {
+	schedules, err := s.db.ListSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]ScheduleStatus, len(schedules))
+	for i := range schedules {
+		statuses[i] = s.scheduleStatus(&schedules[i])
+	}
+	return statuses, nil
+}
+
+// Schedule returns a named schedule with its next run time
+func (s *Scheduler) Schedule(id int64) (*ScheduleStatus, error) {
+	schedule, err := s.db.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.scheduleStatus(schedule)
+	return &status, nil
+}
+
+// CreateSchedule validates, stores and registers a new schedule
+func (s *Scheduler) CreateSchedule(schedule *database.Schedule) (*ScheduleStatus, error) {
+	if err := ValidateSchedule(schedule); err != nil {
+		return nil, err
+	}
+	if err := s.db.CreateSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.register(schedule); err != nil {
+		return nil, err
+	}
+	status := s.scheduleStatus(schedule)
+	return &status, nil
+}
+
+// UpdateSchedule validates and stores a changed schedule and re-registers
+// it. A run in progress is not interrupted.
+func (s *Scheduler) UpdateSchedule(schedule *database.Schedule) (*ScheduleStatus, error) {
+	if err := ValidateSchedule(schedule); err != nil {
+		return nil, err
+	}
+	if err := s.db.UpdateSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.register(schedule); err != nil {
+		return nil, err
+	}
+	status := s.scheduleStatus(schedule)
+	return &status, nil
+}
+
+// DeleteSchedule unregisters and removes a schedule and its history
+func (s *Scheduler) DeleteSchedule(id int64) error {
+	if err := s.db.DeleteSchedule(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[id]; ok {
+		s.cron.Remove(entry)
+		delete(s.entries, id)
+	}
+	return nil
+}
+
+// TriggerSchedule runs a schedule now, in the background, and returns the
+// recorded run
+func (s *Scheduler) TriggerSchedule(id int64) (*database.ScheduleRun, error) {
+	schedule, err := s.db.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := s.beginRun(schedule, sync.TriggerAPI)
+	if err != nil {
+		return nil, err
+	}
+	go s.executeRun(schedule, run)
+	return run, nil
+}
+
+// register replaces the cron entry of a schedule. s.mu must be held.
+func (s *Scheduler) register(schedule *database.Schedule) error {
+	if entry, ok := s.entries[schedule.ID]; ok {
+		s.cron.Remove(entry)
+		delete(s.entries, schedule.ID)
+	}
+	if !schedule.Enabled {
+		return nil
+	}
+
+	spec, err := ParseSchedule(schedule.ScheduleCron)
+	if err != nil {
+		return err
+	}
+	id := schedule.ID
+	s.entries[id] = s.cron.Schedule(spec, cron.FuncJob(func() {
+		s.runNamed(id)
+	}))
+	return nil
+}
+
+// scheduleStatus adds scheduler state to a schedule. s.mu must be held.
+func (s *Scheduler) scheduleStatus(schedule *database.Schedule) ScheduleStatus {
+	status := ScheduleStatus{Schedule: *schedule, Running: s.active[schedule.ID]}
+	if entry, ok := s.entries[schedule.ID]; ok {
+		if next := s.cron.Entry(entry).Next; !next.IsZero() {
+			status.NextRun = &next
+		}
+	}
+	return status
+}
+
+// runNamed is the cron job of a named schedule
+func (s *Scheduler) runNamed(id int64) {
+	schedule, err := s.db.GetSchedule(id)
+	if err != nil {
+		log.Printf("Schedule %d not run: %v", id, err)
+		return
+	}
+
+	log.Printf("Starting schedule %q (%s)...", schedule.Name, schedule.Kind)
+	run, err := s.beginRun(schedule, sync.TriggerCron)
+	if err != nil {
+		log.Printf("Schedule %q skipped: %v", schedule.Name, err)
+		return
+	}
+	s.executeRun(schedule, run)
+}
+
+// beginRun marks a schedule active and records the start of its run
+func (s *Scheduler) beginRun(schedule *database.Schedule, trigger string) (*database.ScheduleRun, error) {
+	s.mu.Lock()
+	if s.active[schedule.ID] {
+		s.mu.Unlock()
+		return nil, ErrScheduleRunning
+	}
+	s.active[schedule.ID] = true
+	s.mu.Unlock()
+
+	run, err := s.db.CreateScheduleRun(schedule.ID, trigger)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.active, schedule.ID)
+		s.mu.Unlock()
+		return nil, err
+	}
+	return run, nil
+}
+
+// executeRun runs the job of a schedule and records its outcome
+func (s *Scheduler) executeRun(schedule *database.Schedule, run *database.ScheduleRun) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.active, schedule.ID)
+		s.mu.Unlock()
+	}()
+
+	result, err := s.runJob(schedule, run.Trigger)
+	run.Status = "succeeded"
+	switch {
+	case errors.Is(err, sync.ErrSyncInProgress), errors.Is(err, sync.ErrJobRunning):
+		run.Status = runSkipped
+		run.Error = err.Error()
+	case err != nil:
+		run.Status = "failed"
+		run.Error = err.Error()
+	}
+	if result != nil {
+		if data, err := json.Marshal(result); err == nil {
+			run.Result = data
+		}
+	}
+
+	if err := s.db.FinishScheduleRun(run); err != nil {
+		log.Printf("Failed to record run of schedule %q: %v", schedule.Name, err)
+	}
+	if err != nil {
+		log.Printf("Schedule %q %s: %v", schedule.Name, run.Status, err)
+	}
+}
+
+// runJob dispatches to the job of a schedule kind
+func (s *Scheduler) runJob(schedule *database.Schedule, trigger string) (interface{}, error) {
+	params, err := ParseParams(schedule.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	switch schedule.Kind {
+	case KindIncremental, KindFull:
+		mode := sync.ModeIncremental
+		if schedule.Kind == KindFull {
+			mode = sync.ModeFull
+		}
+		return s.runSync(sync.Options{Trigger: trigger, Mode: mode})
+	case KindReconcile:
+		return s.syncer.Reconcile(s.ctx)
+	case KindVerify:
+		repair := params.Repair == nil || *params.Repair
+		return s.syncer.Verify(s.ctx, sync.VerifyOptions{Repair: repair})
+	case KindWellness:
+		return s.syncer.SyncWellness(s.ctx, params.Days)
+	case KindBackup:
+		return s.syncer.Backup(params.Keep)
+	case KindParquet:
+		return s.syncer.ExportParquet(s.ctx, params.Dir, params.Datasets)
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidScheduleConfig, schedule.Kind)
+	}
+}
+
+// runSync starts a sync through the coordinator and waits for it
+func (s *Scheduler) runSync(opts sync.Options) (*sync.Job, error) {
+	job, err := s.coordinator.Start(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	id := job.ID
+	job, ok := s.coordinator.Wait(id)
+	if !ok {
+		// Another sync replaced it first, so its outcome is gone
+		return nil, fmt.Errorf("outcome of sync job %d is unknown: a later sync replaced it", id)
+	}
+	if job.Error != "" {
+		return &job, errors.New(job.Error)
+	}
+	return &job, nil
+}
@@ -0,0 +1,230 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/sync"
+)
+
+func TestParseParams(t *testing.T) {
+	repair := false
+	tests := []struct {
+		raw     string
+		want    JobParams
+		wantErr bool
+	}{
+		{"", JobParams{}, false},
+		{"  ", JobParams{}, false},
+		{"{}", JobParams{}, false},
+		{`{"repair": false}`, JobParams{Repair: &repair}, false},
+		{`{"days": 7, "keep": 3}`, JobParams{Days: 7, Keep: 3}, false},
+		{`{"dir": "/exports", "datasets": ["laps", "records"]}`, JobParams{Dir: "/exports", Datasets: []string{"laps", "records"}}, false},
+		{`{"days": -1}`, JobParams{}, true},
+		{`{"keep": -2}`, JobParams{}, true},
+		{`{"datasets": ["sleep"]}`, JobParams{}, true},
+		{`{"day": 7}`, JobParams{}, true},
+		{`{"days": "7"}`, JobParams{}, true},
+		{`[1]`, JobParams{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseParams(json.RawMessage(tt.raw))
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidScheduleConfig) {
+				t.Errorf("ParseParams(%s) = %+v, %v; want ErrInvalidScheduleConfig", tt.raw, got, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("ParseParams(%s) = %+v, %v; want %+v", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule database.Schedule
+		wantErr  error
+	}{
+		{"valid", database.Schedule{Name: "nightly", Kind: KindFull, ScheduleCron: "0 3 * * *"}, nil},
+		{"valid with params", database.Schedule{Name: "backup", Kind: KindBackup, ScheduleCron: "@daily", Params: json.RawMessage(`{"keep": 3}`)}, nil},
+		{"missing name", database.Schedule{Name: "  ", Kind: KindFull, ScheduleCron: "@daily"}, ErrInvalidScheduleConfig},
+		{"unknown kind", database.Schedule{Name: "x", Kind: "sleep", ScheduleCron: "@daily"}, ErrInvalidScheduleConfig},
+		{"missing kind", database.Schedule{Name: "x", ScheduleCron: "@daily"}, ErrInvalidScheduleConfig},
+		{"invalid cron", database.Schedule{Name: "x", Kind: KindVerify, ScheduleCron: "daily"}, ErrInvalidSchedule},
+		{"invalid params", database.Schedule{Name: "x", Kind: KindWellness, ScheduleCron: "@daily", Params: json.RawMessage(`{"days": -1}`)}, ErrInvalidScheduleConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSchedule(&tt.schedule)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("ValidateSchedule: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateSchedule = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	schedule := database.Schedule{Name: "  nightly ", Kind: KindFull, ScheduleCron: "@daily"}
+	if err := ValidateSchedule(&schedule); err != nil || schedule.Name != "nightly" {
+		t.Errorf("ValidateSchedule left name %q, %v; want it trimmed", schedule.Name, err)
+	}
+}
+
+func TestScheduleRegistration(t *testing.T) {
+	s, db := newTestScheduler(t)
+	stored := &database.Schedule{Name: "stored", Kind: KindVerify, ScheduleCron: christmas, Enabled: true}
+	if err := db.CreateSchedule(stored); err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+	startScheduler(t, s, false, newYear)
+
+	// Schedules stored before Start are registered by it
+	status, err := s.Schedule(stored.ID)
+	if err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	if status.NextRun == nil || !status.NextRun.Equal(nextRun(t, christmas)) {
+		t.Errorf("stored schedule NextRun = %v, want %v", status.NextRun, nextRun(t, christmas))
+	}
+
+	created, err := s.CreateSchedule(&database.Schedule{Name: "backup", Kind: KindBackup, ScheduleCron: newYear, Enabled: true})
+	if err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+	if created.NextRun == nil || !created.NextRun.Equal(nextRun(t, newYear)) {
+		t.Errorf("created schedule NextRun = %v, want %v", created.NextRun, nextRun(t, newYear))
+	}
+	if n := len(s.cron.Entries()); n != 2 {
+		t.Errorf("%d cron entries, want 2", n)
+	}
+
+	// Changing the cron re-registers, disabling unregisters
+	schedule := created.Schedule
+	schedule.ScheduleCron = christmas
+	updated, err := s.UpdateSchedule(&schedule)
+	if err != nil {
+		t.Fatalf("UpdateSchedule: %v", err)
+	}
+	if updated.NextRun == nil || !updated.NextRun.Equal(nextRun(t, christmas)) || len(s.cron.Entries()) != 2 {
+		t.Errorf("after update: NextRun %v, %d entries; want %v, 2", updated.NextRun, len(s.cron.Entries()), nextRun(t, christmas))
+	}
+	schedule.Enabled = false
+	if updated, err = s.UpdateSchedule(&schedule); err != nil || updated.NextRun != nil || len(s.cron.Entries()) != 1 {
+		t.Errorf("after disabling: %+v, %v, %d entries; want no next run, 1 entry", updated, err, len(s.cron.Entries()))
+	}
+
+	// An invalid update is rejected before anything is stored
+	schedule.Enabled = true
+	schedule.ScheduleCron = "never"
+	if _, err := s.UpdateSchedule(&schedule); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("UpdateSchedule with invalid cron = %v, want ErrInvalidSchedule", err)
+	}
+	if got, err := db.GetSchedule(schedule.ID); err != nil || got.ScheduleCron != christmas || got.Enabled {
+		t.Errorf("stored schedule = %+v, %v; want the last valid version", got, err)
+	}
+
+	if err := s.DeleteSchedule(stored.ID); err != nil {
+		t.Fatalf("DeleteSchedule: %v", err)
+	}
+	if n := len(s.cron.Entries()); n != 0 {
+		t.Errorf("%d cron entries after delete, want 0", n)
+	}
+	if err := s.DeleteSchedule(stored.ID); !errors.Is(err, database.ErrScheduleNotFound) {
+		t.Errorf("second DeleteSchedule = %v, want ErrScheduleNotFound", err)
+	}
+}
+
+func TestScheduleRunHistory(t *testing.T) {
+	s, db := newTestScheduler(t)
+	schedule := &database.Schedule{Name: "hourly", Kind: KindIncremental, ScheduleCron: newYear}
+	if err := db.CreateSchedule(schedule); err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+
+	// A cron run succeeds and stores the sync job as its result
+	s.runNamed(schedule.ID)
+
+	// A triggered run fails without credentials and records the error
+	t.Setenv("GARMIN_PASSWORD", "")
+	run, err := s.TriggerSchedule(schedule.ID)
+	if err != nil {
+		t.Fatalf("TriggerSchedule: %v", err)
+	}
+	if run.Status != "running" || run.Trigger != sync.TriggerAPI {
+		t.Errorf("triggered run = %+v, want running from the API", run)
+	}
+	runs := waitForRuns(t, db, schedule.ID)
+
+	if len(runs) != 2 {
+		t.Fatalf("%d runs, want 2", len(runs))
+	}
+	failed, succeeded := runs[0], runs[1]
+	if succeeded.Trigger != sync.TriggerCron || succeeded.Status != "succeeded" || succeeded.Error != "" {
+		t.Errorf("cron run = %+v, want succeeded", succeeded)
+	}
+	var job sync.Job
+	if err := json.Unmarshal(succeeded.Result, &job); err != nil || job.Phase != sync.PhaseFinished || job.Trigger != sync.TriggerCron {
+		t.Errorf("cron run result = %s, %v; want the finished sync job", succeeded.Result, err)
+	}
+	if failed.ID != run.ID || failed.Status != "failed" || failed.Error == "" {
+		t.Errorf("triggered run = %+v, want failed with an error", failed)
+	}
+}
+
+func TestTriggerScheduleWhileRunning(t *testing.T) {
+	s, db := newTestScheduler(t)
+	schedule := &database.Schedule{Name: "backup", Kind: KindBackup, ScheduleCron: newYear}
+	if err := db.CreateSchedule(schedule); err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+
+	s.mu.Lock()
+	s.active[schedule.ID] = true
+	s.mu.Unlock()
+	if _, err := s.TriggerSchedule(schedule.ID); !errors.Is(err, ErrScheduleRunning) {
+		t.Errorf("TriggerSchedule while running = %v, want ErrScheduleRunning", err)
+	}
+	if status, err := s.Schedule(schedule.ID); err != nil || !status.Running {
+		t.Errorf("Schedule = %+v, %v; want it reported as running", status, err)
+	}
+	if runs, err := db.ListScheduleRuns(schedule.ID, 10); err != nil || len(runs) != 0 {
+		t.Errorf("runs = %+v, %v; want none recorded", runs, err)
+	}
+
+	if _, err := s.TriggerSchedule(schedule.ID + 1); !errors.Is(err, database.ErrScheduleNotFound) {
+		t.Errorf("TriggerSchedule of a missing schedule = %v, want ErrScheduleNotFound", err)
+	}
+}
+
+// waitForRuns waits until no run of the schedule is still running and
+// returns its runs, newest first
+func waitForRuns(t *testing.T, db *database.SQLiteDB, scheduleID int64) []database.ScheduleRun {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runs, err := db.ListScheduleRuns(scheduleID, 10)
+		if err != nil {
+			t.Fatalf("ListScheduleRuns: %v", err)
+		}
+		finished := true
+		for _, run := range runs {
+			if run.FinishedAt == nil {
+				finished = false
+			}
+		}
+		if finished {
+			return runs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("runs still running: %+v", runs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
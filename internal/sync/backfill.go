@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/parser"
+)
+
+// OutcomeBackfill is the ProcessedActivity outcome of activities replayed
+// from the archive by Backfill
+const OutcomeBackfill = "backfill"
+
+// maxBackfillErrors caps the error messages kept in a report
+const maxBackfillErrors = 100
+
+// BackfillOptions selects the stored activities to replay through a
+// processor
+type BackfillOptions struct {
+	ActivityType string
+
+	// From and To limit the backfill to activities starting in [From, To),
+	// as returned by ParseWindow. A zero bound is open.
+	From time.Time
+	To   time.Time
+
+	// Timeout bounds each call to the processor, as for AddProcessor
+	Timeout time.Duration
+
+	// Progress, if set, is called after each activity with the report so
+	// far
+	Progress func(BackfillReport)
+}
+
+// BackfillReport describes a finished backfill
+type BackfillReport struct {
+	Processor  string    `json:"processor"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Total      int       `json:"total"`
+	Processed  int       `json:"processed"`
+	Failed     int       `json:"failed"`
+	Errors     []string  `json:"errors"`
+}
+
+// Backfill passes already stored activities through a processor, oldest
+// first, as if they had just been synced. It lets a processor added later,
+// such as a time-series exporter, catch up with the archive. Source is nil
+// and Outcome is OutcomeBackfill for every activity. Activities whose files
+// cannot be read, or that the processor rejects, are counted as failed
+// without stopping the backfill. Nothing is printed, so a processor may
+// write to stdout.
+func (s *SyncService) Backfill(ctx context.Context, processor Processor, opts BackfillOptions) (*BackfillReport, error) {
+	downloaded := true
+	filters := database.ActivityFilters{
+		ActivityType: opts.ActivityType,
+		Downloaded:   &downloaded,
+		SortOrder:    "asc",
+	}
+	if !opts.From.IsZero() {
+		filters.DateFrom = &opts.From
+	}
+	if !opts.To.IsZero() {
+		// DateTo is inclusive, the window end is not
+		to := opts.To.Add(-time.Second)
+		filters.DateTo = &to
+	}
+
+	report := &BackfillReport{Processor: processor.Name(), StartedAt: time.Now(), Errors: []string{}}
+	count := filters
+	count.Limit = 1
+	page, err := s.db.ListActivities(count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count activities: %w", err)
+	}
+	report.Total = page.Total
+
+	rp := registeredProcessor{processor: processor, timeout: opts.Timeout}
+	if rp.timeout <= 0 {
+		rp.timeout = defaultProcessorTimeout
+	}
+	fileParser := parser.NewParser()
+	err = s.db.EachActivity(filters, func(activity *database.Activity) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := s.backfillActivity(ctx, rp, fileParser, activity)
+		report.Processed++
+		if err != nil {
+			report.Failed++
+			if len(report.Errors) < maxBackfillErrors {
+				report.Errors = append(report.Errors, fmt.Sprintf("activity %d: %v", activity.ActivityID, err))
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(*report)
+		}
+		return nil
+	})
+	report.FinishedAt = time.Now()
+	if err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func (s *SyncService) backfillActivity(ctx context.Context, rp registeredProcessor, fileParser *parser.Parser, activity *database.Activity) error {
+	data, err := os.ReadFile(activity.Filename)
+	if err != nil {
+		return err
+	}
+	metrics, err := fileParser.ParseData(data)
+	if err != nil {
+		return err
+	}
+	return runProcessor(ctx, rp, &ProcessedActivity{
+		Activity: activity,
+		Data:     data,
+		Metrics:  metrics,
+		Outcome:  OutcomeBackfill,
+	})
+}
@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// defaultBackupKeep is how many database backups are kept when no limit is
+// given
+const defaultBackupKeep = 7
+
+// BackupResult describes a database backup
+type BackupResult struct {
+	Path    string   `json:"path"`
+	Size    int64    `json:"size"`
+	Removed []string `json:"removed,omitempty"` // older backups pruned
+}
+
+// Backup writes a copy of the database to dataDir/backups and removes all
+// but the newest keep backups.
+func (s *SyncService) Backup(keep int) (*BackupResult, error) {
+	if keep <= 0 {
+		keep = defaultBackupKeep
+	}
+
+	dir := filepath.Join(s.dataDir, "backups")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("garminsync-%s.db", time.Now().UTC().Format("20060102-150405")))
+	if err := s.db.Backup(path); err != nil {
+		return nil, fmt.Errorf("backup failed: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	result := &BackupResult{Path: path, Size: info.Size()}
+	fmt.Printf("✅ Database backed up to %s\n", path)
+
+	// Timestamped names sort oldest first
+	matches, err := filepath.Glob(filepath.Join(dir, "garminsync-*.db"))
+	if err != nil {
+		return result, err
+	}
+	sort.Strings(matches)
+	for i := 0; i < len(matches)-keep; i++ {
+		if err := os.Remove(matches[i]); err != nil {
+			return result, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		result.Removed = append(result.Removed, matches[i])
+	}
+	return result, nil
+}
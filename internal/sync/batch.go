@@ -0,0 +1,180 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/garmin"
+	"github.com/sstent/garminsync-go/internal/models"
+)
+
+// writeBatchSize is the number of activities committed per transaction
+const writeBatchSize = 20
+
+// tempSuffix marks files that were staged but not yet committed
+const tempSuffix = ".tmp"
+
+// backupSuffix marks the previous file of an updated activity, kept until
+// the batch that replaces it has committed
+const backupSuffix = ".bak"
+
+// stagedActivity is a downloaded and parsed activity waiting to be committed
+type stagedActivity struct {
+	source   *garmin.GarminActivity
+	activity *database.Activity
+	tempPath string // file written next to activity.Filename
+	data     []byte // file content, handed to processors after commit
+	metrics  *models.ActivityMetrics
+	replaces *database.Activity // imported copy of the activity, deleted by the commit
+}
+
+// writeTempFile writes data to a temporary sibling of filename and flushes it
+// to disk, so a later rename is the only step left to publish it.
+func writeTempFile(filename string, data []byte) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return "", fmt.Errorf("directory creation failed: %w", err)
+	}
+
+	tempPath := filename + tempSuffix
+	f, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", fmt.Errorf("file write failed: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return "", fmt.Errorf("file write failed: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return "", fmt.Errorf("file write failed: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("file write failed: %w", err)
+	}
+	return tempPath, nil
+}
+
+// commitBatch writes a batch of staged activities in one transaction.
+//
+// Rows are upserted first, then every staged file is renamed into place, and
+// only then is the transaction committed. The file an updated activity had
+// before is moved to a backup first and only deleted after the commit, so a
+// failed commit can restore the archive to match the old rows. A crash
+// between the renames and the commit leaves files without rows and backups
+// behind, which Recover sorts out on the next start. An imported copy an
+// activity replaces loses its row in the same transaction and its file once
+// committed.
+func (s *SyncService) commitBatch(batch []*stagedActivity) ([]syncOutcome, error) {
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	discard := func() {
+		for _, staged := range batch {
+			os.Remove(staged.tempPath)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		discard()
+		return nil, &stageError{StageDB, fmt.Errorf("database error: %w", err)}
+	}
+
+	outcomes := make([]syncOutcome, len(batch))
+	for i, staged := range batch {
+		created, err := tx.UpsertActivity(staged.activity)
+		if err != nil {
+			tx.Rollback()
+			discard()
+			return nil, &stageError{StageDB, fmt.Errorf("database error: activity %d: %w", staged.activity.ActivityID, err)}
+		}
+		if err := tx.ReplaceLaps(staged.activity.ActivityID, lapRows(staged.activity.ActivityID, staged.metrics)); err != nil {
+			tx.Rollback()
+			discard()
+			return nil, &stageError{StageDB, fmt.Errorf("database error: activity %d laps: %w", staged.activity.ActivityID, err)}
+		}
+		if staged.replaces != nil {
+			if err := tx.DeleteActivity(staged.replaces.ActivityID); err != nil {
+				tx.Rollback()
+				discard()
+				return nil, &stageError{StageDB, fmt.Errorf("database error: activity %d: %w", staged.replaces.ActivityID, err)}
+			}
+		}
+		outcomes[i] = outcomeUpdated
+		if created {
+			outcomes[i] = outcomeCreated
+		}
+	}
+
+	backups := make([]string, len(batch))
+	for i, staged := range batch {
+		if outcomes[i] == outcomeUpdated {
+			backup, err := backupFile(staged.activity.Filename)
+			if err != nil {
+				tx.Rollback()
+				discard()
+				restoreFiles(batch[:i], backups)
+				return nil, &stageError{StageFile, fmt.Errorf("file backup failed: %w", err)}
+			}
+			backups[i] = backup
+		}
+		if err := os.Rename(staged.tempPath, staged.activity.Filename); err != nil {
+			tx.Rollback()
+			discard()
+			if backups[i] != "" {
+				os.Rename(backups[i], staged.activity.Filename)
+			}
+			restoreFiles(batch[:i], backups)
+			return nil, &stageError{StageFile, fmt.Errorf("file rename failed: %w", err)}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		restoreFiles(batch, backups)
+		return nil, &stageError{StageDB, fmt.Errorf("database error: commit failed: %w", err)}
+	}
+
+	for i, backup := range backups {
+		if backup != "" {
+			os.Remove(backup)
+		}
+		if replaced := batch[i].replaces; replaced != nil && replaced.Filename != batch[i].activity.Filename {
+			os.Remove(replaced.Filename)
+		}
+	}
+	return outcomes, nil
+}
+
+// backupFile moves a file to its backup name and returns that name, or ""
+// if there was no file to back up
+func backupFile(filename string) (string, error) {
+	backup := filename + backupSuffix
+	if err := os.Rename(filename, backup); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return backup, nil
+}
+
+// restoreFiles undoes the renames of a batch whose commit failed: the new
+// files are deleted and updated activities get their backed up file back,
+// so the archive matches the rows that are still in the database.
+func restoreFiles(batch []*stagedActivity, backups []string) {
+	for i, staged := range batch {
+		if backups[i] == "" {
+			os.Remove(staged.activity.Filename)
+			continue
+		}
+		if err := os.Rename(backups[i], staged.activity.Filename); err != nil {
+			fmt.Printf("❌ Failed to restore %s: %v\n", staged.activity.Filename, err)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/models"
+)
+
+// stageTestActivity writes content to the staging file of an activity and
+// returns it ready for commitBatch
+func stageTestActivity(t *testing.T, s *SyncService, id int, name, content string) *stagedActivity {
+	t.Helper()
+	filename := filepath.Join(s.dataDir, "activities", fmt.Sprintf("%d.fit", id))
+	tempPath, err := writeTempFile(filename, []byte(content))
+	if err != nil {
+		t.Fatalf("writeTempFile: %v", err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	source := garminActivity(id)
+	return &stagedActivity{
+		source:   &source,
+		tempPath: tempPath,
+		data:     []byte(content),
+		metrics:  &models.ActivityMetrics{},
+		activity: &database.Activity{
+			ActivityID:   id,
+			ActivityName: name,
+			StartTime:    time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC).Add(time.Duration(id) * time.Hour),
+			ActivityType: "running",
+			Filename:     filename,
+			FileType:     "fit",
+			FileSize:     int64(len(content)),
+			FileSHA256:   hex.EncodeToString(sum[:]),
+			Downloaded:   true,
+		},
+	}
+}
+
+// commitTestActivity stores an activity and its file through commitBatch
+func commitTestActivity(t *testing.T, s *SyncService, id int, content string) *stagedActivity {
+	t.Helper()
+	staged := stageTestActivity(t, s, id, "Activity", content)
+	if _, err := s.commitBatch([]*stagedActivity{staged}); err != nil {
+		t.Fatalf("commitBatch(%d): %v", id, err)
+	}
+	return staged
+}
+
+// readFile returns a file's content, or "" if it does not exist
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return string(data)
+}
+
+// assertNoLeftovers fails if staging or backup files remain in the archive
+func assertNoLeftovers(t *testing.T, s *SyncService) {
+	t.Helper()
+	for _, pattern := range []string{"*" + tempSuffix, "*" + backupSuffix} {
+		matches, _ := filepath.Glob(filepath.Join(s.dataDir, "activities", pattern))
+		if len(matches) > 0 {
+			t.Errorf("leftover files: %v", matches)
+		}
+	}
+}
+
+// failCommitsOnName makes any transaction that writes an activity with the
+// given name fail at COMMIT, through a deferred foreign key violation
+func failCommitsOnName(t *testing.T, s *SyncService, name string) {
+	t.Helper()
+	_, err := s.db.DB().Exec(`
+	CREATE TABLE commit_guard_parent (id INTEGER PRIMARY KEY);
+	CREATE TABLE commit_guard (
+		parent_id INTEGER REFERENCES commit_guard_parent(id) DEFERRABLE INITIALLY DEFERRED
+	);
+	CREATE TRIGGER commit_guard_insert AFTER INSERT ON activities WHEN NEW.activity_name = '` + name + `'
+	BEGIN INSERT INTO commit_guard VALUES (1); END;
+	CREATE TRIGGER commit_guard_update AFTER UPDATE ON activities WHEN NEW.activity_name = '` + name + `'
+	BEGIN INSERT INTO commit_guard VALUES (1); END;`)
+	if err != nil {
+		t.Fatalf("creating commit guard: %v", err)
+	}
+}
+
+func TestCommitBatch(t *testing.T) {
+	s := newTestService(t)
+	old := commitTestActivity(t, s, 1, "old content")
+
+	batch := []*stagedActivity{
+		stageTestActivity(t, s, 1, "Renamed", "new content"),
+		stageTestActivity(t, s, 2, "Activity", "second activity"),
+	}
+	outcomes, err := s.commitBatch(batch)
+	if err != nil {
+		t.Fatalf("commitBatch: %v", err)
+	}
+	if outcomes[0] != outcomeUpdated || outcomes[1] != outcomeCreated {
+		t.Errorf("outcomes = %v, want [updated created]", outcomes)
+	}
+	if got := readFile(t, old.activity.Filename); got != "new content" {
+		t.Errorf("updated file = %q, want new content", got)
+	}
+	if got := readFile(t, batch[1].activity.Filename); got != "second activity" {
+		t.Errorf("created file = %q, want second activity", got)
+	}
+	assertNoLeftovers(t, s)
+}
+
+func TestCommitBatchFailureRestoresFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T, s *SyncService, batch []*stagedActivity)
+		wantStage string
+	}{
+		{
+			name: "commit fails",
+			setup: func(t *testing.T, s *SyncService, batch []*stagedActivity) {
+				failCommitsOnName(t, s, "Renamed")
+			},
+			wantStage: StageDB,
+		},
+		{
+			name: "rename fails",
+			setup: func(t *testing.T, s *SyncService, batch []*stagedActivity) {
+				// A non-empty directory in place of the new file cannot be
+				// renamed over
+				blocker := filepath.Join(batch[1].activity.Filename, "blocker")
+				if err := os.MkdirAll(blocker, 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStage: StageFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			old := commitTestActivity(t, s, 1, "old content")
+
+			batch := []*stagedActivity{
+				stageTestActivity(t, s, 1, "Renamed", "new content"),
+				stageTestActivity(t, s, 2, "Activity", "second activity"),
+				stageTestActivity(t, s, 3, "Activity", "third activity"),
+			}
+			tt.setup(t, s, batch)
+
+			_, err := s.commitBatch(batch)
+			var se *stageError
+			if !errors.As(err, &se) || se.stage != tt.wantStage {
+				t.Fatalf("commitBatch error = %v, want a %s stage error", err, tt.wantStage)
+			}
+
+			// The archive must still match the rows of the last commit
+			if got := readFile(t, old.activity.Filename); got != "old content" {
+				t.Errorf("updated file = %q after failed commit, want old content", got)
+			}
+			row, err := s.db.GetActivity(1)
+			if err != nil {
+				t.Fatalf("GetActivity: %v", err)
+			}
+			if row.ActivityName != "Activity" || row.FileSHA256 != old.activity.FileSHA256 {
+				t.Errorf("row of activity 1 changed by a failed commit: %+v", row)
+			}
+			if got := readFile(t, batch[2].activity.Filename); got != "" {
+				t.Errorf("created file %s left behind", batch[2].activity.Filename)
+			}
+			for _, id := range []int{2, 3} {
+				if exists, _ := s.db.ActivityExists(id); exists {
+					t.Errorf("activity %d stored by a failed commit", id)
+				}
+			}
+			assertNoLeftovers(t, s)
+		})
+	}
+}
+
+func TestSyncReplacesImportedCopy(t *testing.T) {
+	s := newTestService(t)
+	start := time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC)
+
+	imported := stageTestActivity(t, s, -1, "Imported", "imported fit")
+	imported.activity.Source = database.SourceImport
+	imported.activity.DeviceSerial = "3999"
+	imported.activity.FileStartTime = &start
+	if _, err := s.commitBatch([]*stagedActivity{imported}); err != nil {
+		t.Fatalf("commitBatch(imported): %v", err)
+	}
+	commitTestActivity(t, s, 7, "another garmin activity")
+
+	tests := []struct {
+		name   string
+		start  time.Time
+		serial string
+		want   int // 0 for no copy
+	}{
+		{"same start and device", start, "3999", -1},
+		{"device unknown", start, "", -1},
+		{"other device", start, "4000", 0},
+		{"other start", start.Add(time.Second), "3999", 0},
+		{"no start", time.Time{}, "3999", 0},
+	}
+	for _, tt := range tests {
+		found, err := s.importedCopy(5, &models.ActivityMetrics{StartTime: tt.start, DeviceSerial: tt.serial})
+		if err != nil {
+			t.Fatalf("%s: importedCopy: %v", tt.name, err)
+		}
+		got := 0
+		if found != nil {
+			got = found.ActivityID
+		}
+		if got != tt.want {
+			t.Errorf("%s: importedCopy = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	staged := stageTestActivity(t, s, 5, "Morning Run", "garmin fit")
+	staged.replaces, _ = s.db.GetActivity(-1)
+	if _, err := s.commitBatch([]*stagedActivity{staged}); err != nil {
+		t.Fatalf("commitBatch: %v", err)
+	}
+
+	if _, err := s.db.GetActivity(-1); !errors.Is(err, database.ErrActivityNotFound) {
+		t.Errorf("imported row still stored: %v", err)
+	}
+	if content := readFile(t, imported.activity.Filename); content != "" {
+		t.Errorf("imported file still on disk: %q", content)
+	}
+	if content := readFile(t, staged.activity.Filename); content != "garmin fit" {
+		t.Errorf("synced file = %q, want garmin fit", content)
+	}
+	assertNoLeftovers(t, s)
+}
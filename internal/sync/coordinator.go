@@ -0,0 +1,217 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"log"
+	stdsync "sync"
+	"time"
+)
+
+var (
+	// ErrSyncInProgress is returned by Coordinator.Start while a job runs
+	ErrSyncInProgress = errors.New("sync already in progress")
+	// ErrNoSyncRunning is returned by Coordinator.Cancel when idle
+	ErrNoSyncRunning = errors.New("no sync is running")
+)
+
+// Job phases besides the sync phases reported by SyncService
+const (
+	PhaseStarting  = "starting"
+	PhaseFinished  = "finished"
+	PhaseFailed    = "failed"
+	PhaseCancelled = "cancelled"
+)
+
+// Job is a snapshot of a sync started through the Coordinator
+type Job struct {
+	ID         int64      `json:"id"`
+	RunID      int64      `json:"run_id,omitempty"` // matching sync_runs row once recorded
+	Trigger    string     `json:"trigger"`
+	Phase      string     `json:"phase"`
+	Processed  int        `json:"processed"`
+	Total      int        `json:"total"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ETA        *time.Time `json:"eta,omitempty"`
+	Error      string     `json:"error,omitempty"`
+
+	syncStarted time.Time
+}
+
+// Running reports whether the job has not finished yet
+func (j Job) Running() bool {
+	return j.FinishedAt == nil
+}
+
+// Coordinator makes sure only one sync runs at a time, whether it was
+// started by the scheduler, the API or the CLI, and tracks its progress.
+type Coordinator struct {
+	syncer *SyncService
+
+	mu     stdsync.Mutex
+	job    *Job // current job, or the last one once it finished
+	cancel context.CancelFunc
+	done   chan struct{}
+	nextID int64
+}
+
+func NewCoordinator(syncer *SyncService) *Coordinator {
+	return &Coordinator{syncer: syncer}
+}
+
+// Start launches a sync in the background. If one is already running it
+// returns that job together with ErrSyncInProgress; if another archive job
+// holds the job lock it returns ErrJobRunning.
+func (c *Coordinator) Start(opts Options) (Job, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.job != nil && c.job.Running() {
+		return c.snapshot(c.job), ErrSyncInProgress
+	}
+	release, err := c.syncer.acquireJob("sync")
+	if err != nil {
+		return Job{}, err
+	}
+
+	c.nextID++
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	c.job = &Job{
+		ID:        c.nextID,
+		Trigger:   opts.Trigger,
+		Phase:     PhaseStarting,
+		StartedAt: time.Now(),
+	}
+	job := c.job
+
+	progress := opts.Progress
+	opts.Progress = func(p Progress) {
+		c.update(job, p)
+		if progress != nil {
+			progress(p)
+		}
+	}
+
+	done := c.done
+	go func() {
+		defer close(done)
+		defer cancel()
+		defer release()
+		run, err := c.syncer.run(ctx, opts)
+		if err != nil {
+			log.Printf("Sync %d failed: %v", job.ID, err)
+		}
+		c.finish(job, run != nil, err)
+	}()
+
+	return c.snapshot(c.job), nil
+}
+
+// Status returns the running job, or the last finished one. The boolean is
+// false if no job has run since startup.
+func (c *Coordinator) Status() (Job, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.job == nil {
+		return Job{}, false
+	}
+	return c.snapshot(c.job), true
+}
+
+// Cancel stops the running job through its context
+func (c *Coordinator) Cancel() (Job, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.job == nil || !c.job.Running() {
+		return Job{}, ErrNoSyncRunning
+	}
+	c.cancel()
+	return c.snapshot(c.job), nil
+}
+
+// Wait blocks until the job with the given ID has finished and returns its
+// final state. Jobs that are no longer the current one have long finished
+// and are returned as ok=false.
+func (c *Coordinator) Wait(id int64) (Job, bool) {
+	c.mu.Lock()
+	job := c.job
+	if job == nil || job.ID != id {
+		c.mu.Unlock()
+		return Job{}, false
+	}
+	done := c.done
+	c.mu.Unlock()
+
+	<-done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshot(job), true
+}
+
+// Stop cancels the running job, if any, and waits for it to return
+func (c *Coordinator) Stop() {
+	c.mu.Lock()
+	if c.job == nil || !c.job.Running() {
+		c.mu.Unlock()
+		return
+	}
+	c.cancel()
+	done := c.done
+	c.mu.Unlock()
+
+	<-done
+}
+
+func (c *Coordinator) update(job *Job, p Progress) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if job.Phase != p.Phase && p.Phase == PhaseSyncing {
+		job.syncStarted = time.Now()
+	}
+	job.RunID = p.RunID
+	job.Phase = p.Phase
+	job.Processed = p.Processed
+	job.Total = p.Total
+}
+
+func (c *Coordinator) finish(job *Job, recorded bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	job.FinishedAt = &now
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.Phase = PhaseCancelled
+	case err != nil:
+		job.Phase = PhaseFailed
+	default:
+		job.Phase = PhaseFinished
+	}
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if !recorded {
+		job.RunID = 0
+	}
+}
+
+// snapshot copies a job and estimates its completion time from the rate
+// activities have been processed at so far. c.mu must be held.
+func (c *Coordinator) snapshot(current *Job) Job {
+	job := *current
+	job.ETA = nil
+	if job.Running() && job.Phase == PhaseSyncing && job.Processed > 0 && job.Total > job.Processed {
+		perActivity := time.Since(job.syncStarted) / time.Duration(job.Processed)
+		eta := time.Now().Add(perActivity * time.Duration(job.Total-job.Processed))
+		job.ETA = &eta
+	}
+	return job
+}
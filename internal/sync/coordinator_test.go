@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/garmin"
+)
+
+// newCoordinatorService returns a service whose syncs list four activities
+// and skip all of them by rule, so no files are downloaded
+func newCoordinatorService(t *testing.T) *SyncService {
+	t.Helper()
+	t.Setenv("GARMIN_EMAIL", "athlete@example.com")
+	t.Setenv("GARMIN_PASSWORD", "secret")
+
+	s := newTestService(t)
+	serveActivities(t, s, []garmin.GarminActivity{garminActivity(4), garminActivity(3), garminActivity(2), garminActivity(1)})
+	if err := s.LoadRules(Rules{IncludeTypes: []string{"cycling"}}); err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+	return s
+}
+
+func TestCoordinatorSingleFlight(t *testing.T) {
+	c := NewCoordinator(newCoordinatorService(t))
+
+	// Hold the sync halfway through its activities
+	reached := make(chan struct{})
+	release := make(chan struct{})
+	first, err := c.Start(Options{Trigger: TriggerAPI, Progress: func(p Progress) {
+		if p.Phase == PhaseSyncing && p.Processed == 2 {
+			close(reached)
+			<-release
+		}
+	}})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	select {
+	case <-reached:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sync did not reach the syncing phase")
+	}
+
+	status, ok := c.Status()
+	if !ok || status.ID != first.ID || !status.Running() {
+		t.Fatalf("Status = %+v, %v; want job %d running", status, ok, first.ID)
+	}
+	if status.Phase != PhaseSyncing || status.Processed != 2 || status.Total != 4 || status.RunID == 0 {
+		t.Errorf("Status = %+v, want syncing 2/4 with a run ID", status)
+	}
+	if status.ETA == nil || status.ETA.Before(status.StartedAt) {
+		t.Errorf("ETA = %v, want an estimate", status.ETA)
+	}
+
+	dup, err := c.Start(Options{Trigger: TriggerCron})
+	if !errors.Is(err, ErrSyncInProgress) || dup.ID != first.ID || dup.Trigger != TriggerAPI {
+		t.Errorf("second Start = %+v, %v; want job %d with ErrSyncInProgress", dup, err, first.ID)
+	}
+
+	if _, err := c.Cancel(); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	close(release)
+	job, ok := c.Wait(first.ID)
+	if !ok || job.Phase != PhaseCancelled || job.Running() || job.ETA != nil {
+		t.Errorf("Wait = %+v, %v; want a finished, cancelled job", job, ok)
+	}
+	if _, err := c.Cancel(); !errors.Is(err, ErrNoSyncRunning) {
+		t.Errorf("Cancel when idle = %v, want ErrNoSyncRunning", err)
+	}
+
+	// The job lock was released, so the next sync runs to completion
+	second, err := c.Start(Options{Trigger: TriggerAPI})
+	if err != nil {
+		t.Fatalf("Start after cancel: %v", err)
+	}
+	job, ok = c.Wait(second.ID)
+	if !ok || job.Phase != PhaseFinished || job.Error != "" || job.RunID == 0 {
+		t.Errorf("Wait = %+v, %v; want a finished job with a run ID", job, ok)
+	}
+	if _, ok := c.Wait(first.ID); ok {
+		t.Errorf("Wait for a replaced job reported ok")
+	}
+}
+
+func TestCoordinatorStartHonoursJobLock(t *testing.T) {
+	s := newCoordinatorService(t)
+	c := NewCoordinator(s)
+
+	release, err := s.acquireJob("import")
+	if err != nil {
+		t.Fatalf("acquireJob: %v", err)
+	}
+	defer release()
+
+	if _, err := c.Start(Options{}); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Start while importing = %v, want ErrJobRunning", err)
+	}
+	if _, ok := c.Status(); ok {
+		t.Errorf("Status reports a job although none started")
+	}
+}
@@ -0,0 +1,93 @@
+package sync
+
+import (
+	stdsync "sync"
+	"time"
+)
+
+// Event types published while a sync runs
+const (
+	EventListingPage        = "listing_page"
+	EventActivityStarted    = "activity_started"
+	EventActivityDownloaded = "activity_downloaded"
+	EventActivityParsed     = "activity_parsed"
+	EventActivitySaved      = "activity_saved"
+	EventActivityFailed     = "activity_failed"
+	EventActivitySkipped    = "activity_skipped"
+	EventRunFinished        = "run_finished"
+)
+
+// eventBuffer is how many events a subscriber may fall behind by before
+// further events are dropped for it
+const eventBuffer = 64
+
+// Event is a structured progress update from a sync run
+type Event struct {
+	Type       string    `json:"type"`
+	RunID      int64     `json:"run_id"`
+	Time       time.Time `json:"time"`
+	ActivityID int       `json:"activity_id,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Page       int       `json:"page,omitempty"`
+	Count      int       `json:"count,omitempty"` // activities on a listed page
+	Processed  int       `json:"processed,omitempty"`
+	Total      int       `json:"total,omitempty"`
+	Outcome    string    `json:"outcome,omitempty"` // created or updated, for saved activities
+	Stage      string    `json:"stage,omitempty"`   // failing stage, for failed activities
+	Reason     string    `json:"reason,omitempty"`  // why an activity was skipped
+	Error      string    `json:"error,omitempty"`
+
+	// Set on run_finished
+	Status  string `json:"status,omitempty"`
+	New     int    `json:"new,omitempty"`
+	Updated int    `json:"updated,omitempty"`
+	Failed  int    `json:"failed,omitempty"`
+	Skipped int    `json:"skipped,omitempty"`
+}
+
+// EventBus fans sync events out to in-process subscribers. Publishing never
+// blocks: a subscriber that does not keep up misses events.
+type EventBus struct {
+	mu   stdsync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving every event published from now on
+// and a function that unsubscribes and closes it.
+func (b *EventBus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBuffer)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once stdsync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends an event to all subscribers
+func (b *EventBus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
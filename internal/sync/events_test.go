@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBusSubscribe(t *testing.T) {
+	bus := NewEventBus()
+	first, unsubscribeFirst := bus.Subscribe()
+	second, unsubscribeSecond := bus.Subscribe()
+	defer unsubscribeSecond()
+
+	bus.Publish(Event{Type: EventActivitySaved, ActivityID: 1})
+	for i, ch := range []<-chan Event{first, second} {
+		select {
+		case e := <-ch:
+			if e.Type != EventActivitySaved || e.ActivityID != 1 || e.Time.IsZero() {
+				t.Errorf("subscriber %d got %+v, want activity 1 saved with a time", i, e)
+			}
+		default:
+			t.Errorf("subscriber %d got no event", i)
+		}
+	}
+
+	// Unsubscribing closes the channel, and only that one
+	unsubscribeFirst()
+	unsubscribeFirst()
+	if _, ok := <-first; ok {
+		t.Errorf("channel still open after unsubscribe")
+	}
+	bus.Publish(Event{Type: EventRunFinished})
+	if e := <-second; e.Type != EventRunFinished {
+		t.Errorf("remaining subscriber got %+v, want run_finished", e)
+	}
+}
+
+func TestEventBusSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	slow, unsubscribeSlow := bus.Subscribe()
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := bus.Subscribe()
+	defer unsubscribeFast()
+
+	// The slow subscriber never reads, so its buffer fills and the rest
+	// of its events are dropped without holding up Publish
+	done := make(chan struct{})
+	received := make(chan int)
+	go func() {
+		n := 0
+		for range fast {
+			n++
+		}
+		received <- n
+	}()
+	go func() {
+		for i := 0; i < 3*eventBuffer; i++ {
+			bus.Publish(Event{Type: EventActivityStarted, ActivityID: i})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+
+	unsubscribeFast()
+	if n := <-received; n == 0 {
+		t.Errorf("fast subscriber received no events")
+	}
+	if n := len(slow); n != eventBuffer {
+		t.Errorf("slow subscriber has %d buffered events, want %d", n, eventBuffer)
+	}
+	if e := <-slow; e.ActivityID != 0 {
+		t.Errorf("slow subscriber's first event is %d, want the earliest, 0", e.ActivityID)
+	}
+}
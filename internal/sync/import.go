@@ -0,0 +1,356 @@
+package sync
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/models"
+	"github.com/sstent/garminsync-go/internal/parser"
+)
+
+// Outcomes of importing a single file
+const (
+	ImportImported  = "imported"
+	ImportDuplicate = "duplicate"
+	ImportFailed    = "failed"
+)
+
+// ErrInvalidActivityFile wraps the parser error for files that claim to be
+// FIT, GPX or TCX but cannot be parsed
+var ErrInvalidActivityFile = errors.New("invalid activity file")
+
+// maxImportFileSize caps the size of a single activity file read during an
+// import; larger files are not activities worth parsing
+const maxImportFileSize = 64 << 20
+
+// ImportResult is the outcome of importing one activity file
+type ImportResult struct {
+	Path        string `json:"path"`
+	Format      string `json:"format,omitempty"`
+	Status      string `json:"status"`
+	ActivityID  int    `json:"activity_id,omitempty"`
+	DuplicateOf int    `json:"duplicate_of,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ImportReport lists the outcome of an import. Files that are not FIT, GPX
+// or TCX activities are only counted in Unsupported.
+type ImportReport struct {
+	StartedAt   time.Time      `json:"started_at"`
+	FinishedAt  time.Time      `json:"finished_at"`
+	Imported    int            `json:"imported"`
+	Duplicates  int            `json:"duplicates"`
+	Failed      int            `json:"failed"`
+	Unsupported int            `json:"unsupported"`
+	Files       []ImportResult `json:"files"`
+}
+
+func (r *ImportReport) add(result ImportResult) {
+	switch result.Status {
+	case ImportImported:
+		r.Imported++
+	case ImportDuplicate:
+		r.Duplicates++
+	default:
+		r.Failed++
+	}
+	r.Files = append(r.Files, result)
+}
+
+// Import adds the activity files found at path, which may be a single file,
+// a directory or a ZIP archive such as Garmin's data export. Directories are
+// walked recursively and ZIP archives, including ones nested inside others,
+// are read entry by entry.
+//
+// Files are parsed with the parser and skipped as duplicates if a stored
+// activity has the same start time and device serial or the same content.
+// Activities synced before start times were recorded need a reprocess run
+// before they can be matched. Imported activities get local IDs and are
+// stored in the archive with source=import.
+func (s *SyncService) Import(ctx context.Context, path string) (*ImportReport, error) {
+	report := &ImportReport{StartedAt: time.Now(), Files: []ImportResult{}}
+
+	release, err := s.acquireJob("import")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			return s.importPath(ctx, file, report)
+		})
+	} else {
+		err = s.importPath(ctx, path, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report.FinishedAt = time.Now()
+	fmt.Printf("Import: %d imported, %d duplicates, %d failed, %d unsupported files\n",
+		report.Imported, report.Duplicates, report.Failed, report.Unsupported)
+	return report, nil
+}
+
+// importPath imports a file on disk, opening it as an archive if it is a ZIP
+func (s *SyncService) importPath(ctx context.Context, path string, report *ImportReport) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head := make([]byte, 4)
+	if n, _ := io.ReadFull(f, head); parser.DetectFormat(head[:n]) == "zip" {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		archive, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			report.add(ImportResult{Path: path, Format: "zip", Status: ImportFailed, Error: err.Error()})
+			return nil
+		}
+		return s.importZip(ctx, path, archive, report)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := readLimited(f)
+	if err != nil {
+		report.add(ImportResult{Path: path, Status: ImportFailed, Error: err.Error()})
+		return nil
+	}
+	s.importData(path, data, database.SourceImport, report)
+	return nil
+}
+
+// importZip imports every entry of a ZIP archive. Nested archives are
+// spooled to a temporary file rather than read into memory.
+func (s *SyncService) importZip(ctx context.Context, name string, archive *zip.Reader, report *ImportReport) error {
+	for _, entry := range archive.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		path := name + "/" + entry.Name
+
+		if strings.EqualFold(filepath.Ext(entry.Name), ".zip") {
+			if err := s.importNestedZip(ctx, path, entry, report); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				report.add(ImportResult{Path: path, Format: "zip", Status: ImportFailed, Error: err.Error()})
+			}
+			continue
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			report.add(ImportResult{Path: path, Status: ImportFailed, Error: err.Error()})
+			continue
+		}
+		data, err := readLimited(rc)
+		rc.Close()
+		if err != nil {
+			report.add(ImportResult{Path: path, Status: ImportFailed, Error: err.Error()})
+			continue
+		}
+		s.importData(path, data, database.SourceImport, report)
+	}
+	return nil
+}
+
+func (s *SyncService) importNestedZip(ctx context.Context, path string, entry *zip.File, report *ImportReport) error {
+	rc, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp("", "garminsync-import-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, rc)
+	if err != nil {
+		return err
+	}
+	archive, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+	return s.importZip(ctx, path, archive, report)
+}
+
+// readLimited reads a whole activity file, refusing ones over
+// maxImportFileSize
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxImportFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportFileSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxImportFileSize)
+	}
+	return data, nil
+}
+
+// importData imports one activity file and adds its outcome to the report
+func (s *SyncService) importData(path string, data []byte, source string, report *ImportReport) {
+	result, err := s.importActivity(path, data, source)
+	if errors.Is(err, parser.ErrUnsupportedFormat) || errors.Is(err, parser.ErrNotActivity) {
+		report.Unsupported++
+		return
+	}
+	report.add(result)
+}
+
+// importActivity parses an activity file and, unless it duplicates a stored
+// activity, stores it under a new local ID. The returned error is also
+// recorded in the result.
+func (s *SyncService) importActivity(path string, data []byte, source string) (ImportResult, error) {
+	format := parser.DetectFormat(data)
+	result := ImportResult{Path: path, Format: format, Status: ImportFailed}
+	fail := func(err error) (ImportResult, error) {
+		result.Error = err.Error()
+		return result, err
+	}
+
+	metrics, err := parser.NewParser().ParseData(data)
+	if err != nil {
+		if errors.Is(err, parser.ErrUnsupportedFormat) || errors.Is(err, parser.ErrNotActivity) {
+			return fail(err)
+		}
+		return fail(fmt.Errorf("%w: %w", ErrInvalidActivityFile, err))
+	}
+	if metrics.StartTime.IsZero() {
+		return fail(fmt.Errorf("%w: file has no start time", ErrInvalidActivityFile))
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	// Allocating the ID and committing must not interleave with another
+	// import, or two files could get the same ID
+	s.importMu.Lock()
+	defer s.importMu.Unlock()
+
+	duplicateOf, found, err := s.db.FindActivityByFileStart(metrics.StartTime, metrics.DeviceSerial)
+	if err != nil {
+		return fail(fmt.Errorf("database error: %w", err))
+	}
+	if !found {
+		ids, err := s.db.FindActivitiesBySHA256(checksum)
+		if err != nil {
+			return fail(fmt.Errorf("database error: %w", err))
+		}
+		if len(ids) > 0 {
+			duplicateOf, found = ids[0], true
+		}
+	}
+	if found {
+		result.Status = ImportDuplicate
+		result.DuplicateOf = duplicateOf
+		return result, nil
+	}
+
+	id, err := s.db.NextLocalActivityID()
+	if err != nil {
+		return fail(fmt.Errorf("database error: %w", err))
+	}
+	filename := filepath.Join(s.dataDir, "activities", fmt.Sprintf("%d.%s", id, format))
+	tempPath, err := writeTempFile(filename, data)
+	if err != nil {
+		return fail(err)
+	}
+
+	activityType := metrics.ActivityType
+	if activityType == "" {
+		activityType = "unknown"
+	}
+	name := metrics.Name
+	if name == "" {
+		base := filepath.Base(path)
+		name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	now := time.Now().UTC()
+	staged := &stagedActivity{
+		tempPath: tempPath,
+		data:     data,
+		metrics:  metrics,
+		activity: &database.Activity{
+			ActivityID:    id,
+			ActivityName:  name,
+			StartTime:     metrics.StartTime.UTC(),
+			ActivityType:  activityType,
+			Distance:      metrics.Distance,
+			Duration:      int(metrics.Duration.Seconds()),
+			MaxHeartRate:  metrics.MaxHeartRate,
+			AvgHeartRate:  metrics.AvgHeartRate,
+			AvgPower:      float64(metrics.AvgPower),
+			Calories:      metrics.Calories,
+			Steps:         metrics.Steps,
+			ElevationGain: metrics.ElevationGain,
+			Filename:      filename,
+			FileType:      format,
+			FileSize:      int64(len(data)),
+			FileSHA256:    checksum,
+			SourceFormat:  format,
+			Downloaded:    true,
+			DownloadedAt:  &now,
+			Source:        source,
+			DeviceSerial:  metrics.DeviceSerial,
+			FileStartTime: fileStartTime(metrics),
+		},
+	}
+	if _, err := s.commitBatch([]*stagedActivity{staged}); err != nil {
+		return fail(err)
+	}
+
+	result.Status = ImportImported
+	result.ActivityID = id
+	return result, nil
+}
+
+// fileStartTime returns the start time recorded in an activity file, or nil
+// if it had none
+func fileStartTime(metrics *models.ActivityMetrics) *time.Time {
+	if metrics.StartTime.IsZero() {
+		return nil
+	}
+	start := metrics.StartTime.UTC()
+	return &start
+}
@@ -0,0 +1,280 @@
+package sync
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+// tcxActivity is a one-lap TCX ride starting at start, recorded by the
+// device with the given serial
+func tcxActivity(start time.Time, serial string, calories int) string {
+	return fmt.Sprintf(`<?xml version="1.0"?>
+<TrainingCenterDatabase><Activities><Activity Sport="Biking"><Id>%[1]s</Id>
+<Lap StartTime="%[1]s"><TotalTimeSeconds>600</TotalTimeSeconds><DistanceMeters>5000</DistanceMeters><Calories>%[3]d</Calories>
+<Track><Trackpoint><Time>%[1]s</Time></Trackpoint></Track></Lap>
+<Creator><UnitId>%[2]s</UnitId></Creator></Activity></Activities></TrainingCenterDatabase>`,
+		start.Format(time.RFC3339), serial, calories)
+}
+
+// zipArchive builds a ZIP archive of the given entries
+func zipArchive(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(entries[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeFiles writes the given files below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func runImport(t *testing.T, s *SyncService, path string) *ImportReport {
+	t.Helper()
+	report, err := s.Import(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Import(%s): %v", path, err)
+	}
+	return report
+}
+
+// importResults maps the imported file paths, relative to root, to their
+// outcome
+func importResults(report *ImportReport, root string) map[string]ImportResult {
+	results := make(map[string]ImportResult)
+	for _, result := range report.Files {
+		path, err := filepath.Rel(root, result.Path)
+		if err != nil {
+			path = result.Path
+		}
+		results[filepath.ToSlash(path)] = result
+	}
+	return results
+}
+
+func TestImportDirectory(t *testing.T) {
+	s := newTestService(t)
+	start := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"run.gpx":          gpxTrack(start),
+		"rides/ride.tcx":   tcxActivity(start.Add(24*time.Hour), "3312345678", 150),
+		"rides/broken.gpx": "<gpx><trk>",
+		"README.txt":       "not an activity",
+	})
+
+	report := runImport(t, s, dir)
+	if report.Imported != 2 || report.Duplicates != 0 || report.Failed != 1 || report.Unsupported != 1 {
+		t.Fatalf("imported %d, duplicates %d, failed %d, unsupported %d; want 2, 0, 1, 1",
+			report.Imported, report.Duplicates, report.Failed, report.Unsupported)
+	}
+	results := importResults(report, dir)
+	if len(results) != 3 {
+		t.Errorf("results = %+v, want run.gpx, ride.tcx and broken.gpx only", report.Files)
+	}
+	if broken := results["rides/broken.gpx"]; broken.Status != ImportFailed || broken.Format != "gpx" || broken.Error == "" {
+		t.Errorf("broken.gpx = %+v, want failed with an error", broken)
+	}
+
+	ride := results["rides/ride.tcx"]
+	if ride.Status != ImportImported || ride.Format != "tcx" || ride.ActivityID >= 0 {
+		t.Fatalf("ride.tcx = %+v, want imported under a local ID", ride)
+	}
+	activity := getActivity(t, s, ride.ActivityID)
+	if activity.Source != database.SourceImport || activity.ActivityType != "cycling" || activity.DeviceSerial != "3312345678" ||
+		activity.FileStartTime == nil || !activity.FileStartTime.Equal(start.Add(24*time.Hour)) || activity.Calories != 150 {
+		t.Errorf("imported ride = %+v, want an imported cycling activity from the file", activity)
+	}
+	want := filepath.Join(s.dataDir, "activities", fmt.Sprintf("%d.tcx", ride.ActivityID))
+	if activity.Filename != want || readFile(t, want) != tcxActivity(start.Add(24*time.Hour), "3312345678", 150) {
+		t.Errorf("ride stored at %s, want the file copied to %s", activity.Filename, want)
+	}
+	if run := results["run.gpx"]; run.Status != ImportImported || run.ActivityID == ride.ActivityID {
+		t.Errorf("run.gpx = %+v, want imported under its own ID", run)
+	}
+	assertNoLeftovers(t, s)
+}
+
+func TestImportDuplicates(t *testing.T) {
+	start := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		stored    string
+		imported  string
+		duplicate bool
+	}{
+		{"same start and serial", tcxActivity(start, "111", 150), tcxActivity(start, "111", 999), true},
+		{"same start, other serial", tcxActivity(start, "111", 150), tcxActivity(start, "222", 150), false},
+		{"same start, stored without serial", tcxActivity(start, "0", 150), tcxActivity(start, "222", 150), true},
+		{"other start, same serial", tcxActivity(start, "111", 150), tcxActivity(start.Add(time.Second), "111", 150), false},
+		{"same content", gpxTrack(start), gpxTrack(start), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"stored.tcx": tt.stored, "imported.tcx": tt.imported})
+
+			first := runImport(t, s, filepath.Join(dir, "stored.tcx"))
+			if first.Imported != 1 {
+				t.Fatalf("first import = %+v, want it imported", first.Files)
+			}
+			storedID := first.Files[0].ActivityID
+
+			report := runImport(t, s, filepath.Join(dir, "imported.tcx"))
+			result := report.Files[0]
+			if tt.duplicate && (report.Duplicates != 1 || result.Status != ImportDuplicate || result.DuplicateOf != storedID) {
+				t.Errorf("import = %+v, want a duplicate of %d", result, storedID)
+			}
+			if !tt.duplicate && (report.Imported != 1 || result.Status != ImportImported) {
+				t.Errorf("import = %+v, want it imported", result)
+			}
+		})
+	}
+}
+
+func TestImportDuplicateByChecksum(t *testing.T) {
+	s := newTestService(t)
+	content := gpxTrack(time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC))
+
+	// Synced before file start times were recorded, so only the content
+	// can match it
+	commitTestActivity(t, s, 42, content)
+	if activity := getActivity(t, s, 42); activity.FileStartTime != nil {
+		t.Fatalf("test activity has a file start time")
+	}
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"copy.gpx": content})
+	report := runImport(t, s, filepath.Join(dir, "copy.gpx"))
+	if result := report.Files[0]; report.Duplicates != 1 || result.DuplicateOf != 42 {
+		t.Errorf("import = %+v, want a duplicate of 42 by checksum", result)
+	}
+}
+
+func TestImportNestedZip(t *testing.T) {
+	s := newTestService(t)
+	start := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	deepest := zipArchive(t, map[string]string{"deep/run.gpx": gpxTrack(start.Add(48 * time.Hour))})
+	inner := zipArchive(t, map[string]string{
+		"ride.tcx":   tcxActivity(start.Add(24*time.Hour), "111", 150),
+		"deeper.zip": string(deepest),
+		"notes.txt":  "export notes",
+	})
+	outer := zipArchive(t, map[string]string{
+		"DI_CONNECT/run.gpx":       gpxTrack(start),
+		"DI_CONNECT/run2.gpx":      gpxTrack(start),
+		"DI_CONNECT/inner.zip":     string(inner),
+		"DI_CONNECT/corrupt.zip":   "PK\x03\x04 truncated",
+		"DI_CONNECT/settings.json": "{}",
+	})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "export.zip")
+	writeFiles(t, dir, map[string]string{"export.zip": string(outer)})
+
+	report := runImport(t, s, path)
+	if report.Imported != 3 || report.Duplicates != 1 || report.Failed != 1 || report.Unsupported != 2 {
+		t.Fatalf("imported %d, duplicates %d, failed %d, unsupported %d; want 3, 1, 1, 2",
+			report.Imported, report.Duplicates, report.Failed, report.Unsupported)
+	}
+
+	results := importResults(report, dir)
+	for _, name := range []string{
+		"export.zip/DI_CONNECT/run.gpx",
+		"export.zip/DI_CONNECT/inner.zip/ride.tcx",
+		"export.zip/DI_CONNECT/inner.zip/deeper.zip/deep/run.gpx",
+	} {
+		if result := results[name]; result.Status != ImportImported {
+			t.Errorf("%s = %+v, want imported", name, result)
+		}
+	}
+	if corrupt := results["export.zip/DI_CONNECT/corrupt.zip"]; corrupt.Status != ImportFailed || corrupt.Format != "zip" {
+		t.Errorf("corrupt.zip = %+v, want a failed zip", corrupt)
+	}
+	if copied := results["export.zip/DI_CONNECT/run2.gpx"]; copied.Status != ImportDuplicate ||
+		copied.DuplicateOf != results["export.zip/DI_CONNECT/run.gpx"].ActivityID {
+		t.Errorf("run2.gpx = %+v, want a duplicate of run.gpx", copied)
+	}
+	assertNoLeftovers(t, s)
+}
+
+func TestImportCancelled(t *testing.T) {
+	s := newTestService(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"run.gpx": gpxTrack(time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC))})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Import(ctx, dir); err != context.Canceled {
+		t.Errorf("Import = %v, want context.Canceled", err)
+	}
+	if n, err := s.db.NextLocalActivityID(); err != nil || n != -1 {
+		t.Errorf("NextLocalActivityID = %d, %v; want nothing imported", n, err)
+	}
+}
+
+func TestUploadHonoursJobLock(t *testing.T) {
+	s := newTestService(t)
+	content := gpxTrack(time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC))
+
+	release, err := s.acquireJob("sync")
+	if err != nil {
+		t.Fatalf("acquireJob: %v", err)
+	}
+	if _, err := s.Upload("run.gpx", strings.NewReader(content)); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Upload during a sync = %v, want ErrJobRunning", err)
+	}
+	release()
+
+	activity, err := s.Upload("run.gpx", strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if activity.ActivityID != -1 || activity.Source != database.SourceUpload {
+		t.Errorf("uploaded %+v, want local activity -1 with source upload", activity)
+	}
+
+	// The lock is released again, so the next job can run
+	var duplicate *DuplicateError
+	if _, err := s.Upload("copy.gpx", strings.NewReader(content)); !errors.As(err, &duplicate) || duplicate.ActivityID != -1 {
+		t.Errorf("second Upload = %v, want a duplicate of -1", err)
+	}
+}
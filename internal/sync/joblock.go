@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	stdsync "sync"
+)
+
+// ErrJobRunning is returned when a job that writes to the archive is started
+// while another one runs, in this process or in another one sharing the
+// data directory
+var ErrJobRunning = errors.New("another archive job is running")
+
+// jobLockFile is the lock file in the data directory that archive jobs hold
+// while they run
+const jobLockFile = "job.lock"
+
+// jobLock serialises the jobs that write activity rows and files: syncs,
+// imports, reprocessing, repairs and reconciliation. It is held through a
+// lock on jobLockFile, so a CLI command and a running daemon exclude each
+// other too.
+type jobLock struct {
+	mu      stdsync.Mutex
+	running string // job holding the lock, "" if none
+	file    *os.File
+}
+
+// acquireJob takes the job lock for the named job and returns the function
+// that releases it. It does not wait: if another job holds the lock it
+// fails with ErrJobRunning.
+func (s *SyncService) acquireJob(name string) (func(), error) {
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+
+	if s.jobs.running != "" {
+		return nil, fmt.Errorf("%w: %s", ErrJobRunning, s.jobs.running)
+	}
+
+	path := filepath.Join(s.dataDir, jobLockFile)
+	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job lock: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		holder, _ := os.ReadFile(path)
+		file.Close()
+		if errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("%w: %s", ErrJobRunning, strings.TrimSpace(string(holder)))
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	// Record the holder for the error message of whoever tries next
+	file.Truncate(0)
+	fmt.Fprintf(file, "%s (pid %d)\n", name, os.Getpid())
+
+	s.jobs.running = name
+	s.jobs.file = file
+	return func() {
+		s.jobs.mu.Lock()
+		defer s.jobs.mu.Unlock()
+		s.jobs.file.Truncate(0)
+		unlockFile(s.jobs.file)
+		s.jobs.file.Close()
+		s.jobs.file = nil
+		s.jobs.running = ""
+	}, nil
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package sync
+
+import (
+	"errors"
+	"os"
+)
+
+// errLocked is returned by lockFile if another process holds the lock
+var errLocked = errors.New("locked")
+
+// lockFile is a no-op where flock is unavailable; jobs are then only
+// serialised within one process
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,64 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAcquireJob(t *testing.T) {
+	s := newTestService(t)
+	// A second service on the same data directory stands in for another
+	// process, such as a CLI command next to the daemon
+	other := NewSyncService(s.garminClient, s.db, s.dataDir)
+
+	release, err := s.acquireJob("sync")
+	if err != nil {
+		t.Fatalf("acquireJob: %v", err)
+	}
+
+	if _, err := s.acquireJob("import"); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("second job in the same service: got %v, want ErrJobRunning", err)
+	}
+	_, err = other.acquireJob("import")
+	if !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("job in another service: got %v, want ErrJobRunning", err)
+	}
+	if !strings.Contains(err.Error(), "sync (pid") {
+		t.Errorf("error %q does not name the running job", err)
+	}
+
+	// Every job that writes to the archive is refused
+	ctx := context.Background()
+	if _, err := other.Run(ctx, Options{}); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Run: got %v, want ErrJobRunning", err)
+	}
+	if _, err := other.Import(ctx, s.dataDir); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Import: got %v, want ErrJobRunning", err)
+	}
+	if _, err := other.Reprocess(ctx, ReprocessOptions{}); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Reprocess: got %v, want ErrJobRunning", err)
+	}
+	if _, err := other.Verify(ctx, VerifyOptions{Repair: true}); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Verify with repair: got %v, want ErrJobRunning", err)
+	}
+	if _, err := other.Recover(); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Recover: got %v, want ErrJobRunning", err)
+	}
+	if _, err := NewCoordinator(other).Start(Options{}); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Coordinator.Start: got %v, want ErrJobRunning", err)
+	}
+
+	// A report-only verification does not write and runs alongside
+	if _, err := other.Verify(ctx, VerifyOptions{}); err != nil {
+		t.Errorf("Verify without repair: %v", err)
+	}
+
+	release()
+	release, err = other.acquireJob("import")
+	if err != nil {
+		t.Fatalf("acquireJob after release: %v", err)
+	}
+	release()
+}
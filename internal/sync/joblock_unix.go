@@ -0,0 +1,25 @@
+//go:build unix
+
+package sync
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errLocked is returned by lockFile if another process holds the lock
+var errLocked = errors.New("locked")
+
+// lockFile takes an exclusive lock on f without waiting
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,28 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/sstent/garminsync-go/internal/export"
+)
+
+// ExportParquet writes the archive as partitioned Parquet datasets to dir,
+// or to dataDir/parquet if dir is empty. See export.Exporter.WriteParquet.
+func (s *SyncService) ExportParquet(ctx context.Context, dir string, datasets []string) (*export.ParquetResult, error) {
+	if dir == "" {
+		dir = filepath.Join(s.dataDir, "parquet")
+	}
+
+	result, err := export.New(s.db).WriteParquet(ctx, export.ParquetOptions{Dir: dir, Datasets: datasets})
+	if err != nil {
+		return nil, fmt.Errorf("parquet export failed: %w", err)
+	}
+	fmt.Printf("✅ Parquet export to %s: %d activities, %d laps, %d records in %d files\n",
+		result.Dir, result.Activities, result.Laps, result.Records, result.Files)
+	if result.Failed > 0 {
+		fmt.Printf("⚠️  %d activity files could not be read\n", result.Failed)
+	}
+	return result, nil
+}
@@ -0,0 +1,210 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/garmin"
+)
+
+// defaultFileSizeEstimate is the assumed size of a FIT file when the archive
+// has none to average yet; an hour of 1s recording is roughly this big
+const defaultFileSizeEstimate = 200 * 1024
+
+// Plan actions
+const (
+	PlanNew       = "new"
+	PlanChanged   = "changed"
+	PlanDeleted   = "deleted"
+	PlanUnchanged = "unchanged"
+	PlanSkipped   = "skipped"
+	PlanBlocked   = "blocked"
+)
+
+// PlanItem is an activity a sync would download or flag
+type PlanItem struct {
+	ActivityID     int    `json:"activity_id"`
+	Name           string `json:"name,omitempty"`
+	ActivityType   string `json:"activity_type,omitempty"`
+	StartTime      string `json:"start_time,omitempty"`
+	Action         string `json:"action"`
+	Reason         string `json:"reason,omitempty"`
+	EstimatedBytes int64  `json:"estimated_bytes,omitempty"`
+}
+
+// Plan is what a sync with the same options would do, computed without
+// downloading or writing anything
+type Plan struct {
+	Mode      string     `json:"mode"`
+	From      *time.Time `json:"from,omitempty"`
+	To        *time.Time `json:"to,omitempty"`
+	Force     bool       `json:"force,omitempty"`
+	Remote    int        `json:"remote"` // activities listed from Garmin Connect
+	New       []PlanItem `json:"new"`
+	Changed   []PlanItem `json:"changed"`
+	Deleted   []PlanItem `json:"deleted"`
+	Skipped   []PlanItem `json:"skipped"` // filtered out by the sync rules
+	Blocked   []PlanItem `json:"blocked"` // held back by the retry queue: backing off, dead-lettered or ignored
+	Unchanged int        `json:"unchanged"`
+
+	// DeletionsChecked is false when only part of the account was listed,
+	// so deleted activities could not be detected
+	DeletionsChecked bool `json:"deletions_checked"`
+
+	EstimatedDownloads     int   `json:"estimated_downloads"`
+	EstimatedDownloadBytes int64 `json:"estimated_download_bytes"`
+}
+
+// Plan lists remote activities like a sync with the given options would and
+// classifies them against the database without downloading or storing
+// anything.
+func (s *SyncService) Plan(ctx context.Context, opts Options) (*Plan, error) {
+	if opts.Mode == "" {
+		opts.Mode = ModeIncremental
+	}
+	plan := &Plan{
+		Mode:    opts.Mode,
+		Force:   opts.Force,
+		New:     []PlanItem{},
+		Changed: []PlanItem{},
+		Deleted: []PlanItem{},
+		Skipped: []PlanItem{},
+		Blocked: []PlanItem{},
+	}
+	if !opts.From.IsZero() {
+		plan.From = &opts.From
+	}
+	if !opts.To.IsZero() {
+		plan.To = &opts.To
+	}
+
+	// Not a run: no listing events, which would show a sync in progress
+	activities, err := s.listActivities(ctx, 0, opts, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote activities: %w", err)
+	}
+	plan.Remote = len(activities)
+
+	sizes, overall, err := s.db.AverageFileSizes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate file sizes: %w", err)
+	}
+	estimate := func(activityType string) int64 {
+		if size, ok := sizes[activityType]; ok {
+			return size
+		}
+		if overall > 0 {
+			return overall
+		}
+		return defaultFileSizeEstimate
+	}
+
+	remote := make(map[int]bool, len(activities))
+	for i := range activities {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		activity := &activities[i]
+		remote[activity.ActivityID] = true
+
+		item := PlanItem{
+			ActivityID:   activity.ActivityID,
+			Name:         activity.ActivityName,
+			ActivityType: getActivityType(activity),
+			StartTime:    activity.StartTimeLocal,
+		}
+		existing, err := s.db.GetActivity(activity.ActivityID)
+		if err != nil && !errors.Is(err, database.ErrActivityNotFound) {
+			return nil, err
+		}
+		if reason := s.skipReason(activity); reason != "" && existing == nil {
+			item.Action, item.Reason = PlanSkipped, reason
+			plan.Skipped = append(plan.Skipped, item)
+			continue
+		}
+		if reason := s.retryBlocked(activity.ActivityID); reason != "" {
+			item.Action, item.Reason = PlanBlocked, reason
+			plan.Blocked = append(plan.Blocked, item)
+			continue
+		}
+		item.Action, item.Reason = s.planAction(activity, existing, opts.Force)
+
+		switch item.Action {
+		case PlanNew:
+			item.EstimatedBytes = estimate(item.ActivityType)
+			plan.New = append(plan.New, item)
+		case PlanChanged:
+			item.EstimatedBytes = estimate(item.ActivityType)
+			if existing.FileSize > 0 {
+				item.EstimatedBytes = existing.FileSize
+			}
+			plan.Changed = append(plan.Changed, item)
+		default:
+			plan.Unchanged++
+			continue
+		}
+		plan.EstimatedDownloads++
+		plan.EstimatedDownloadBytes += item.EstimatedBytes
+	}
+
+	// Deletions can only be told apart from unlisted activities when the
+	// whole account was listed
+	plan.DeletionsChecked = opts.Mode == ModeFull && !opts.windowed()
+	if plan.DeletionsChecked {
+		if err := s.planDeletions(plan, remote); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// planAction decides what a sync would do with a listed activity
+func (s *SyncService) planAction(activity *garmin.GarminActivity, existing *database.Activity, force bool) (string, string) {
+	switch {
+	case existing == nil:
+		return PlanNew, "not stored"
+	case !existing.Downloaded:
+		return PlanNew, "file not downloaded"
+	case force:
+		return PlanChanged, "forced"
+	case s.detectChanges && existing.SummaryHash != "" && existing.SummaryHash != summaryHash(activity):
+		return PlanChanged, "summary changed on Garmin Connect"
+	}
+	return PlanUnchanged, ""
+}
+
+// planDeletions adds stored activities missing from the remote listing
+func (s *SyncService) planDeletions(plan *Plan, remote map[int]bool) error {
+	if len(remote) == 0 {
+		return nil
+	}
+
+	ids, err := s.db.GetActivityIDs()
+	if err != nil {
+		return fmt.Errorf("failed to list local activities: %w", err)
+	}
+	for _, id := range ids {
+		if remote[id] {
+			continue
+		}
+		activity, err := s.db.GetActivity(id)
+		if err != nil {
+			return err
+		}
+		if activity.RemoteDeleted {
+			continue
+		}
+		plan.Deleted = append(plan.Deleted, PlanItem{
+			ActivityID:   id,
+			Name:         activity.ActivityName,
+			ActivityType: activity.ActivityType,
+			StartTime:    activity.StartTime.Format(startTimeLayout),
+			Action:       PlanDeleted,
+			Reason:       "not on Garmin Connect",
+		})
+	}
+	return nil
+}
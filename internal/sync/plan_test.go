@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/garmin"
+)
+
+// serveActivities points the service at a garmin-api stub listing the given
+// activities on its first page
+func serveActivities(t *testing.T, s *SyncService, activities []garmin.GarminActivity) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := activities
+		if r.URL.Query().Get("start") != "0" {
+			page = []garmin.GarminActivity{}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(server.Close)
+	s.garminClient.SetBaseURL(server.URL)
+}
+
+func TestPlan(t *testing.T) {
+	s := newTestService(t)
+	serveActivities(t, s, []garmin.GarminActivity{garminActivity(4), garminActivity(3), garminActivity(2), garminActivity(1)})
+	commitTestActivity(t, s, 1, "stored")
+	for id, status := range map[int]string{2: database.RetryDead, 3: database.RetryIgnored} {
+		err := s.db.SaveRetry(&database.RetryEntry{ActivityID: id, Status: status, Attempts: 8})
+		if err != nil {
+			t.Fatalf("SaveRetry: %v", err)
+		}
+	}
+
+	events, unsubscribe := s.Events().Subscribe()
+	defer unsubscribe()
+
+	plan, err := s.Plan(context.Background(), Options{Mode: ModeFull})
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+
+	if plan.Remote != 4 || plan.Unchanged != 1 {
+		t.Errorf("remote %d, unchanged %d; want 4, 1", plan.Remote, plan.Unchanged)
+	}
+	if len(plan.New) != 1 || plan.New[0].ActivityID != 4 {
+		t.Errorf("new = %+v, want activity 4 only", plan.New)
+	}
+	if len(plan.Blocked) != 2 {
+		t.Fatalf("blocked = %+v, want activities 3 and 2", plan.Blocked)
+	}
+	for i, want := range []struct {
+		id     int
+		reason string
+	}{{3, "ignored"}, {2, "dead-lettered after 8 attempts"}} {
+		if item := plan.Blocked[i]; item.ActivityID != want.id || item.Action != PlanBlocked || item.Reason != want.reason {
+			t.Errorf("blocked[%d] = %+v, want activity %d: %s", i, item, want.id, want.reason)
+		}
+	}
+	if plan.EstimatedDownloads != 1 {
+		t.Errorf("estimated downloads = %d, want 1", plan.EstimatedDownloads)
+	}
+
+	select {
+	case e := <-events:
+		t.Errorf("plan published %s event", e.Type)
+	default:
+	}
+}
@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/garmin"
+	"github.com/sstent/garminsync-go/internal/models"
+)
+
+// defaultProcessorTimeout bounds processors registered without a timeout
+const defaultProcessorTimeout = 30 * time.Second
+
+// Processor is a post-sync hook. Processors run in registration order after
+// an activity and its file have been committed, so exporters, analytics or
+// notifications can be added without touching the sync itself.
+type Processor interface {
+	// Name identifies the processor in logs and the error ledger
+	Name() string
+	// Process handles one stored activity. It must return once ctx is done:
+	// the sync waits for it, so a processor that ignores its timeout holds
+	// up the run.
+	Process(ctx context.Context, activity *ProcessedActivity) error
+}
+
+// ProcessedActivity is what processors receive for each stored activity
+type ProcessedActivity struct {
+	Activity *database.Activity      // the row as stored
+	Source   *garmin.GarminActivity  // Garmin summary it was synced from
+	Data     []byte                  // raw activity file
+	Metrics  *models.ActivityMetrics // parsed from Data
+	Outcome  string                  // created or updated
+}
+
+type registeredProcessor struct {
+	processor Processor
+	timeout   time.Duration
+}
+
+// AddProcessor appends a processor to the pipeline. Each call to Process is
+// cut off after timeout, or defaultProcessorTimeout if it is zero.
+// Processors must be added before the first sync starts.
+func (s *SyncService) AddProcessor(processor Processor, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultProcessorTimeout
+	}
+	s.processors = append(s.processors, registeredProcessor{processor: processor, timeout: timeout})
+}
+
+// CloseProcessors closes the processors that implement io.Closer, such as
+// those writing to a file, and returns the first error. No sync may run
+// once it has been called.
+func (s *SyncService) CloseProcessors() error {
+	var first error
+	for _, rp := range s.processors {
+		closer, ok := rp.processor.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil && first == nil {
+			first = fmt.Errorf("failed to close processor %s: %w", rp.processor.Name(), err)
+		}
+	}
+	return first
+}
+
+// runProcessors passes a stored activity through the pipeline. A failing
+// processor is recorded in the error ledger and does not stop the others or
+// affect the stored activity. The activity is committed by now, so
+// cancelling the sync does not cut its processors short; only their timeouts
+// do.
+func (s *SyncService) runProcessors(run *database.SyncRun, item *ProcessedActivity) {
+	for _, rp := range s.processors {
+		err := runProcessor(context.Background(), rp, item)
+		if err == nil {
+			continue
+		}
+
+		id := item.Activity.ActivityID
+		name := rp.processor.Name()
+		fmt.Printf("❌ Processor %s failed for activity %d: %v\n", name, id, err)
+		s.events.Publish(Event{
+			Type:       EventActivityFailed,
+			RunID:      run.ID,
+			ActivityID: id,
+			Stage:      StageProcess,
+			Error:      fmt.Sprintf("%s: %v", name, err),
+		})
+		if _, dbErr := s.db.RecordSyncError(run.ID, id, StageProcess, fmt.Sprintf("%s: %v", name, err)); dbErr != nil {
+			fmt.Printf("❌ Failed to record error for activity %d: %v\n", id, dbErr)
+		}
+	}
+}
+
+// runProcessor calls a processor with its timeout and turns panics into
+// errors. It waits for Process to return rather than abandoning it at the
+// deadline, so no processor outlives the job that called it.
+func runProcessor(ctx context.Context, rp registeredProcessor, item *ProcessedActivity) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, rp.timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	err = rp.processor.Process(ctx, item)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %v: %w", rp.timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+// funcProcessor adapts a function to Processor
+type funcProcessor struct {
+	name    string
+	process func(ctx context.Context, activity *ProcessedActivity) error
+}
+
+func (p funcProcessor) Name() string { return p.name }
+
+func (p funcProcessor) Process(ctx context.Context, activity *ProcessedActivity) error {
+	return p.process(ctx, activity)
+}
+
+func TestRunProcessor(t *testing.T) {
+	item := &ProcessedActivity{Activity: &database.Activity{ActivityID: 1}}
+
+	t.Run("times out and waits for the processor", func(t *testing.T) {
+		returned := false
+		rp := registeredProcessor{timeout: 10 * time.Millisecond, processor: funcProcessor{"slow", func(ctx context.Context, _ *ProcessedActivity) error {
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			returned = true
+			return ctx.Err()
+		}}}
+		err := runProcessor(context.Background(), rp, item)
+		if err == nil || !strings.HasPrefix(err.Error(), "timed out after 10ms") {
+			t.Errorf("err = %v, want a timeout", err)
+		}
+		if !returned {
+			t.Error("runProcessor returned before the processor did")
+		}
+	})
+
+	t.Run("recovers panics", func(t *testing.T) {
+		rp := registeredProcessor{timeout: time.Second, processor: funcProcessor{"broken", func(context.Context, *ProcessedActivity) error {
+			panic("boom")
+		}}}
+		if err := runProcessor(context.Background(), rp, item); err == nil || err.Error() != "panic: boom" {
+			t.Errorf("err = %v, want panic: boom", err)
+		}
+	})
+
+	t.Run("passes errors through", func(t *testing.T) {
+		want := errors.New("rejected")
+		rp := registeredProcessor{timeout: time.Second, processor: funcProcessor{"failing", func(context.Context, *ProcessedActivity) error {
+			return want
+		}}}
+		if err := runProcessor(context.Background(), rp, item); err != want {
+			t.Errorf("err = %v, want %v", err, want)
+		}
+	})
+}
+
+func TestRunProcessors(t *testing.T) {
+	s := newTestService(t)
+	run, err := s.db.CreateSyncRun(TriggerManual)
+	if err != nil {
+		t.Fatalf("CreateSyncRun: %v", err)
+	}
+
+	var calls []string
+	s.AddProcessor(funcProcessor{"failing", func(ctx context.Context, _ *ProcessedActivity) error {
+		calls = append(calls, "failing")
+		return errors.New("rejected")
+	}}, time.Second)
+	s.AddProcessor(funcProcessor{"export", func(ctx context.Context, _ *ProcessedActivity) error {
+		calls = append(calls, "export")
+		return ctx.Err()
+	}}, time.Second)
+
+	// flushBatch takes no sync context: the processors of a committed
+	// activity run with their own, even once the sync was cancelled
+	staged := stageTestActivity(t, s, 1, "Activity", "fit")
+	s.flushBatch(run, []*stagedActivity{staged})
+
+	if strings.Join(calls, ",") != "failing,export" {
+		t.Errorf("processors called: %v, want failing,export", calls)
+	}
+	if n := countSyncErrors(t, s, run.ID); n != 1 {
+		t.Errorf("%d process errors recorded, want 1 for the failing processor", n)
+	}
+}
+
+// closingProcessor is a Processor that also implements io.Closer
+type closingProcessor struct {
+	funcProcessor
+	close func() error
+}
+
+func (p closingProcessor) Close() error { return p.close() }
+
+func TestCloseProcessors(t *testing.T) {
+	s := newTestService(t)
+	var closed []string
+	closer := func(name string, err error) closingProcessor {
+		return closingProcessor{funcProcessor{name: name}, func() error {
+			closed = append(closed, name)
+			return err
+		}}
+	}
+	s.AddProcessor(closer("file", errors.New("disk full")), 0)
+	s.AddProcessor(funcProcessor{name: "webhook"}, 0)
+	s.AddProcessor(closer("influx", nil), 0)
+
+	err := s.CloseProcessors()
+	if err == nil || !strings.Contains(err.Error(), "file: disk full") {
+		t.Errorf("CloseProcessors error = %v, want the file processor's error", err)
+	}
+	if strings.Join(closed, ",") != "file,influx" {
+		t.Errorf("closed %v, want file,influx", closed)
+	}
+}
+
+// countSyncErrors returns the number of process-stage errors of a run
+func countSyncErrors(t *testing.T, s *SyncService, runID int64) int {
+	t.Helper()
+	var n int
+	err := s.db.DB().QueryRow(`SELECT COUNT(*) FROM sync_errors WHERE run_id = ? AND stage = ?`, runID, StageProcess).Scan(&n)
+	if err != nil {
+		t.Fatalf("counting sync errors: %v", err)
+	}
+	return n
+}
@@ -0,0 +1,300 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	stdsync "sync"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/garmin"
+)
+
+// remotePageSize is the number of activities requested per listing call
+// when walking the whole Garmin Connect history
+const remotePageSize = 100
+
+// DeletionPolicy decides what happens to the local copy of an activity that
+// was deleted on Garmin Connect.
+type DeletionPolicy string
+
+const (
+	// DeletionKeep only flags the row; the file stays where it is
+	DeletionKeep DeletionPolicy = "keep"
+	// DeletionArchive moves the file to dataDir/archive
+	DeletionArchive DeletionPolicy = "archive"
+	// DeletionPurge removes both the file and the row
+	DeletionPurge DeletionPolicy = "purge"
+)
+
+// ParseDeletionPolicy validates a policy name. An empty name means keep.
+func ParseDeletionPolicy(name string) (DeletionPolicy, error) {
+	switch DeletionPolicy(name) {
+	case "", DeletionKeep:
+		return DeletionKeep, nil
+	case DeletionArchive, DeletionPurge:
+		return DeletionPolicy(name), nil
+	}
+	return "", fmt.Errorf("unknown deletion policy %q (expected keep, archive or purge)", name)
+}
+
+// ReconcileResult reports what a reconciliation pass found and did
+type ReconcileResult struct {
+	StartedAt   time.Time      `json:"started_at"`
+	FinishedAt  time.Time      `json:"finished_at"`
+	Policy      DeletionPolicy `json:"policy"`
+	RemoteCount int            `json:"remote_count"`
+	LocalCount  int            `json:"local_count"`
+	Deleted     []int          `json:"deleted"`  // newly flagged as remote_deleted
+	Restored    []int          `json:"restored"` // flagged earlier but present again
+	Archived    int            `json:"archived"`
+	Purged      int            `json:"purged"`
+	Errors      []string       `json:"errors"`
+}
+
+// reconcileState holds the most recent reconciliation result
+type reconcileState struct {
+	mu   stdsync.Mutex
+	last *ReconcileResult
+}
+
+// SetDeletionPolicy sets how Reconcile treats activities deleted upstream
+func (s *SyncService) SetDeletionPolicy(policy DeletionPolicy) {
+	s.deletionPolicy = policy
+}
+
+// LastReconcile returns the result of the most recent Reconcile call, or nil
+// if none has run since startup.
+func (s *SyncService) LastReconcile() *ReconcileResult {
+	s.reconcile.mu.Lock()
+	defer s.reconcile.mu.Unlock()
+	return s.reconcile.last
+}
+
+// Reconcile compares the full list of remote activities with the local
+// table and flags activities missing upstream as remote_deleted. The
+// deletion policy is applied to every flagged activity it has not been
+// applied to yet, so a failed archive or purge is retried by the next pass
+// and a stricter policy also reaches activities flagged under an earlier
+// one. Activities that are back upstream are unflagged and their archived
+// file is moved back; one whose file is gone is queued for download.
+func (s *SyncService) Reconcile(ctx context.Context) (*ReconcileResult, error) {
+	policy := s.deletionPolicy
+	if policy == "" {
+		policy = DeletionKeep
+	}
+	result := &ReconcileResult{StartedAt: time.Now(), Policy: policy, Deleted: []int{}, Restored: []int{}, Errors: []string{}}
+
+	release, err := s.acquireJob("reconcile")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	remote := make(map[int]garmin.GarminActivity)
+	err = s.forEachRemotePage(ctx, func(page []garmin.GarminActivity) (bool, error) {
+		for _, activity := range page {
+			remote[activity.ActivityID] = activity
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote activities: %w", err)
+	}
+	result.RemoteCount = len(remote)
+
+	localIDs, err := s.db.GetActivityIDs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local activities: %w", err)
+	}
+	result.LocalCount = len(localIDs)
+
+	// An empty remote list almost always means the API misbehaved; acting on
+	// it would flag the entire archive
+	if result.RemoteCount == 0 && result.LocalCount > 0 {
+		return nil, fmt.Errorf("remote returned no activities while %d exist locally, refusing to reconcile", result.LocalCount)
+	}
+
+	for _, id := range localIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		activity, err := s.db.GetActivity(id)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("activity %d: %v", id, err))
+			continue
+		}
+
+		if summary, ok := remote[id]; ok {
+			if activity.RemoteDeleted {
+				if err := s.restoreActivity(activity, &summary); err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("activity %d: restore failed: %v", id, err))
+					continue
+				}
+				result.Restored = append(result.Restored, id)
+			}
+			continue
+		}
+
+		if !activity.RemoteDeleted {
+			if err := s.db.SetRemoteDeleted(id, true); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("activity %d: %v", id, err))
+				continue
+			}
+			result.Deleted = append(result.Deleted, id)
+		}
+
+		switch policy {
+		case DeletionArchive:
+			if !activity.Downloaded || s.archived(activity.Filename) {
+				continue
+			}
+			if err := s.archiveFile(id, activity.Filename); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("activity %d: archive failed: %v", id, err))
+				continue
+			}
+			result.Archived++
+		case DeletionPurge:
+			if err := s.purgeActivity(activity); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("activity %d: purge failed: %v", id, err))
+				continue
+			}
+			result.Purged++
+		}
+	}
+
+	result.FinishedAt = time.Now()
+	fmt.Printf("Reconciliation: %d remote, %d local, %d deleted upstream, %d restored\n",
+		result.RemoteCount, result.LocalCount, len(result.Deleted), len(result.Restored))
+
+	s.reconcile.mu.Lock()
+	s.reconcile.last = result
+	s.reconcile.mu.Unlock()
+
+	return result, nil
+}
+
+// archived reports whether a file is in dataDir/archive
+func (s *SyncService) archived(filename string) bool {
+	return filename != "" && filepath.Dir(filepath.Clean(filename)) == filepath.Join(s.dataDir, "archive")
+}
+
+// archiveFile moves an activity file into dataDir/archive and updates the row
+func (s *SyncService) archiveFile(activityID int, filename string) error {
+	if filename == "" {
+		return nil
+	}
+
+	archived := filepath.Join(s.dataDir, "archive", filepath.Base(filename))
+	if err := os.MkdirAll(filepath.Dir(archived), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(filename, archived); err != nil {
+		if os.IsNotExist(err) {
+			return s.db.SetActivityFile(activityID, filename, false)
+		}
+		return err
+	}
+	return s.db.SetActivityFile(activityID, archived, true)
+}
+
+// purgeActivity deletes an activity's row and then its file. Deleting the
+// row first means a failure never leaves a row pointing at a removed file;
+// a file left behind by a failed removal shows up as untracked in Verify.
+func (s *SyncService) purgeActivity(activity *database.Activity) error {
+	if err := s.db.DeleteActivity(activity.ActivityID); err != nil {
+		return err
+	}
+	if activity.Filename == "" {
+		return nil
+	}
+	if err := os.Remove(activity.Filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// restoreActivity unflags an activity that is back on Garmin Connect and
+// moves its archived file back into dataDir/activities. If the file is gone,
+// the row is marked not downloaded and queued in the retry queue, which the
+// next sync works through wherever its listing stops.
+func (s *SyncService) restoreActivity(activity *database.Activity, summary *garmin.GarminActivity) error {
+	id := activity.ActivityID
+	if err := s.db.SetRemoteDeleted(id, false); err != nil {
+		return err
+	}
+
+	filename := filepath.Join(s.dataDir, "activities", filepath.Base(activity.Filename))
+	if activity.Filename == "" {
+		filename = filepath.Join(s.dataDir, "activities", fmt.Sprintf("%d.fit", id))
+	}
+	if activity.Downloaded {
+		_, err := os.Stat(activity.Filename)
+		switch {
+		case err == nil && activity.Filename == filename:
+			return nil
+		case err == nil:
+			if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(activity.Filename, filename); err != nil {
+				return err
+			}
+			return s.db.SetActivityFile(id, filename, true)
+		case !os.IsNotExist(err):
+			return err
+		}
+	}
+
+	if err := s.db.SetActivityFile(id, filename, false); err != nil {
+		return err
+	}
+	return s.queueDownload(summary)
+}
+
+// queueDownload puts an activity in the retry queue, due now, so the next
+// sync downloads it even if its listing stops before reaching it
+func (s *SyncService) queueDownload(activity *garmin.GarminActivity) error {
+	summary, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	return s.db.SaveRetry(&database.RetryEntry{
+		ActivityID:    activity.ActivityID,
+		Status:        database.RetryPending,
+		NextAttemptAt: time.Now(),
+		LastStage:     StageFile,
+		LastError:     "file missing after the activity was restored upstream",
+		Summary:       string(summary),
+	})
+}
+
+// forEachRemotePage walks the remote activity list newest first, one page
+// at a time, until the list is exhausted or fn returns false.
+func (s *SyncService) forEachRemotePage(ctx context.Context, fn func(page []garmin.GarminActivity) (bool, error)) error {
+	for start := 0; ; start += remotePageSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page, err := s.garminClient.GetActivities(start, remotePageSize)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		more, err := fn(page)
+		if err != nil || !more {
+			return err
+		}
+		if len(page) < remotePageSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/garmin"
+)
+
+// reconcileWith serves the given remote activities and runs Reconcile
+func reconcileWith(t *testing.T, s *SyncService, ids ...int) *ReconcileResult {
+	t.Helper()
+	var remote []garmin.GarminActivity
+	for _, id := range ids {
+		remote = append(remote, garminActivity(id))
+	}
+	serveActivities(t, s, remote)
+
+	result, err := s.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("Reconcile errors: %v", result.Errors)
+	}
+	return result
+}
+
+func getActivity(t *testing.T, s *SyncService, id int) *database.Activity {
+	t.Helper()
+	activity, err := s.db.GetActivity(id)
+	if err != nil {
+		t.Fatalf("GetActivity(%d): %v", id, err)
+	}
+	return activity
+}
+
+func TestReconcileArchiveAndRestore(t *testing.T) {
+	s := newTestService(t)
+	s.SetDeletionPolicy(DeletionArchive)
+	commitTestActivity(t, s, 1, "one")
+	commitTestActivity(t, s, 2, "two")
+	stored := filepath.Join(s.dataDir, "activities", "1.fit")
+	archived := filepath.Join(s.dataDir, "archive", "1.fit")
+
+	result := reconcileWith(t, s, 2)
+	if len(result.Deleted) != 1 || result.Deleted[0] != 1 || result.Archived != 1 {
+		t.Fatalf("deleted %v, archived %d; want [1], 1", result.Deleted, result.Archived)
+	}
+	activity := getActivity(t, s, 1)
+	if !activity.RemoteDeleted || activity.Filename != archived || !activity.Downloaded {
+		t.Errorf("after archive: %+v, want flagged and downloaded at %s", activity, archived)
+	}
+	if readFile(t, stored) != "" || readFile(t, archived) != "one" {
+		t.Errorf("file not moved to the archive")
+	}
+
+	// Already archived: a second pass leaves it alone
+	if result := reconcileWith(t, s, 2); len(result.Deleted) != 0 || result.Archived != 0 {
+		t.Errorf("second pass deleted %v, archived %d; want nothing", result.Deleted, result.Archived)
+	}
+
+	result = reconcileWith(t, s, 1, 2)
+	if len(result.Restored) != 1 || result.Restored[0] != 1 {
+		t.Fatalf("restored %v, want [1]", result.Restored)
+	}
+	activity = getActivity(t, s, 1)
+	if activity.RemoteDeleted || activity.Filename != stored || !activity.Downloaded {
+		t.Errorf("after restore: %+v, want unflagged and downloaded at %s", activity, stored)
+	}
+	if readFile(t, stored) != "one" || readFile(t, archived) != "" {
+		t.Errorf("file not moved back from the archive")
+	}
+}
+
+func TestReconcileAppliesPolicyToFlaggedActivities(t *testing.T) {
+	s := newTestService(t)
+	commitTestActivity(t, s, 1, "one")
+	commitTestActivity(t, s, 2, "two")
+
+	if result := reconcileWith(t, s, 2); len(result.Deleted) != 1 || result.Archived != 0 {
+		t.Fatalf("keep: deleted %v, archived %d; want [1], 0", result.Deleted, result.Archived)
+	}
+
+	// Switching policy reaches the activity flagged by the earlier pass
+	s.SetDeletionPolicy(DeletionArchive)
+	if result := reconcileWith(t, s, 2); len(result.Deleted) != 0 || result.Archived != 1 {
+		t.Errorf("archive: deleted %v, archived %d; want [], 1", result.Deleted, result.Archived)
+	}
+
+	s.SetDeletionPolicy(DeletionPurge)
+	if result := reconcileWith(t, s, 2); result.Purged != 1 {
+		t.Errorf("purge: purged %d, want 1", result.Purged)
+	}
+	if _, err := s.db.GetActivity(1); !errors.Is(err, database.ErrActivityNotFound) {
+		t.Errorf("GetActivity after purge: %v, want ErrActivityNotFound", err)
+	}
+	if readFile(t, filepath.Join(s.dataDir, "archive", "1.fit")) != "" {
+		t.Errorf("purged file left behind")
+	}
+	if getActivity(t, s, 2).RemoteDeleted {
+		t.Errorf("activity 2 flagged although it exists upstream")
+	}
+}
+
+func TestReconcileRestoreQueuesMissingFile(t *testing.T) {
+	s := newTestService(t)
+	staged := commitTestActivity(t, s, 1, "one")
+	commitTestActivity(t, s, 2, "two")
+
+	reconcileWith(t, s, 2)
+	if err := os.Remove(staged.activity.Filename); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := reconcileWith(t, s, 1, 2); len(result.Restored) != 1 {
+		t.Fatalf("restored %v, want [1]", result.Restored)
+	}
+	if activity := getActivity(t, s, 1); activity.RemoteDeleted || activity.Downloaded {
+		t.Errorf("after restore: %+v, want unflagged and not downloaded", activity)
+	}
+	entry, err := s.db.GetRetry(1)
+	if err != nil || entry == nil || entry.Status != database.RetryPending {
+		t.Fatalf("retry entry = %+v, %v; want a pending entry", entry, err)
+	}
+	if blocked := s.retryBlocked(1); blocked != "" {
+		t.Errorf("queued download is blocked: %s", blocked)
+	}
+}
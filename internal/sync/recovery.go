@@ -0,0 +1,119 @@
+package sync
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RecoveryReport lists what Recover found after an unclean shutdown
+type RecoveryReport struct {
+	TempFilesRemoved int      `json:"temp_files_removed"`
+	RestoredFiles    []string `json:"restored_files"` // updated files rolled back to their backup
+	OrphanFiles      []string `json:"orphan_files"`   // files without a row, moved to dataDir/orphans
+	MissingFiles     []int    `json:"missing_files"`  // rows whose file is gone, marked not downloaded
+}
+
+// Recover reconciles the activity directory with the database after a crash.
+// It deletes staged temp files that never got committed, puts back the
+// previous file of updated activities whose batch did not commit, moves files
+// that have no row out of the archive, and marks rows whose file is missing
+// as not downloaded so the next sync fetches them again.
+func (s *SyncService) Recover() (*RecoveryReport, error) {
+	report := &RecoveryReport{RestoredFiles: []string{}, OrphanFiles: []string{}, MissingFiles: []int{}}
+
+	release, err := s.acquireJob("recovery")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	files, err := s.db.GetDownloadedFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list activity files: %w", err)
+	}
+	known := make(map[string]int, len(files))
+	for id, filename := range files {
+		known[filepath.Clean(filename)] = id
+	}
+
+	activityDir := filepath.Join(s.dataDir, "activities")
+	orphanDir := filepath.Join(s.dataDir, "orphans")
+	err = filepath.WalkDir(activityDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		if strings.HasSuffix(path, tempSuffix) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			report.TempFilesRemoved++
+			return nil
+		}
+
+		if strings.HasSuffix(path, backupSuffix) {
+			target := strings.TrimSuffix(path, backupSuffix)
+			if id, ok := known[filepath.Clean(target)]; ok {
+				restored, err := s.recoverBackup(id, path, target)
+				if err != nil {
+					return err
+				}
+				if restored {
+					report.RestoredFiles = append(report.RestoredFiles, target)
+				}
+				return nil
+			}
+		}
+
+		if _, ok := known[filepath.Clean(path)]; ok {
+			return nil
+		}
+		if err := os.MkdirAll(orphanDir, 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(path, filepath.Join(orphanDir, d.Name())); err != nil {
+			return err
+		}
+		report.OrphanFiles = append(report.OrphanFiles, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan activity directory: %w", err)
+	}
+
+	for id, filename := range files {
+		if _, err := os.Stat(filename); err == nil || !os.IsNotExist(err) {
+			continue
+		}
+		if err := s.db.SetActivityFile(id, filename, false); err != nil {
+			return nil, fmt.Errorf("failed to update activity %d: %w", id, err)
+		}
+		report.MissingFiles = append(report.MissingFiles, id)
+	}
+
+	return report, nil
+}
+
+// recoverBackup resolves the backup of an updated activity's file. If the
+// file in place matches the checksum of the row, the update committed and
+// the backup is deleted; otherwise the backup is put back. It reports
+// whether the backup was restored.
+func (s *SyncService) recoverBackup(activityID int, backup, filename string) (bool, error) {
+	activity, err := s.db.GetActivity(activityID)
+	if err != nil {
+		return false, err
+	}
+	if _, sum, err := hashFile(filename); err == nil && sum == activity.FileSHA256 {
+		return false, os.Remove(backup)
+	}
+	return true, os.Rename(backup, filename)
+}
@@ -0,0 +1,103 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestFile creates a file with the given content, and its directory
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	s := newTestService(t)
+	activityDir := filepath.Join(s.dataDir, "activities")
+
+	// Activity 1: crashed after the renames, before the commit; the backup
+	// holds the file the row describes
+	uncommitted := commitTestActivity(t, s, 1, "committed content")
+	os.Rename(uncommitted.activity.Filename, uncommitted.activity.Filename+backupSuffix)
+	writeTestFile(t, uncommitted.activity.Filename, "uncommitted content")
+
+	// Activity 2: crashed after the commit, before the backup was removed
+	committed := commitTestActivity(t, s, 2, "new content")
+	writeTestFile(t, committed.activity.Filename+backupSuffix, "old content")
+
+	// Activity 3: its file is gone
+	missing := commitTestActivity(t, s, 3, "lost content")
+	os.Remove(missing.activity.Filename)
+
+	// A staged file that never got committed, and a file without a row
+	stray := filepath.Join(activityDir, "4.fit"+tempSuffix)
+	writeTestFile(t, stray, "staged")
+	orphan := filepath.Join(activityDir, "5.fit")
+	writeTestFile(t, orphan, "orphan")
+
+	report, err := s.Recover()
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+
+	if report.TempFilesRemoved != 1 {
+		t.Errorf("TempFilesRemoved = %d, want 1", report.TempFilesRemoved)
+	}
+	if want := []string{uncommitted.activity.Filename}; !reflect.DeepEqual(report.RestoredFiles, want) {
+		t.Errorf("RestoredFiles = %v, want %v", report.RestoredFiles, want)
+	}
+	if want := []string{orphan}; !reflect.DeepEqual(report.OrphanFiles, want) {
+		t.Errorf("OrphanFiles = %v, want %v", report.OrphanFiles, want)
+	}
+	if want := []int{3}; !reflect.DeepEqual(report.MissingFiles, want) {
+		t.Errorf("MissingFiles = %v, want %v", report.MissingFiles, want)
+	}
+
+	files := []struct {
+		path string
+		want string
+	}{
+		{uncommitted.activity.Filename, "committed content"},
+		{committed.activity.Filename, "new content"},
+		{stray, ""},
+		{orphan, ""},
+		{filepath.Join(s.dataDir, "orphans", "5.fit"), "orphan"},
+	}
+	for _, f := range files {
+		if got := readFile(t, f.path); got != f.want {
+			t.Errorf("%s = %q, want %q", f.path, got, f.want)
+		}
+	}
+	assertNoLeftovers(t, s)
+
+	row, err := s.db.GetActivity(3)
+	if err != nil {
+		t.Fatalf("GetActivity: %v", err)
+	}
+	if row.Downloaded {
+		t.Error("activity with a missing file still marked downloaded")
+	}
+}
+
+func TestRecoverIsIdempotent(t *testing.T) {
+	s := newTestService(t)
+	commitTestActivity(t, s, 1, "content")
+
+	for i := 0; i < 2; i++ {
+		report, err := s.Recover()
+		if err != nil {
+			t.Fatalf("Recover: %v", err)
+		}
+		if report.TempFilesRemoved != 0 || len(report.RestoredFiles) != 0 ||
+			len(report.OrphanFiles) != 0 || len(report.MissingFiles) != 0 {
+			t.Errorf("run %d changed a consistent archive: %+v", i+1, report)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	stdsync "sync"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/models"
+	"github.com/sstent/garminsync-go/internal/parser"
+)
+
+// ErrReprocessRunning is returned when a reprocess job is started while
+// another one is still running
+var ErrReprocessRunning = errors.New("reprocess already running")
+
+// maxReprocessErrors caps the error messages kept in a report
+const maxReprocessErrors = 100
+
+// ReprocessOptions selects the stored activities to parse again
+type ReprocessOptions struct {
+	ActivityType string
+
+	// From and To limit the job to activities starting in [From, To), as
+	// returned by ParseWindow. A zero bound is open.
+	From time.Time
+	To   time.Time
+
+	// Workers is the number of files parsed in parallel; it defaults to the
+	// number of CPUs
+	Workers int
+
+	// Progress, if set, is called after each activity with a snapshot of
+	// the report
+	Progress func(ReprocessReport)
+}
+
+// ReprocessReport describes a running or finished reprocess job
+type ReprocessReport struct {
+	Running      bool       `json:"running"`
+	ActivityType string     `json:"activity_type,omitempty"`
+	From         string     `json:"from,omitempty"`
+	To           string     `json:"to,omitempty"`
+	Workers      int        `json:"workers"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	Total        int        `json:"total"`
+	Processed    int        `json:"processed"`
+	Updated      int        `json:"updated"`
+	Failed       int        `json:"failed"`
+	Errors       []string   `json:"errors"`
+	Error        string     `json:"error,omitempty"` // set when the job itself failed
+}
+
+// reprocessState holds the report of the current or most recent job
+type reprocessState struct {
+	mu     stdsync.Mutex
+	report *ReprocessReport
+}
+
+// LastReprocess returns a snapshot of the running or most recent reprocess
+// job, or nil if none has run since startup.
+func (s *SyncService) LastReprocess() *ReprocessReport {
+	s.reprocess.mu.Lock()
+	defer s.reprocess.mu.Unlock()
+	if s.reprocess.report == nil {
+		return nil
+	}
+	report := s.reprocess.snapshot()
+	return &report
+}
+
+// Reprocess parses the stored files of the selected activities again and
+// updates their file-derived columns and laps, without downloading
+// anything. It returns once every activity has been processed.
+func (s *SyncService) Reprocess(ctx context.Context, opts ReprocessOptions) (*ReprocessReport, error) {
+	release, err := s.beginReprocess(&opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.runReprocess(ctx, opts, release)
+}
+
+// StartReprocess starts a reprocess job in the background and returns its
+// initial report. Use LastReprocess to follow its progress.
+func (s *SyncService) StartReprocess(ctx context.Context, opts ReprocessOptions) (*ReprocessReport, error) {
+	release, err := s.beginReprocess(&opts)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if _, err := s.runReprocess(ctx, opts, release); err != nil {
+			fmt.Printf("❌ Reprocess failed: %v\n", err)
+		}
+	}()
+	return s.LastReprocess(), nil
+}
+
+// beginReprocess takes the job lock and resets the report of a new job. The
+// returned function releases the lock once the job is done.
+func (s *SyncService) beginReprocess(opts *ReprocessOptions) (func(), error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+
+	s.reprocess.mu.Lock()
+	defer s.reprocess.mu.Unlock()
+	if s.reprocess.report != nil && s.reprocess.report.Running {
+		return nil, ErrReprocessRunning
+	}
+	release, err := s.acquireJob("reprocess")
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReprocessReport{
+		Running:      true,
+		ActivityType: opts.ActivityType,
+		Workers:      opts.Workers,
+		StartedAt:    time.Now(),
+		Errors:       []string{},
+	}
+	if !opts.From.IsZero() {
+		report.From = opts.From.Format(dateLayout)
+	}
+	if !opts.To.IsZero() {
+		report.To = opts.To.AddDate(0, 0, -1).Format(dateLayout)
+	}
+	s.reprocess.report = report
+	return release, nil
+}
+
+// runReprocess runs a job begun by beginReprocess and calls release before
+// the report shows it finished, so a new job can start as soon as it does
+func (s *SyncService) runReprocess(ctx context.Context, opts ReprocessOptions, release func()) (*ReprocessReport, error) {
+	activities, err := s.reprocessCandidates(opts)
+	if err == nil {
+		s.reprocess.mu.Lock()
+		s.reprocess.report.Total = len(activities)
+		s.reprocess.mu.Unlock()
+		err = s.reprocessAll(ctx, activities, opts)
+	}
+
+	s.reprocess.mu.Lock()
+	release()
+	report := s.reprocess.report
+	finished := time.Now()
+	report.Running = false
+	report.FinishedAt = &finished
+	if err != nil {
+		report.Error = err.Error()
+	}
+	result := s.reprocess.snapshot()
+	s.reprocess.mu.Unlock()
+
+	fmt.Printf("Reprocess: %d of %d processed, %d updated, %d failed\n",
+		result.Processed, result.Total, result.Updated, result.Failed)
+	if err != nil {
+		return &result, err
+	}
+	return &result, nil
+}
+
+// reprocessCandidates lists the downloaded activities matching the options
+func (s *SyncService) reprocessCandidates(opts ReprocessOptions) ([]database.Activity, error) {
+	downloaded := true
+	filters := database.ActivityFilters{
+		ActivityType: opts.ActivityType,
+		Downloaded:   &downloaded,
+		Limit:        verifyPageSize,
+	}
+	if !opts.From.IsZero() {
+		filters.DateFrom = &opts.From
+	}
+	if !opts.To.IsZero() {
+		// DateTo is inclusive, the window end is not
+		to := opts.To.Add(-time.Second)
+		filters.DateTo = &to
+	}
+
+	var activities []database.Activity
+	for {
+		page, err := s.db.ListActivities(filters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list activities: %w", err)
+		}
+		activities = append(activities, page.Activities...)
+		if page.NextCursor == "" {
+			return activities, nil
+		}
+		filters.Cursor = page.NextCursor
+	}
+}
+
+// reprocessAll feeds the activities to opts.Workers parsing goroutines
+func (s *SyncService) reprocessAll(ctx context.Context, activities []database.Activity, opts ReprocessOptions) error {
+	work := make(chan *database.Activity)
+	var wg stdsync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fileParser := parser.NewParser()
+			for activity := range work {
+				err := s.reprocessActivity(fileParser, activity)
+				s.recordReprocessed(activity.ActivityID, err, opts.Progress)
+			}
+		}()
+	}
+
+	var err error
+	for i := range activities {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		work <- &activities[i]
+	}
+	close(work)
+	wg.Wait()
+	return err
+}
+
+func (s *SyncService) reprocessActivity(fileParser *parser.Parser, activity *database.Activity) error {
+	if activity.Filename == "" {
+		return errors.New("no stored file")
+	}
+	metrics, err := fileParser.ParseFile(activity.Filename)
+	if err != nil {
+		return fmt.Errorf("parsing failed: %w", err)
+	}
+	if err := s.db.UpdateParsedMetrics(activity.ActivityID, parsedMetrics(metrics), lapRows(activity.ActivityID, metrics)); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
+// recordReprocessed counts one finished activity and reports progress
+func (s *SyncService) recordReprocessed(activityID int, err error, progress func(ReprocessReport)) {
+	s.reprocess.mu.Lock()
+	report := s.reprocess.report
+	report.Processed++
+	if err != nil {
+		report.Failed++
+		if len(report.Errors) < maxReprocessErrors {
+			report.Errors = append(report.Errors, fmt.Sprintf("activity %d: %v", activityID, err))
+		}
+	} else {
+		report.Updated++
+	}
+	snapshot := s.reprocess.snapshot()
+	s.reprocess.mu.Unlock()
+
+	if progress != nil {
+		progress(snapshot)
+	}
+}
+
+// snapshot copies the current report; the caller must hold mu
+func (r *reprocessState) snapshot() ReprocessReport {
+	report := *r.report
+	report.Errors = append([]string{}, r.report.Errors...)
+	return report
+}
+
+// parsedMetrics maps parser output onto the file-derived activity columns
+func parsedMetrics(metrics *models.ActivityMetrics) database.ParsedMetrics {
+	return database.ParsedMetrics{
+		Duration:      int(metrics.Duration.Seconds()),
+		Distance:      metrics.Distance,
+		MaxHeartRate:  metrics.MaxHeartRate,
+		AvgHeartRate:  metrics.AvgHeartRate,
+		AvgPower:      float64(metrics.AvgPower),
+		Calories:      metrics.Calories,
+		Steps:         metrics.Steps,
+		ElevationGain: metrics.ElevationGain,
+		FileStartTime: metrics.StartTime,
+		DeviceSerial:  metrics.DeviceSerial,
+	}
+}
+
+// lapRows converts parsed laps into activity_laps rows
+func lapRows(activityID int, metrics *models.ActivityMetrics) []database.Lap {
+	laps := make([]database.Lap, 0, len(metrics.Laps))
+	for _, lap := range metrics.Laps {
+		laps = append(laps, database.Lap{
+			ActivityID:    activityID,
+			Index:         lap.Index,
+			StartTime:     lap.StartTime,
+			Duration:      lap.Duration.Seconds(),
+			Distance:      lap.Distance,
+			AvgSpeed:      lap.AvgSpeed,
+			MaxSpeed:      lap.MaxSpeed,
+			AvgHeartRate:  lap.AvgHeartRate,
+			MaxHeartRate:  lap.MaxHeartRate,
+			AvgCadence:    lap.AvgCadence,
+			MaxCadence:    lap.MaxCadence,
+			AvgPower:      lap.AvgPower,
+			MaxPower:      lap.MaxPower,
+			Calories:      lap.Calories,
+			ElevationGain: lap.ElevationGain,
+			ElevationLoss: lap.ElevationLoss,
+		})
+	}
+	return laps
+}
@@ -0,0 +1,247 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	stdsync "sync"
+	"testing"
+	"time"
+)
+
+// gpxTrack is a two-point GPX track of about 111 m starting at start
+func gpxTrack(start time.Time) string {
+	return fmt.Sprintf(`<?xml version="1.0"?>
+<gpx version="1.1" creator="test"><trk><name>Run</name><type>running</type><trkseg>
+<trkpt lat="52.0" lon="4.0"><time>%s</time></trkpt>
+<trkpt lat="52.001" lon="4.0"><time>%s</time></trkpt>
+</trkseg></trk></gpx>`, start.Format(time.RFC3339), start.Add(time.Minute).Format(time.RFC3339))
+}
+
+// commitReprocessActivity stores an activity of the given type and start
+// time whose file holds content
+func commitReprocessActivity(t *testing.T, s *SyncService, id int, activityType string, start time.Time, content string) {
+	t.Helper()
+	staged := stageTestActivity(t, s, id, "Activity", content)
+	staged.activity.ActivityType = activityType
+	staged.activity.StartTime = start
+	if _, err := s.commitBatch([]*stagedActivity{staged}); err != nil {
+		t.Fatalf("commitBatch(%d): %v", id, err)
+	}
+}
+
+// reprocessed reports whether the activity's file was parsed again, which
+// sets its file start time and distance
+func reprocessed(t *testing.T, s *SyncService, id int) bool {
+	t.Helper()
+	activity := getActivity(t, s, id)
+	return activity.FileStartTime != nil && activity.Distance > 100
+}
+
+func TestReprocess(t *testing.T) {
+	s := newTestService(t)
+	start := time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)
+	for id := 1; id <= 4; id++ {
+		commitReprocessActivity(t, s, id, "running", start.Add(time.Duration(id)*time.Hour), gpxTrack(start))
+	}
+	commitReprocessActivity(t, s, 5, "running", start, "not an activity file")
+
+	// The first two activities only report back once both are in flight, so
+	// the job finishes only if two workers parse in parallel
+	var (
+		mu          stdsync.Mutex
+		inFlight    int
+		maxInFlight int
+		progress    []int
+		both        = make(chan struct{})
+		bothOnce    stdsync.Once
+	)
+	report, err := s.Reprocess(context.Background(), ReprocessOptions{Workers: 2, Progress: func(r ReprocessReport) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		if inFlight == 2 {
+			bothOnce.Do(func() { close(both) })
+		}
+		progress = append(progress, r.Processed)
+		mu.Unlock()
+
+		if r.Processed <= 2 {
+			select {
+			case <-both:
+			case <-time.After(5 * time.Second):
+			}
+		}
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}})
+	if err != nil {
+		t.Fatalf("Reprocess: %v", err)
+	}
+
+	if maxInFlight != 2 {
+		t.Errorf("at most %d activities in flight, want 2 workers in parallel", maxInFlight)
+	}
+	if len(progress) != 5 {
+		t.Errorf("progress reported %d times, want once per activity", len(progress))
+	}
+	if report.Running || report.FinishedAt == nil || report.Workers != 2 {
+		t.Errorf("report = %+v, want a finished job with 2 workers", report)
+	}
+	if report.Total != 5 || report.Processed != 5 || report.Updated != 4 || report.Failed != 1 {
+		t.Errorf("total %d, processed %d, updated %d, failed %d; want 5, 5, 4, 1",
+			report.Total, report.Processed, report.Updated, report.Failed)
+	}
+	if len(report.Errors) != 1 || !strings.HasPrefix(report.Errors[0], "activity 5: parsing failed") {
+		t.Errorf("errors = %q, want the parse failure of activity 5", report.Errors)
+	}
+	for id := 1; id <= 4; id++ {
+		if !reprocessed(t, s, id) {
+			t.Errorf("activity %d not updated", id)
+		}
+	}
+	if last := s.LastReprocess(); last == nil || last.Processed != 5 || last.Running {
+		t.Errorf("LastReprocess = %+v, want the finished report", last)
+	}
+}
+
+func TestReprocessFilters(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 9, 0, 0, 0, time.UTC) }
+	window := func(from, to string) (time.Time, time.Time) {
+		start, end, err := ParseWindow(from, to)
+		if err != nil {
+			t.Fatalf("ParseWindow: %v", err)
+		}
+		return start, end
+	}
+
+	tests := []struct {
+		name     string
+		opts     func() ReprocessOptions
+		want     []int
+		from, to string
+	}{
+		{"all", func() ReprocessOptions { return ReprocessOptions{} }, []int{1, 2, 3, 4}, "", ""},
+		{"type", func() ReprocessOptions { return ReprocessOptions{ActivityType: "cycling"} }, []int{2, 4}, "", ""},
+		{"single day", func() ReprocessOptions {
+			from, to := window("2024-03-02", "2024-03-02")
+			return ReprocessOptions{From: from, To: to}
+		}, []int{2}, "2024-03-02", "2024-03-02"},
+		{"open start", func() ReprocessOptions {
+			_, to := window("", "2024-03-02")
+			return ReprocessOptions{To: to}
+		}, []int{1, 2}, "", "2024-03-02"},
+		{"type and window", func() ReprocessOptions {
+			from, _ := window("2024-03-02", "")
+			return ReprocessOptions{ActivityType: "running", From: from}
+		}, []int{3}, "2024-03-02", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			types := map[int]string{1: "running", 2: "cycling", 3: "running", 4: "cycling"}
+			for id := 1; id <= 4; id++ {
+				commitReprocessActivity(t, s, id, types[id], day(id), gpxTrack(day(id)))
+			}
+
+			report, err := s.Reprocess(context.Background(), tt.opts())
+			if err != nil {
+				t.Fatalf("Reprocess: %v", err)
+			}
+			if report.Total != len(tt.want) || report.Updated != len(tt.want) {
+				t.Errorf("total %d, updated %d; want %d", report.Total, report.Updated, len(tt.want))
+			}
+			if report.From != tt.from || report.To != tt.to {
+				t.Errorf("report window %q to %q, want %q to %q", report.From, report.To, tt.from, tt.to)
+			}
+			want := make(map[int]bool)
+			for _, id := range tt.want {
+				want[id] = true
+			}
+			for id := 1; id <= 4; id++ {
+				if got := reprocessed(t, s, id); got != want[id] {
+					t.Errorf("activity %d reprocessed = %v, want %v", id, got, want[id])
+				}
+			}
+		})
+	}
+}
+
+func TestStartReprocessGuard(t *testing.T) {
+	s := newTestService(t)
+	start := time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)
+	commitReprocessActivity(t, s, 1, "running", start, gpxTrack(start))
+
+	reached := make(chan struct{})
+	release := make(chan struct{})
+	first, err := s.StartReprocess(context.Background(), ReprocessOptions{Progress: func(ReprocessReport) {
+		close(reached)
+		<-release
+	}})
+	if err != nil {
+		t.Fatalf("StartReprocess: %v", err)
+	}
+	if !first.Running {
+		t.Errorf("initial report = %+v, want a running job", first)
+	}
+	<-reached
+
+	if _, err := s.StartReprocess(context.Background(), ReprocessOptions{}); !errors.Is(err, ErrReprocessRunning) {
+		t.Errorf("second StartReprocess = %v, want ErrReprocessRunning", err)
+	}
+	if _, err := s.Reprocess(context.Background(), ReprocessOptions{}); !errors.Is(err, ErrReprocessRunning) {
+		t.Errorf("Reprocess while running = %v, want ErrReprocessRunning", err)
+	}
+	if last := s.LastReprocess(); last == nil || !last.Running || last.Processed != 1 {
+		t.Errorf("LastReprocess = %+v, want the running job", last)
+	}
+
+	close(release)
+	waitForReprocess(t, s)
+
+	// The guard and the job lock are released once the job finished
+	report, err := s.Reprocess(context.Background(), ReprocessOptions{})
+	if err != nil || report.Updated != 1 {
+		t.Errorf("Reprocess after the first finished = %+v, %v; want 1 updated", report, err)
+	}
+}
+
+func TestStartReprocessCancelled(t *testing.T) {
+	s := newTestService(t)
+	start := time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)
+	for id := 1; id <= 3; id++ {
+		commitReprocessActivity(t, s, id, "running", start.Add(time.Duration(id)*time.Hour), gpxTrack(start))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.StartReprocess(ctx, ReprocessOptions{}); err != nil {
+		t.Fatalf("StartReprocess: %v", err)
+	}
+	report := waitForReprocess(t, s)
+	if report.Processed != 0 || report.Error != context.Canceled.Error() {
+		t.Errorf("report = %+v, want nothing processed and the cancellation recorded", report)
+	}
+}
+
+// waitForReprocess waits until the current reprocess job finished and
+// returns its report
+func waitForReprocess(t *testing.T, s *SyncService) *ReprocessReport {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		report := s.LastReprocess()
+		if report != nil && !report.Running {
+			return report
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reprocess still running: %+v", report)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/garmin"
+)
+
+// Retry backoff: the n-th failure waits retryBaseDelay * 2^(n-1), capped at
+// retryMaxDelay. After maxAttempts failures an activity is dead-lettered.
+const (
+	retryBaseDelay     = 5 * time.Minute
+	retryMaxDelay      = 24 * time.Hour
+	defaultMaxAttempts = 8
+)
+
+// SetMaxAttempts sets how many failures an activity may have before it is
+// dead-lettered and no longer retried automatically
+func (s *SyncService) SetMaxAttempts(n int) {
+	if n > 0 {
+		s.maxAttempts = n
+	}
+}
+
+// retryDelay returns the backoff after the given number of failed attempts
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// retryBlocked reports why an activity must not be attempted right now, or
+// an empty string if it may be
+func (s *SyncService) retryBlocked(activityID int) string {
+	entry, err := s.db.GetRetry(activityID)
+	if err != nil || entry == nil {
+		return ""
+	}
+
+	switch entry.Status {
+	case database.RetryDead:
+		return fmt.Sprintf("dead-lettered after %d attempts", entry.Attempts)
+	case database.RetryIgnored:
+		return "ignored"
+	}
+	if wait := time.Until(entry.NextAttemptAt); wait > 0 {
+		return fmt.Sprintf("backing off for %s after %d attempts", wait.Round(time.Second), entry.Attempts)
+	}
+	return ""
+}
+
+// scheduleRetry records a failed attempt in the retry queue
+func (s *SyncService) scheduleRetry(activity *garmin.GarminActivity, stage string, cause error) error {
+	entry, err := s.db.GetRetry(activity.ActivityID)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		entry = &database.RetryEntry{ActivityID: activity.ActivityID, Status: database.RetryPending}
+	}
+
+	summary, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	entry.Attempts++
+	entry.LastStage = stage
+	entry.LastError = cause.Error()
+	entry.Summary = string(summary)
+	entry.NextAttemptAt = time.Now().Add(retryDelay(entry.Attempts))
+	if entry.Attempts >= s.maxAttempts {
+		entry.Status = database.RetryDead
+		fmt.Printf("☠️ Activity %d dead-lettered after %d attempts\n", activity.ActivityID, entry.Attempts)
+	}
+	return s.db.SaveRetry(entry)
+}
+
+// processDueRetries stages queued activities whose backoff has expired and
+// that were not already handled in this run
+func (s *SyncService) processDueRetries(ctx context.Context, run *database.SyncRun, seen map[int]bool, batch []*stagedActivity) ([]*stagedActivity, error) {
+	due, err := s.db.ListDueRetries(time.Now())
+	if err != nil {
+		return batch, fmt.Errorf("failed to load retry queue: %w", err)
+	}
+
+	for _, entry := range due {
+		if err := ctx.Err(); err != nil {
+			return batch, err
+		}
+		if seen[entry.ActivityID] {
+			continue
+		}
+
+		var activity garmin.GarminActivity
+		if err := json.Unmarshal([]byte(entry.Summary), &activity); err != nil || activity.ActivityID == 0 {
+			fmt.Printf("❌ Retry entry of activity %d has no usable summary\n", entry.ActivityID)
+			continue
+		}
+
+		fmt.Printf("[retry %d] Processing activity %d (%s)...\n",
+			entry.Attempts+1, activity.ActivityID, activity.ActivityName)
+		s.events.Publish(Event{
+			Type:       EventActivityStarted,
+			RunID:      run.ID,
+			ActivityID: activity.ActivityID,
+			Name:       activity.ActivityName,
+		})
+		batch = s.processActivity(ctx, run, &activity, false, batch)
+	}
+	return batch, nil
+}
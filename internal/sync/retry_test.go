@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 5 * time.Minute},
+		{1, 5 * time.Minute},
+		{2, 10 * time.Minute},
+		{3, 20 * time.Minute},
+		{5, 80 * time.Minute},
+		{9, 1280 * time.Minute},
+		{10, 24 * time.Hour},
+		{50, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleRetryDeadLetters(t *testing.T) {
+	s := newTestService(t)
+	s.SetMaxAttempts(3)
+	activity := garminActivity(1)
+
+	wantStatus := []string{database.RetryPending, database.RetryPending, database.RetryDead}
+	for attempt, want := range wantStatus {
+		before := time.Now()
+		if err := s.scheduleRetry(&activity, StageDownload, errors.New("status 500")); err != nil {
+			t.Fatalf("scheduleRetry: %v", err)
+		}
+		entry, err := s.db.GetRetry(1)
+		if err != nil || entry == nil {
+			t.Fatalf("GetRetry = %v, %v", entry, err)
+		}
+		if entry.Attempts != attempt+1 || entry.Status != want {
+			t.Errorf("after %d failures: attempts %d, status %s; want %d, %s",
+				attempt+1, entry.Attempts, entry.Status, attempt+1, want)
+		}
+		// next_attempt_at is stored to the second
+		earliest := before.Add(retryDelay(attempt + 1)).Truncate(time.Second)
+		if entry.NextAttemptAt.Before(earliest) {
+			t.Errorf("after %d failures: next attempt %v, want at least %v", attempt+1, entry.NextAttemptAt, earliest)
+		}
+		if entry.LastStage != StageDownload || entry.LastError != "status 500" {
+			t.Errorf("last failure = %s: %s", entry.LastStage, entry.LastError)
+		}
+	}
+}
+
+func TestRetryBlocked(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *database.RetryEntry
+		want  string // prefix of the reason, "" if not blocked
+	}{
+		{"no entry", nil, ""},
+		{"due", &database.RetryEntry{Status: database.RetryPending, Attempts: 2, NextAttemptAt: time.Now().Add(-time.Minute)}, ""},
+		{"backing off", &database.RetryEntry{Status: database.RetryPending, Attempts: 2, NextAttemptAt: time.Now().Add(time.Hour)}, "backing off"},
+		{"dead", &database.RetryEntry{Status: database.RetryDead, Attempts: 8, NextAttemptAt: time.Now()}, "dead-lettered after 8 attempts"},
+		{"ignored", &database.RetryEntry{Status: database.RetryIgnored, Attempts: 1, NextAttemptAt: time.Now()}, "ignored"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			if tt.entry != nil {
+				tt.entry.ActivityID = 1
+				if err := s.db.SaveRetry(tt.entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := s.retryBlocked(1)
+			if (tt.want == "") != (got == "") || !strings.HasPrefix(got, tt.want) {
+				t.Errorf("retryBlocked = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlushBatchChargesOnlyFailingActivity(t *testing.T) {
+	s := newTestService(t)
+	failCommitsOnName(t, s, "Bad")
+	run, err := s.db.CreateSyncRun(TriggerManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := []*stagedActivity{
+		stageTestActivity(t, s, 1, "Good", "one"),
+		stageTestActivity(t, s, 2, "Bad", "two"),
+		stageTestActivity(t, s, 3, "Good", "three"),
+	}
+	s.flushBatch(run, batch)
+
+	if run.New != 2 || run.Failed != 1 {
+		t.Errorf("run counted %d new, %d failed; want 2, 1", run.New, run.Failed)
+	}
+	for _, id := range []int{1, 3} {
+		if exists, _ := s.db.ActivityExists(id); !exists {
+			t.Errorf("healthy activity %d was not stored", id)
+		}
+		if entry, _ := s.db.GetRetry(id); entry != nil {
+			t.Errorf("healthy activity %d was charged a retry attempt", id)
+		}
+		if got := readFile(t, batch[id-1].activity.Filename); got == "" {
+			t.Errorf("file of activity %d missing", id)
+		}
+	}
+	entry, err := s.db.GetRetry(2)
+	if err != nil || entry == nil || entry.Attempts != 1 {
+		t.Errorf("retry entry of failing activity = %+v, %v; want one attempt", entry, err)
+	}
+	assertNoLeftovers(t, s)
+}
@@ -0,0 +1,154 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/garmin"
+)
+
+// ErrInvalidRules is returned for filter rules that cannot be applied
+var ErrInvalidRules = errors.New("invalid sync rules")
+
+// Rules decide which Garmin activities are synced. They are checked against
+// the activity summary before anything is downloaded, and only for
+// activities not stored yet: stored activities keep receiving upstream
+// changes even if a rule would now skip them.
+//
+// Types are Garmin typeKeys. A rule type also matches more specific keys
+// ending in "_<type>", so "cycling" covers "indoor_cycling" and "running"
+// covers "trail_running".
+type Rules struct {
+	IncludeTypes []string `json:"include_types,omitempty"` // only these types, if set
+	ExcludeTypes []string `json:"exclude_types,omitempty"`
+	MinDuration  float64  `json:"min_duration,omitempty"` // seconds
+	MinDistance  float64  `json:"min_distance,omitempty"` // meters
+	From         string   `json:"from,omitempty"`         // YYYY-MM-DD, inclusive
+	To           string   `json:"to,omitempty"`           // YYYY-MM-DD, inclusive
+}
+
+// Validate checks the rules and normalises their type lists
+func (r *Rules) Validate() error {
+	if r.MinDuration < 0 || r.MinDistance < 0 {
+		return fmt.Errorf("%w: minimums must not be negative", ErrInvalidRules)
+	}
+	if _, _, err := ParseWindow(r.From, r.To); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRules, err)
+	}
+	r.IncludeTypes = normaliseTypes(r.IncludeTypes)
+	r.ExcludeTypes = normaliseTypes(r.ExcludeTypes)
+	return nil
+}
+
+// Skip returns why an activity is filtered out, or "" if it should be synced
+func (r *Rules) Skip(activity *garmin.GarminActivity) string {
+	activityType := getActivityType(activity)
+	if len(r.IncludeTypes) > 0 && !matchesType(activityType, r.IncludeTypes) {
+		return fmt.Sprintf("type %s not included", activityType)
+	}
+	if matchesType(activityType, r.ExcludeTypes) {
+		return fmt.Sprintf("type %s excluded", activityType)
+	}
+	if r.MinDuration > 0 && activity.Duration < r.MinDuration {
+		return fmt.Sprintf("duration %.0fs below minimum %.0fs", activity.Duration, r.MinDuration)
+	}
+	if r.MinDistance > 0 && activity.Distance < r.MinDistance {
+		return fmt.Sprintf("distance %.0fm below minimum %.0fm", activity.Distance, r.MinDistance)
+	}
+
+	if r.From != "" || r.To != "" {
+		from, to, _ := ParseWindow(r.From, r.To)
+		start, err := time.Parse(startTimeLayout, activity.StartTimeLocal)
+		if err != nil {
+			return "unknown start time"
+		}
+		if !from.IsZero() && start.Before(from) {
+			return fmt.Sprintf("started before %s", r.From)
+		}
+		if !to.IsZero() && !start.Before(to) {
+			return fmt.Sprintf("started after %s", r.To)
+		}
+	}
+	return ""
+}
+
+// SetRules replaces the filter rules used by future syncs and plans
+func (s *SyncService) SetRules(rules Rules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+	s.rules = rules
+	return nil
+}
+
+// LoadRules applies the rules saved through SaveRules, or the given defaults
+// if none were saved
+func (s *SyncService) LoadRules(defaults Rules) error {
+	stored, err := s.db.GetSyncRules()
+	if err != nil {
+		return fmt.Errorf("failed to load sync rules: %w", err)
+	}
+	if stored == "" {
+		return s.SetRules(defaults)
+	}
+
+	var rules Rules
+	if err := json.Unmarshal([]byte(stored), &rules); err != nil {
+		return fmt.Errorf("%w: stored rules: %v", ErrInvalidRules, err)
+	}
+	return s.SetRules(rules)
+}
+
+// SaveRules validates, stores and applies new rules. Saved rules take
+// precedence over the configured defaults on the next start.
+func (s *SyncService) SaveRules(rules Rules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	if err := s.db.SaveSyncRules(string(data)); err != nil {
+		return fmt.Errorf("failed to save sync rules: %w", err)
+	}
+	return s.SetRules(rules)
+}
+
+// Rules returns the current filter rules
+func (s *SyncService) Rules() Rules {
+	s.rulesMu.RLock()
+	defer s.rulesMu.RUnlock()
+	return s.rules
+}
+
+// skipReason evaluates the current rules against an activity
+func (s *SyncService) skipReason(activity *garmin.GarminActivity) string {
+	rules := s.Rules()
+	return rules.Skip(activity)
+}
+
+func matchesType(activityType string, types []string) bool {
+	for _, t := range types {
+		if activityType == t || strings.HasSuffix(activityType, "_"+t) {
+			return true
+		}
+	}
+	return false
+}
+
+func normaliseTypes(types []string) []string {
+	var out []string
+	for _, t := range types {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
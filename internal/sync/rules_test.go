@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sstent/garminsync-go/internal/garmin"
+)
+
+func TestRulesSkip(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+		edit  func(a *garmin.GarminActivity)
+		want  string
+	}{
+		{"no rules", Rules{}, nil, ""},
+		{"included type", Rules{IncludeTypes: []string{"running"}}, nil, ""},
+		{"included by suffix", Rules{IncludeTypes: []string{"running"}}, func(a *garmin.GarminActivity) {
+			a.ActivityType = map[string]interface{}{"typeKey": "trail_running"}
+		}, ""},
+		{"not included", Rules{IncludeTypes: []string{"cycling"}}, nil, "type running not included"},
+		{"suffix must follow an underscore", Rules{IncludeTypes: []string{"ning"}}, nil, "type running not included"},
+		{"excluded type", Rules{ExcludeTypes: []string{"running"}}, nil, "type running excluded"},
+		{"excluded by suffix", Rules{ExcludeTypes: []string{"cycling"}}, func(a *garmin.GarminActivity) {
+			a.ActivityType = map[string]interface{}{"typeKey": "indoor_cycling"}
+		}, "type indoor_cycling excluded"},
+		{"exclusion wins over inclusion", Rules{IncludeTypes: []string{"running"}, ExcludeTypes: []string{"running"}}, nil, "type running excluded"},
+		{"long enough", Rules{MinDuration: 3000}, nil, ""},
+		{"too short", Rules{MinDuration: 3600}, nil, "duration 3123s below minimum 3600s"},
+		{"far enough", Rules{MinDistance: 10000}, nil, ""},
+		{"too near", Rules{MinDistance: 15000}, nil, "distance 10012m below minimum 15000m"},
+		{"on the first day", Rules{From: "2024-03-02"}, nil, ""},
+		{"before the window", Rules{From: "2024-03-03"}, nil, "started before 2024-03-03"},
+		{"on the last day", Rules{To: "2024-03-02"}, nil, ""},
+		{"after the window", Rules{To: "2024-03-01"}, nil, "started after 2024-03-01"},
+		{"unknown start time", Rules{From: "2024-01-01"}, func(a *garmin.GarminActivity) {
+			a.StartTimeLocal = ""
+		}, "unknown start time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rules.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			activity := garminActivity(1)
+			if tt.edit != nil {
+				tt.edit(&activity)
+			}
+			if got := tt.rules.Skip(&activity); got != tt.want {
+				t.Errorf("Skip = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesValidate(t *testing.T) {
+	rules := Rules{IncludeTypes: []string{" Running ", "", "CYCLING"}, ExcludeTypes: []string{"  "}}
+	if err := rules.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if len(rules.IncludeTypes) != 2 || rules.IncludeTypes[0] != "running" || rules.IncludeTypes[1] != "cycling" {
+		t.Errorf("IncludeTypes = %q, want [running cycling]", rules.IncludeTypes)
+	}
+	if len(rules.ExcludeTypes) != 0 {
+		t.Errorf("ExcludeTypes = %q, want none", rules.ExcludeTypes)
+	}
+
+	invalid := []Rules{
+		{MinDuration: -1},
+		{MinDistance: -1},
+		{From: "2024-13-01"},
+		{From: "2024-03-02", To: "2024-03-01"},
+	}
+	for _, rules := range invalid {
+		if err := rules.Validate(); !errors.Is(err, ErrInvalidRules) {
+			t.Errorf("Validate(%+v) = %v, want ErrInvalidRules", rules, err)
+		}
+	}
+}
+
+func TestRulesOnlySkipUnstoredActivities(t *testing.T) {
+	t.Setenv("GARMIN_EMAIL", "athlete@example.com")
+	t.Setenv("GARMIN_PASSWORD", "secret")
+	s := newTestService(t)
+	s.SetChangeDetection(true)
+	commitTestActivity(t, s, 1, "stored")
+	serveActivities(t, s, []garmin.GarminActivity{garminActivity(2), garminActivity(1)})
+	if err := s.LoadRules(Rules{ExcludeTypes: []string{"running"}}); err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+
+	plan, err := s.Plan(context.Background(), Options{Mode: ModeFull})
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].ActivityID != 2 || plan.Unchanged != 1 {
+		t.Errorf("plan skipped %+v, unchanged %d; want activity 2 skipped, 1 unchanged", plan.Skipped, plan.Unchanged)
+	}
+
+	run, err := s.Run(context.Background(), Options{Mode: ModeFull})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if run.Skipped != 1 || run.Failed != 0 {
+		t.Errorf("run skipped %d, failed %d; want 1, 0", run.Skipped, run.Failed)
+	}
+	for id, want := range map[int]bool{1: false, 2: true} {
+		if skipped, err := s.db.IsSkipped(id); err != nil || skipped != want {
+			t.Errorf("IsSkipped(%d) = %v, %v; want %v", id, skipped, err, want)
+		}
+	}
+
+	// The stored activity went through change detection, which adopts the
+	// summary hash of rows stored without one
+	remote := garminActivity(1)
+	if activity := getActivity(t, s, 1); activity.SummaryHash != summaryHash(&remote) {
+		t.Errorf("summary hash = %q, want the current one", activity.SummaryHash)
+	}
+}
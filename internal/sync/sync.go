@@ -2,21 +2,164 @@ package sync
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 	"strings"
+	stdsync "sync"
 
 	"github.com/sstent/garminsync-go/internal/database"
 	"github.com/sstent/garminsync-go/internal/garmin"
+	"github.com/sstent/garminsync-go/internal/models"
 	"github.com/sstent/garminsync-go/internal/parser"
 )
 
 type SyncService struct {
-	garminClient *garmin.Client
-	db           *database.SQLiteDB
-	dataDir      string
+	garminClient  *garmin.Client
+	db            *database.SQLiteDB
+	dataDir       string
+	detectChanges bool
+	maxAttempts   int
+
+	deletionPolicy DeletionPolicy
+	reconcile      reconcileState
+	verify         verifyState
+	reprocess      reprocessState
+	importMu       stdsync.Mutex // serialises local activity ID allocation
+	jobs           jobLock
+	events         *EventBus
+
+	rulesMu stdsync.RWMutex
+	rules   Rules
+
+	processors []registeredProcessor
+}
+
+// syncOutcome describes what a sync did with an activity
+type syncOutcome int
+
+const (
+	outcomeUnchanged syncOutcome = iota
+	outcomeCreated
+	outcomeUpdated
+)
+
+func (o syncOutcome) String() string {
+	switch o {
+	case outcomeCreated:
+		return "created"
+	case outcomeUpdated:
+		return "updated"
+	}
+	return "unchanged"
+}
+
+// Triggers recorded with each sync run
+const (
+	TriggerCron   = "cron"
+	TriggerManual = "manual"
+	TriggerAPI    = "api"
+)
+
+// ErrInvalidWindow is returned by ParseWindow for malformed date windows
+var ErrInvalidWindow = errors.New("invalid date window")
+
+const (
+	// startTimeLayout is the format of Garmin's local start times
+	startTimeLayout = "2006-01-02 15:04:05"
+	dateLayout      = "2006-01-02"
+)
+
+// Sync modes
+const (
+	// ModeIncremental lists Garmin activities newest first and stops at the
+	// first page whose activities are all stored and unchanged
+	ModeIncremental = "incremental"
+	// ModeFull lists every activity on the account
+	ModeFull = "full"
+)
+
+// Phases reported through Options.Progress
+const (
+	PhaseListing  = "listing"
+	PhaseSyncing  = "syncing"
+	PhaseRetrying = "retrying"
+)
+
+// Progress describes how far a running sync has got
+type Progress struct {
+	RunID     int64
+	Phase     string
+	Processed int
+	Total     int
+}
+
+// Options configures a single sync run
+type Options struct {
+	Trigger string
+	Mode    string // ModeIncremental (default) or ModeFull
+
+	// From and To limit the run to activities starting in [From, To), by
+	// their local start time. A zero bound is open. Windowed runs page back
+	// until they pass From rather than stopping at stored activities.
+	From time.Time
+	To   time.Time
+
+	// Force re-downloads activities even if they are stored and unchanged
+	Force bool
+
+	// Progress, if set, is called as the run moves through its phases and
+	// after each listed activity has been processed
+	Progress func(Progress)
+}
+
+// windowed reports whether the run is limited to a date window
+func (o Options) windowed() bool {
+	return !o.From.IsZero() || !o.To.IsZero()
+}
+
+// inWindow reports whether an activity started inside the run's window
+func (o Options) inWindow(activity *garmin.GarminActivity) bool {
+	if !o.windowed() {
+		return true
+	}
+	start, err := time.Parse(startTimeLayout, activity.StartTimeLocal)
+	if err != nil {
+		return false
+	}
+	return (o.From.IsZero() || !start.Before(o.From)) && (o.To.IsZero() || start.Before(o.To))
+}
+
+// ParseWindow parses the inclusive YYYY-MM-DD bounds of a date window into
+// Options.From and Options.To. Either may be empty.
+func ParseWindow(from, to string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if from != "" {
+		if start, err = time.Parse(dateLayout, from); err != nil {
+			return start, end, fmt.Errorf("%w: from must be YYYY-MM-DD", ErrInvalidWindow)
+		}
+	}
+	if to != "" {
+		if end, err = time.Parse(dateLayout, to); err != nil {
+			return start, end, fmt.Errorf("%w: to must be YYYY-MM-DD", ErrInvalidWindow)
+		}
+		end = end.AddDate(0, 0, 1)
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return start, end, fmt.Errorf("%w: from is after to", ErrInvalidWindow)
+	}
+	return start, end, nil
+}
+
+func (o Options) report(runID int64, phase string, processed, total int) {
+	if o.Progress != nil {
+		o.Progress(Progress{RunID: runID, Phase: phase, Processed: processed, Total: total})
+	}
 }
 
 func NewSyncService(garminClient *garmin.Client, db *database.SQLiteDB, dataDir string) *SyncService {
@@ -24,9 +167,23 @@ func NewSyncService(garminClient *garmin.Client, db *database.SQLiteDB, dataDir
 		garminClient: garminClient,
 		db:           db,
 		dataDir:      dataDir,
+		maxAttempts:  defaultMaxAttempts,
+		events:       NewEventBus(),
 	}
 }
 
+// Events returns the bus that sync progress events are published on
+func (s *SyncService) Events() *EventBus {
+	return s.events
+}
+
+// SetChangeDetection controls whether activities that already exist locally
+// are compared against the Garmin summary and re-synced when it changed.
+// When disabled, existing activities are never refreshed.
+func (s *SyncService) SetChangeDetection(enabled bool) {
+	s.detectChanges = enabled
+}
+
 func (s *SyncService) testAPIConnectivity() error {
     // Try a simple API call to check connectivity
     _, err := s.garminClient.GetActivities(0, 1)
@@ -44,7 +201,63 @@ func (s *SyncService) testAPIConnectivity() error {
     return nil
 }
 
+// Run performs a sync and records it, with per-activity errors, in the
+// sync_runs and sync_errors tables. The returned run is set even when the
+// sync itself failed. It fails with ErrJobRunning while another archive job
+// runs.
+func (s *SyncService) Run(ctx context.Context, opts Options) (*database.SyncRun, error) {
+	release, err := s.acquireJob("sync")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return s.run(ctx, opts)
+}
+
+// run is Run once the job lock is held
+func (s *SyncService) run(ctx context.Context, opts Options) (*database.SyncRun, error) {
+	if opts.Trigger == "" {
+		opts.Trigger = TriggerManual
+	}
+
+	run, err := s.db.CreateSyncRun(opts.Trigger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record sync run: %w", err)
+	}
+
+	syncErr := s.runSync(ctx, run, opts)
+	run.Status = "succeeded"
+	if syncErr != nil {
+		run.Status = "failed"
+		if errors.Is(syncErr, context.Canceled) {
+			run.Status = "cancelled"
+		}
+		run.Error = syncErr.Error()
+	}
+	if err := s.db.FinishSyncRun(run); err != nil {
+		fmt.Printf("❌ Failed to record sync run %d: %v\n", run.ID, err)
+	}
+	s.events.Publish(Event{
+		Type:    EventRunFinished,
+		RunID:   run.ID,
+		Status:  run.Status,
+		Error:   run.Error,
+		Total:   run.Found,
+		New:     run.New,
+		Updated: run.Updated,
+		Failed:  run.Failed,
+		Skipped: run.Skipped,
+	})
+
+	return run, syncErr
+}
+
 func (s *SyncService) FullSync(ctx context.Context) error {
+	_, err := s.Run(ctx, Options{Trigger: TriggerManual})
+	return err
+}
+
+func (s *SyncService) runSync(ctx context.Context, run *database.SyncRun, opts Options) error {
     fmt.Println("=== Starting full sync ===")
     defer fmt.Println("=== Sync completed ===")
     
@@ -73,13 +286,15 @@ func (s *SyncService) FullSync(ctx context.Context) error {
 		map[bool]string{true: "***SET***", false: "EMPTY"}[password != ""])
 
 	// 1. Fetch activities from Garmin
+	opts.report(run.ID, PhaseListing, 0, 0)
 	fmt.Println("Fetching activities from Garmin Connect...")
-	activities, err := s.garminClient.GetActivities(0, 10) // Start with just 10 for testing
+	activities, err := s.listActivities(ctx, run.ID, opts, true)
 	if err != nil {
 		return fmt.Errorf("failed to get activities: %w", err)
 	}
 	
 	fmt.Printf("✅ Found %d activities from Garmin\n", len(activities))
+	run.Found = len(activities)
 	
 	if len(activities) == 0 {
 		fmt.Println("⚠️ No activities returned - this might be expected if:")
@@ -89,81 +304,376 @@ func (s *SyncService) FullSync(ctx context.Context) error {
 		return nil
 	}
 
-	// 2. Process each activity
-	for i, activity := range activities {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			fmt.Printf("[%d/%d] Processing activity %d (%s)...\n", 
-				i+1, len(activities), activity.ActivityID, activity.ActivityName)
-			if err := s.syncActivity(&activity); err != nil {
-				fmt.Printf("❌ Error syncing activity %d: %v\n", activity.ActivityID, err)
-			} else {
-				fmt.Printf("✅ Successfully synced activity %d\n", activity.ActivityID)
+	// 2. Process each activity, committing them in batches
+	var batch []*stagedActivity
+	seen := make(map[int]bool, len(activities))
+	for i := range activities {
+		activity := &activities[i]
+		if err := ctx.Err(); err != nil {
+			s.flushBatch(run, batch)
+			return err
+		}
+
+		seen[activity.ActivityID] = true
+		opts.report(run.ID, PhaseSyncing, i, len(activities))
+		fmt.Printf("[%d/%d] Processing activity %d (%s)...\n", 
+			i+1, len(activities), activity.ActivityID, activity.ActivityName)
+		s.events.Publish(Event{
+			Type:       EventActivityStarted,
+			RunID:      run.ID,
+			ActivityID: activity.ActivityID,
+			Name:       activity.ActivityName,
+			Processed:  i,
+			Total:      len(activities),
+		})
+		batch = s.processActivity(ctx, run, activity, opts.Force, batch)
+	}
+	opts.report(run.ID, PhaseSyncing, len(activities), len(activities))
+
+	// 3. Retry earlier failures that are due but were not listed this time
+	opts.report(run.ID, PhaseRetrying, len(activities), len(activities))
+	batch, err = s.processDueRetries(ctx, run, seen, batch)
+	s.flushBatch(run, batch)
+
+	return err
+}
+
+// listActivities fetches the Garmin activities a run looks at, page by page.
+// With publish, each page is announced as a listing event of the run.
+func (s *SyncService) listActivities(ctx context.Context, runID int64, opts Options, publish bool) ([]garmin.GarminActivity, error) {
+	var activities []garmin.GarminActivity
+	pages := 0
+	err := s.forEachRemotePage(ctx, func(page []garmin.GarminActivity) (bool, error) {
+		pages++
+		if publish {
+			s.events.Publish(Event{Type: EventListingPage, RunID: runID, Page: pages, Count: len(page)})
+		}
+
+		if opts.windowed() {
+			for i := range page {
+				if opts.inWindow(&page[i]) {
+					activities = append(activities, page[i])
+				}
+			}
+			// Pages are newest first; stop once past the lower bound
+			oldest, err := time.Parse(startTimeLayout, page[len(page)-1].StartTimeLocal)
+			return opts.From.IsZero() || err != nil || !oldest.Before(opts.From), nil
+		}
+
+		activities = append(activities, page...)
+		if opts.Mode == ModeFull {
+			return true, nil
+		}
+
+		// Pages are newest first, so once a whole page is stored the rest
+		// of the account is too
+		for i := range page {
+			current, err := s.upToDate(&page[i])
+			if err != nil {
+				return false, err
+			}
+			if !current {
+				return true, nil
 			}
 		}
+		return false, nil
+	})
+	return activities, err
+}
+
+// upToDate reports whether an incremental sync has nothing left to do for an
+// activity: it is stored and, with change detection enabled, unchanged on
+// Garmin Connect, or it is in the retry queue, which retries it on its own
+// schedule or not at all once dead-lettered, or an earlier run skipped it and
+// the rules still do.
+func (s *SyncService) upToDate(activity *garmin.GarminActivity) (bool, error) {
+	existing, err := s.db.GetActivity(activity.ActivityID)
+	switch {
+	case errors.Is(err, database.ErrActivityNotFound):
+	case err != nil:
+		return false, err
+	case existing.Downloaded:
+		return !s.detectChanges || existing.SummaryHash == "" || existing.SummaryHash == summaryHash(activity), nil
+	}
+
+	entry, err := s.db.GetRetry(activity.ActivityID)
+	if err != nil || entry != nil {
+		return entry != nil, err
 	}
 
-	return nil
+	skipped, err := s.db.IsSkipped(activity.ActivityID)
+	if err != nil || !skipped {
+		return false, err
+	}
+	return s.skipReason(activity) != "", nil
 }
 
-func (s *SyncService) syncActivity(activity *garmin.GarminActivity) error {
-	// Skip if already downloaded
-	if exists, _ := s.db.ActivityExists(activity.ActivityID); exists {
-		return nil
+// processActivity stages an activity into the batch, flushing the batch once
+// it is full, and returns the batch
+func (s *SyncService) processActivity(ctx context.Context, run *database.SyncRun, activity *garmin.GarminActivity, force bool, batch []*stagedActivity) []*stagedActivity {
+	// Rules only keep activities out of the archive; stored ones go on
+	// receiving upstream changes
+	stored, err := s.db.ActivityExists(activity.ActivityID)
+	if err != nil {
+		fmt.Printf("❌ Error syncing activity %d: %v\n", activity.ActivityID, err)
+		s.recordFailure(run, activity, &stageError{StageDB, fmt.Errorf("database error: %w", err)})
+		return batch
+	}
+	if reason := s.skipReason(activity); reason != "" && !stored {
+		fmt.Printf("⏭️ Skipping activity %d: %s\n", activity.ActivityID, reason)
+		s.recordSkipped(run, activity, reason)
+		return batch
+	}
+	if wait := s.retryBlocked(activity.ActivityID); wait != "" {
+		fmt.Printf("⏳ Skipping activity %d: %s\n", activity.ActivityID, wait)
+		return batch
 	}
 
-	// Download the activity file (FIT format)
-	fileData, err := s.garminClient.DownloadActivity(activity.ActivityID, "fit")
+	staged, err := s.stageActivity(run.ID, activity, force)
 	if err != nil {
-		return fmt.Errorf("download failed: %w", err)
+		fmt.Printf("❌ Error syncing activity %d: %v\n", activity.ActivityID, err)
+		s.recordFailure(run, activity, err)
+		return batch
+	}
+	if staged == nil {
+		fmt.Printf("⏭️ Activity %d already up to date\n", activity.ActivityID)
+		return batch
 	}
 
-	// Save file
-	filename := filepath.Join(s.dataDir, "activities", fmt.Sprintf("%d.fit", activity.ActivityID))
-	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
-		return fmt.Errorf("directory creation failed: %w", err)
+	batch = append(batch, staged)
+	if len(batch) >= writeBatchSize {
+		s.flushBatch(run, batch)
+		batch = nil
+	}
+	return batch
+}
+
+// flushBatch commits a batch, records the outcome of each activity in it
+// and runs the stored activities through the processors. If the batch fails
+// to commit, its activities are committed one at a time, so only the
+// activities that fail on their own are charged a retry attempt.
+func (s *SyncService) flushBatch(run *database.SyncRun, batch []*stagedActivity) {
+	outcomes, err := s.commitBatch(batch)
+	if err != nil && len(batch) > 1 {
+		fmt.Printf("⚠️ Batch of %d activities failed to commit, committing them one by one: %v\n", len(batch), err)
+		for _, staged := range batch {
+			// commitBatch discarded the staged files; stage them again
+			tempPath, err := writeTempFile(staged.activity.Filename, staged.data)
+			if err != nil {
+				fmt.Printf("❌ Error syncing activity %d: %v\n", staged.activity.ActivityID, err)
+				s.recordFailure(run, staged.source, &stageError{StageFile, err})
+				continue
+			}
+			staged.tempPath = tempPath
+			s.flushBatch(run, []*stagedActivity{staged})
+		}
+		return
 	}
-	if err := os.WriteFile(filename, fileData, 0644); err != nil {
-		return fmt.Errorf("file write failed: %w", err)
+
+	for i, staged := range batch {
+		id := staged.activity.ActivityID
+		switch {
+		case err != nil:
+			fmt.Printf("❌ Error syncing activity %d: %v\n", id, err)
+			s.recordFailure(run, staged.source, err)
+			continue
+		case outcomes[i] == outcomeUpdated:
+			fmt.Printf("🔄 Re-synced changed activity %d\n", id)
+			run.Updated++
+			s.events.Publish(Event{Type: EventActivitySaved, RunID: run.ID, ActivityID: id, Outcome: outcomes[i].String()})
+		default:
+			fmt.Printf("✅ Successfully synced activity %d\n", id)
+			run.New++
+			s.events.Publish(Event{Type: EventActivitySaved, RunID: run.ID, ActivityID: id, Outcome: outcomes[i].String()})
+		}
+		if err := s.db.DeleteRetry(id); err != nil {
+			fmt.Printf("❌ Failed to clear retry entry of activity %d: %v\n", id, err)
+		}
+		if err := s.db.ClearSkipped(id); err != nil {
+			fmt.Printf("❌ Failed to clear skipped entry of activity %d: %v\n", id, err)
+		}
+
+		s.runProcessors(run, &ProcessedActivity{
+			Activity: staged.activity,
+			Source:   staged.source,
+			Data:     staged.data,
+			Metrics:  staged.metrics,
+			Outcome:  outcomes[i].String(),
+		})
 	}
+}
+
+// recordSkipped counts an activity filtered out by the sync rules and stores
+// the reason
+func (s *SyncService) recordSkipped(run *database.SyncRun, activity *garmin.GarminActivity, reason string) {
+	run.Skipped++
+	s.events.Publish(Event{
+		Type:       EventActivitySkipped,
+		RunID:      run.ID,
+		ActivityID: activity.ActivityID,
+		Reason:     reason,
+	})
+
+	err := s.db.RecordSkipped(&database.SkippedActivity{
+		ActivityID:   activity.ActivityID,
+		RunID:        run.ID,
+		ActivityName: activity.ActivityName,
+		ActivityType: getActivityType(activity),
+		StartTime:    activity.StartTimeLocal,
+		Reason:       reason,
+	})
+	if err != nil {
+		fmt.Printf("❌ Failed to record skipped activity %d: %v\n", activity.ActivityID, err)
+	}
+}
+
+// recordFailure counts a failed activity, stores it in the error ledger and
+// schedules its next retry
+func (s *SyncService) recordFailure(run *database.SyncRun, activity *garmin.GarminActivity, err error) {
+	run.Failed++
+
+	stage := StageDB
+	var se *stageError
+	if errors.As(err, &se) {
+		stage = se.stage
+	}
+	s.events.Publish(Event{
+		Type:       EventActivityFailed,
+		RunID:      run.ID,
+		ActivityID: activity.ActivityID,
+		Stage:      stage,
+		Error:      err.Error(),
+	})
+	if _, dbErr := s.db.RecordSyncError(run.ID, activity.ActivityID, stage, err.Error()); dbErr != nil {
+		fmt.Printf("❌ Failed to record error for activity %d: %v\n", activity.ActivityID, dbErr)
+	}
+	if dbErr := s.scheduleRetry(activity, stage, err); dbErr != nil {
+		fmt.Printf("❌ Failed to queue retry for activity %d: %v\n", activity.ActivityID, dbErr)
+	}
+}
+
+// stageActivity downloads and parses an activity and writes it to a
+// temporary file next to its final location. It returns nil if the
+// activity is already stored and unchanged, unless force is set.
+func (s *SyncService) stageActivity(runID int64, activity *garmin.GarminActivity, force bool) (*stagedActivity, error) {
+	hash := summaryHash(activity)
+
+	existing, err := s.db.GetActivity(activity.ActivityID)
+	if err != nil && !errors.Is(err, database.ErrActivityNotFound) {
+		return nil, &stageError{StageDB, fmt.Errorf("database error: %w", err)}
+	}
+	if existing != nil && existing.Downloaded && !force {
+		// Skip if already downloaded and unchanged upstream
+		if !s.detectChanges || existing.SummaryHash == hash {
+			return nil, nil
+		}
+		// Rows synced before change detection have no hash yet; adopt the
+		// current one instead of re-downloading the whole archive
+		if existing.SummaryHash == "" {
+			if err := s.db.SetSummaryHash(activity.ActivityID, hash); err != nil {
+				return nil, &stageError{StageDB, fmt.Errorf("database error: %w", err)}
+			}
+			return nil, nil
+		}
+	}
+
+	// Download the activity file (FIT format)
+	fileData, err := s.garminClient.DownloadActivity(activity.ActivityID, "fit")
+	if err != nil {
+		return nil, &stageError{StageDownload, fmt.Errorf("download failed: %w", err)}
+	}
+	s.events.Publish(Event{Type: EventActivityDownloaded, RunID: runID, ActivityID: activity.ActivityID})
 
 	// Parse the file
 	fileParser := parser.NewParser()
 	metrics, err := fileParser.ParseData(fileData)
 	if err != nil {
-		return fmt.Errorf("parsing failed: %w", err)
+		return nil, &stageError{StageParse, fmt.Errorf("parsing failed: %w", err)}
+	}
+	s.events.Publish(Event{Type: EventActivityParsed, RunID: runID, ActivityID: activity.ActivityID})
+
+	// A file imported or uploaded before the activity synced is the same
+	// activity; the Garmin row takes its place instead of duplicating it
+	replaces, err := s.importedCopy(activity.ActivityID, metrics)
+	if err != nil {
+		return nil, &stageError{StageDB, fmt.Errorf("database error: %w", err)}
+	}
+	if replaces != nil {
+		fmt.Printf("🔁 Activity %d replaces imported activity %d\n", activity.ActivityID, replaces.ActivityID)
+	}
+
+	// Record what was stored so verification and dedupe can use it
+	sum := sha256.Sum256(fileData)
+	checksum := hex.EncodeToString(sum[:])
+	if ids, err := s.db.FindActivitiesBySHA256(checksum); err == nil {
+		for _, id := range ids {
+			if id != activity.ActivityID {
+				fmt.Printf("⚠️ Activity %d has the same file content as activity %d\n", activity.ActivityID, id)
+			}
+		}
+	}
+	downloadedAt := time.Now().UTC()
+
+	// Stage the file; commitBatch moves it into place
+	filename := filepath.Join(s.dataDir, "activities", fmt.Sprintf("%d.fit", activity.ActivityID))
+	tempPath, err := writeTempFile(filename, fileData)
+	if err != nil {
+		return nil, &stageError{StageFile, err}
 	}
 
 	// Parse start time
-	startTime, err := time.Parse("2006-01-02 15:04:05", activity.StartTimeLocal)
+	startTime, err := time.Parse(startTimeLayout, activity.StartTimeLocal)
 	if err != nil {
 		startTime = time.Now()
 	}
 
-	// Save to database
-	if err := s.db.CreateActivity(&database.Activity{
-		ActivityID:    activity.ActivityID,
-		StartTime:     startTime,
-		ActivityType:  getActivityType(activity),
-		Distance:      metrics.Distance,
-		Duration:      int(metrics.Duration.Seconds()),
-		MaxHeartRate:  metrics.MaxHeartRate,
-		AvgHeartRate:  metrics.AvgHeartRate,
-		AvgPower:      float64(metrics.AvgPower),
-		Calories:      metrics.Calories,
-		Filename:      filename,
-		FileType:      "fit",
-		Downloaded:    true,
-		ElevationGain: metrics.ElevationGain,
-		Steps:         metrics.Steps,
-	}); err != nil {
-		return fmt.Errorf("database error: %w", err)
-	}
+	return &stagedActivity{
+		source:   activity,
+		tempPath: tempPath,
+		data:     fileData,
+		metrics:  metrics,
+		activity: &database.Activity{
+			ActivityID:    activity.ActivityID,
+			ActivityName:  activity.ActivityName,
+			StartTime:     startTime,
+			ActivityType:  getActivityType(activity),
+			Distance:      metrics.Distance,
+			Duration:      int(metrics.Duration.Seconds()),
+			MaxHeartRate:  metrics.MaxHeartRate,
+			AvgHeartRate:  metrics.AvgHeartRate,
+			AvgPower:      float64(metrics.AvgPower),
+			Calories:      metrics.Calories,
+			Filename:      filename,
+			FileType:      "fit",
+			FileSize:      int64(len(fileData)),
+			FileSHA256:    checksum,
+			SourceFormat:  parser.DetectFormat(fileData),
+			Downloaded:    true,
+			DownloadedAt:  &downloadedAt,
+			Source:        database.SourceGarmin,
+			DeviceSerial:  metrics.DeviceSerial,
+			FileStartTime: fileStartTime(metrics),
+			ElevationGain: metrics.ElevationGain,
+			Steps:         metrics.Steps,
+			SummaryHash:   hash,
+		},
+		replaces: replaces,
+	}, nil
+}
 
-	fmt.Printf("Synced activity %d\n", activity.ActivityID)
-	return nil
+// importedCopy returns the locally imported or uploaded activity whose file
+// has the same start time and device as a downloaded one, or nil if there is
+// none
+func (s *SyncService) importedCopy(activityID int, metrics *models.ActivityMetrics) (*database.Activity, error) {
+	if metrics.StartTime.IsZero() {
+		return nil, nil
+	}
+	id, found, err := s.db.FindActivityByFileStart(metrics.StartTime, metrics.DeviceSerial)
+	// Local IDs are negative; a positive match is another Garmin activity
+	if err != nil || !found || id >= 0 || id == activityID {
+		return nil, err
+	}
+	return s.db.GetActivity(id)
 }
 
 // Add missing Sync method
@@ -171,6 +681,35 @@ func (s *SyncService) Sync(ctx context.Context) error {
     return s.FullSync(ctx)
 }
 
+// Stages recorded with activity errors
+const (
+	StageDownload = "download"
+	StageParse    = "parse"
+	StageFile     = "file"
+	StageDB       = "db"
+	StageProcess  = "process"
+)
+
+// stageError tags an activity error with the sync stage it happened in
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+func (e *stageError) Unwrap() error { return e.err }
+
+// summaryHash fingerprints the summary fields that change when an activity
+// is edited on Garmin Connect (renamed, re-typed, trimmed), so re-syncs can
+// spot modified activities without downloading them.
+func summaryHash(activity *garmin.GarminActivity) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%s|%.1f|%.1f|%.0f",
+		activity.ActivityName, getActivityType(activity), activity.StartTimeLocal,
+		activity.Distance, activity.Duration, activity.Calories)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func getActivityType(activity *garmin.GarminActivity) string {
 	if activityType, ok := activity.ActivityType["typeKey"]; ok {
 		return activityType.(string)
@@ -0,0 +1,221 @@
+package sync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/garmin"
+)
+
+// newTestService returns a sync service over an empty database and data
+// directory, both removed when the test ends. Its Garmin client points at
+// the default API address, so tests must not reach the network.
+func newTestService(t *testing.T) *SyncService {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.NewSQLiteDB(dir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewSyncService(garmin.NewClient(), db, dir)
+}
+
+// garminActivity returns a Garmin summary with the fields summaryHash reads
+func garminActivity(id int) garmin.GarminActivity {
+	return garmin.GarminActivity{
+		ActivityID:     id,
+		ActivityName:   "Morning Run",
+		StartTimeLocal: "2024-03-02 09:00:00",
+		ActivityType:   map[string]interface{}{"typeKey": "running"},
+		Distance:       10012.3,
+		Duration:       3123.4,
+		Calories:       640,
+	}
+}
+
+func TestSummaryHash(t *testing.T) {
+	base := garminActivity(1)
+	tests := []struct {
+		name    string
+		edit    func(a *garmin.GarminActivity)
+		changed bool
+	}{
+		{"unchanged", func(a *garmin.GarminActivity) {}, false},
+		{"renamed", func(a *garmin.GarminActivity) { a.ActivityName = "Evening Run" }, true},
+		{"re-typed", func(a *garmin.GarminActivity) { a.ActivityType = map[string]interface{}{"typeKey": "trail_running"} }, true},
+		{"moved", func(a *garmin.GarminActivity) { a.StartTimeLocal = "2024-03-02 10:00:00" }, true},
+		{"trimmed", func(a *garmin.GarminActivity) { a.Distance = 9000 }, true},
+		{"duration edited", func(a *garmin.GarminActivity) { a.Duration = 3000 }, true},
+		{"calories edited", func(a *garmin.GarminActivity) { a.Calories = 700 }, true},
+		{"distance noise below 0.1 m", func(a *garmin.GarminActivity) { a.Distance += 0.01 }, false},
+		{"heart rate is not hashed", func(a *garmin.GarminActivity) { a.AvgHR = 150 }, false},
+		{"activity ID is not hashed", func(a *garmin.GarminActivity) { a.ActivityID = 2 }, false},
+	}
+	want := summaryHash(&base)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edited := garminActivity(1)
+			tt.edit(&edited)
+			if changed := summaryHash(&edited) != want; changed != tt.changed {
+				t.Errorf("hash changed = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
+
+func TestUpToDate(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, s *SyncService)
+		want  bool
+	}{
+		{"not stored", func(t *testing.T, s *SyncService) {}, false},
+		{"stored", func(t *testing.T, s *SyncService) {
+			staged := stageTestActivity(t, s, 1, "Activity", "fit")
+			staged.activity.SummaryHash = summaryHash(staged.source)
+			if _, err := s.commitBatch([]*stagedActivity{staged}); err != nil {
+				t.Fatalf("commitBatch: %v", err)
+			}
+		}, true},
+		{"changed on Garmin Connect", func(t *testing.T, s *SyncService) {
+			staged := stageTestActivity(t, s, 1, "Activity", "fit")
+			staged.activity.SummaryHash = "stale"
+			if _, err := s.commitBatch([]*stagedActivity{staged}); err != nil {
+				t.Fatalf("commitBatch: %v", err)
+			}
+		}, false},
+		{"retry pending", func(t *testing.T, s *SyncService) {
+			saveRetry(t, s, database.RetryPending)
+		}, true},
+		{"dead-lettered", func(t *testing.T, s *SyncService) {
+			saveRetry(t, s, database.RetryDead)
+		}, true},
+		{"ignored", func(t *testing.T, s *SyncService) {
+			saveRetry(t, s, database.RetryIgnored)
+		}, true},
+		{"skipped by the rules", func(t *testing.T, s *SyncService) {
+			recordSkipped(t, s)
+			s.SetRules(Rules{ExcludeTypes: []string{"running"}})
+		}, true},
+		{"skipped but no longer filtered", func(t *testing.T, s *SyncService) {
+			recordSkipped(t, s)
+		}, false},
+		{"filtered but never skipped", func(t *testing.T, s *SyncService) {
+			s.SetRules(Rules{ExcludeTypes: []string{"running"}})
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			s.SetChangeDetection(true)
+			tt.setup(t, s)
+			activity := garminActivity(1)
+			got, err := s.upToDate(&activity)
+			if err != nil {
+				t.Fatalf("upToDate: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("upToDate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// saveRetry queues activity 1 for retry with the given status
+func saveRetry(t *testing.T, s *SyncService, status string) {
+	t.Helper()
+	err := s.db.SaveRetry(&database.RetryEntry{
+		ActivityID:    1,
+		Status:        status,
+		Attempts:      1,
+		NextAttemptAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("SaveRetry: %v", err)
+	}
+}
+
+// recordSkipped records activity 1 in the skipped ledger
+func recordSkipped(t *testing.T, s *SyncService) {
+	t.Helper()
+	if err := s.db.RecordSkipped(&database.SkippedActivity{ActivityID: 1, Reason: "type running excluded"}); err != nil {
+		t.Fatalf("RecordSkipped: %v", err)
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	day := func(d string) time.Time {
+		parsed, _ := time.Parse(dateLayout, d)
+		return parsed
+	}
+	tests := []struct {
+		from, to    string
+		wantFrom    time.Time
+		wantTo      time.Time // exclusive: the day after the inclusive bound
+		wantInvalid bool
+	}{
+		{"", "", time.Time{}, time.Time{}, false},
+		{"2024-03-01", "", day("2024-03-01"), time.Time{}, false},
+		{"", "2024-03-31", time.Time{}, day("2024-04-01"), false},
+		{"2024-03-01", "2024-03-31", day("2024-03-01"), day("2024-04-01"), false},
+		{"2024-03-02", "2024-03-02", day("2024-03-02"), day("2024-03-03"), false},
+		{"2023-12-31", "2023-12-31", day("2023-12-31"), day("2024-01-01"), false},
+		{"2024-03-03", "2024-03-02", time.Time{}, time.Time{}, true},
+		{"2024-3-1", "", time.Time{}, time.Time{}, true},
+		{"", "31/03/2024", time.Time{}, time.Time{}, true},
+		{"2024-02-30", "", time.Time{}, time.Time{}, true},
+		{"2024-03-01T00:00:00Z", "", time.Time{}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		from, to, err := ParseWindow(tt.from, tt.to)
+		if tt.wantInvalid {
+			if !errors.Is(err, ErrInvalidWindow) {
+				t.Errorf("ParseWindow(%q, %q) error = %v, want ErrInvalidWindow", tt.from, tt.to, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseWindow(%q, %q): %v", tt.from, tt.to, err)
+			continue
+		}
+		if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+			t.Errorf("ParseWindow(%q, %q) = %v, %v; want %v, %v", tt.from, tt.to, from, to, tt.wantFrom, tt.wantTo)
+		}
+	}
+}
+
+func TestInWindow(t *testing.T) {
+	from, to, err := ParseWindow("2024-03-01", "2024-03-31")
+	if err != nil {
+		t.Fatalf("ParseWindow: %v", err)
+	}
+	opts := Options{From: from, To: to}
+	tests := []struct {
+		start string
+		want  bool
+	}{
+		{"2024-02-29 23:59:59", false},
+		{"2024-03-01 00:00:00", true},
+		{"2024-03-15 12:00:00", true},
+		{"2024-03-31 23:59:59", true},
+		{"2024-04-01 00:00:00", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		activity := garminActivity(1)
+		activity.StartTimeLocal = tt.start
+		if got := opts.inWindow(&activity); got != tt.want {
+			t.Errorf("inWindow(%q) = %v, want %v", tt.start, got, tt.want)
+		}
+	}
+
+	activity := garminActivity(1)
+	activity.StartTimeLocal = ""
+	if !(Options{}).inWindow(&activity) {
+		t.Error("an unwindowed run must take every activity")
+	}
+}
@@ -0,0 +1,48 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+// DuplicateError is returned by Upload when the file matches an activity
+// that is already stored
+type DuplicateError struct {
+	ActivityID int
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("duplicate of activity %d", e.ActivityID)
+}
+
+// Upload stores a single FIT, GPX or TCX file as a new activity with
+// source=upload and returns the created row. Like Import, it assigns a local
+// ID and refuses files that duplicate a stored activity, returning a
+// *DuplicateError. Files the parser rejects fail with
+// parser.ErrUnsupportedFormat, parser.ErrNotActivity or
+// ErrInvalidActivityFile. It fails with ErrJobRunning while another archive
+// job runs, since a sync or import could otherwise claim the same local ID.
+func (s *SyncService) Upload(name string, r io.Reader) (*database.Activity, error) {
+	data, err := readLimited(r)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.acquireJob("upload")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	result, err := s.importActivity(name, data, database.SourceUpload)
+	if err != nil {
+		return nil, err
+	}
+	if result.Status == ImportDuplicate {
+		return nil, &DuplicateError{ActivityID: result.DuplicateOf}
+	}
+	fmt.Printf("📤 Uploaded %s as activity %d\n", name, result.ActivityID)
+	return s.db.GetActivity(result.ActivityID)
+}
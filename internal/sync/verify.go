@@ -0,0 +1,236 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	stdsync "sync"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/parser"
+)
+
+// verifyPageSize is the number of rows loaded per page while verifying
+const verifyPageSize = 200
+
+// VerifyOptions controls an integrity verification run
+type VerifyOptions struct {
+	// Repair re-downloads missing or corrupt files from Garmin Connect and
+	// records the size and checksum of rows that have none. Without it,
+	// Verify only reports and never writes to the database.
+	Repair bool `json:"repair"`
+}
+
+// VerifyReport lists the outcome of an integrity verification run
+type VerifyReport struct {
+	StartedAt        time.Time                 `json:"started_at"`
+	FinishedAt       time.Time                 `json:"finished_at"`
+	Checked          int                       `json:"checked"`
+	OK               int                       `json:"ok"`
+	Baselined        int                       `json:"baselined"` // rows that had no size/checksum recorded yet; stored only with Repair
+	Missing          []int                     `json:"missing"`
+	SizeMismatch     []int                     `json:"size_mismatch"`
+	ChecksumMismatch []int                     `json:"checksum_mismatch"`
+	Repaired         []int                     `json:"repaired"`
+	UntrackedFiles   []string                  `json:"untracked_files"` // files on disk no row points at
+	Duplicates       []database.DuplicateGroup `json:"duplicates"`
+	Errors           []string                  `json:"errors"`
+}
+
+// verifyState holds the most recent verification report
+type verifyState struct {
+	mu   stdsync.Mutex
+	last *VerifyReport
+}
+
+// LastVerify returns the report of the most recent Verify call, or nil if
+// none has run since startup.
+func (s *SyncService) LastVerify() *VerifyReport {
+	s.verify.mu.Lock()
+	defer s.verify.mu.Unlock()
+	return s.verify.last
+}
+
+// Verify checks every stored activity against its file on disk: the file
+// must exist, have the recorded size and match the recorded SHA-256. With
+// opts.Repair, rows without a recorded size or checksum get the current
+// values as a baseline, and missing and corrupt files are downloaded again;
+// only such a run takes the job lock.
+func (s *SyncService) Verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	if opts.Repair {
+		release, err := s.acquireJob("verify")
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	report := &VerifyReport{
+		StartedAt:        time.Now(),
+		Missing:          []int{},
+		SizeMismatch:     []int{},
+		ChecksumMismatch: []int{},
+		Repaired:         []int{},
+		UntrackedFiles:   []string{},
+		Errors:           []string{},
+	}
+	tracked := make(map[string]bool)
+
+	filters := database.ActivityFilters{Limit: verifyPageSize}
+	for {
+		page, err := s.db.ListActivities(filters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list activities: %w", err)
+		}
+
+		for i := range page.Activities {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			activity := &page.Activities[i]
+			if activity.RemoteDeleted && !activity.Downloaded {
+				continue
+			}
+			tracked[filepath.Clean(activity.Filename)] = true
+			s.verifyActivity(activity, opts, report)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		filters.Cursor = page.NextCursor
+	}
+
+	activityDir := filepath.Join(s.dataDir, "activities")
+	err := filepath.WalkDir(activityDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() && !strings.HasSuffix(path, tempSuffix) && !strings.HasSuffix(path, backupSuffix) && !tracked[filepath.Clean(path)] {
+			report.UntrackedFiles = append(report.UntrackedFiles, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan activity directory: %w", err)
+	}
+
+	report.Duplicates, err = s.db.FindDuplicateFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicate files: %w", err)
+	}
+
+	report.FinishedAt = time.Now()
+	fmt.Printf("Verification: %d checked, %d ok, %d missing, %d corrupt, %d repaired\n",
+		report.Checked, report.OK, len(report.Missing),
+		len(report.SizeMismatch)+len(report.ChecksumMismatch), len(report.Repaired))
+
+	s.verify.mu.Lock()
+	s.verify.last = report
+	s.verify.mu.Unlock()
+
+	return report, nil
+}
+
+// verifyActivity checks one activity's file and records the result
+func (s *SyncService) verifyActivity(activity *database.Activity, opts VerifyOptions, report *VerifyReport) {
+	id := activity.ActivityID
+	report.Checked++
+
+	size, sum, err := hashFile(activity.Filename)
+	switch {
+	case os.IsNotExist(err):
+		report.Missing = append(report.Missing, id)
+	case err != nil:
+		report.Errors = append(report.Errors, fmt.Sprintf("activity %d: %v", id, err))
+		return
+	case activity.FileSize > 0 && size != activity.FileSize:
+		report.SizeMismatch = append(report.SizeMismatch, id)
+	case activity.FileSHA256 != "" && sum != activity.FileSHA256:
+		report.ChecksumMismatch = append(report.ChecksumMismatch, id)
+	case activity.FileSize == 0 || activity.FileSHA256 == "":
+		if opts.Repair {
+			if err := s.db.SetFileIntegrity(id, size, sum); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("activity %d: %v", id, err))
+				return
+			}
+		}
+		report.Baselined++
+		report.OK++
+		return
+	default:
+		report.OK++
+		return
+	}
+
+	// The file is missing or corrupt from here on
+	if !opts.Repair {
+		return
+	}
+	if err := s.repairFile(activity); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("activity %d: repair failed: %v", id, err))
+		// Let the next sync fetch it again. Imported and uploaded files
+		// have no other copy, so their rows are left to point at them.
+		if activity.Source == database.SourceGarmin && !activity.RemoteDeleted {
+			if err := s.db.SetActivityFile(id, activity.Filename, false); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("activity %d: %v", id, err))
+			}
+		}
+		return
+	}
+	report.Repaired = append(report.Repaired, id)
+}
+
+// repairFile downloads an activity again and replaces its stored file
+func (s *SyncService) repairFile(activity *database.Activity) error {
+	if activity.RemoteDeleted {
+		return fmt.Errorf("activity was deleted on Garmin Connect")
+	}
+	if activity.Source != database.SourceGarmin {
+		return fmt.Errorf("activity was not synced from Garmin Connect")
+	}
+
+	fileData, err := s.garminClient.DownloadActivity(activity.ActivityID, "fit")
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+
+	tempPath, err := writeTempFile(activity.Filename, fileData)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, activity.Filename); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("file rename failed: %w", err)
+	}
+
+	sum := sha256.Sum256(fileData)
+	return s.db.RecordDownload(activity.ActivityID, int64(len(fileData)), hex.EncodeToString(sum[:]),
+		parser.DetectFormat(fileData))
+}
+
+// hashFile returns the size and hex-encoded SHA-256 of a file
+func hashFile(filename string) (int64, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+func TestVerifyWithoutRepairOnlyReports(t *testing.T) {
+	s := newTestService(t)
+	missing := commitTestActivity(t, s, 1, "content")
+	os.Remove(missing.activity.Filename)
+	corrupt := commitTestActivity(t, s, 2, "content")
+	writeTestFile(t, corrupt.activity.Filename, "CONTENT")
+	commitTestActivity(t, s, 3, "content")
+	if err := s.db.SetFileIntegrity(3, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	before := snapshotRows(t, s.db)
+
+	report, err := s.Verify(context.Background(), VerifyOptions{Repair: false})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !reflect.DeepEqual(report.Missing, []int{1}) || !reflect.DeepEqual(report.ChecksumMismatch, []int{2}) {
+		t.Errorf("missing = %v, checksum mismatch = %v; want [1], [2]", report.Missing, report.ChecksumMismatch)
+	}
+	if report.Baselined != 1 || len(report.Repaired) != 0 {
+		t.Errorf("baselined = %d, repaired = %v; want 1, none", report.Baselined, report.Repaired)
+	}
+	if after := snapshotRows(t, s.db); !reflect.DeepEqual(before, after) {
+		t.Errorf("report-only verify changed the database:\nbefore %+v\nafter  %+v", before, after)
+	}
+}
+
+func TestVerifyRepairRecordsBaseline(t *testing.T) {
+	s := newTestService(t)
+	staged := commitTestActivity(t, s, 1, "content")
+	if err := s.db.SetFileIntegrity(1, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.Verify(context.Background(), VerifyOptions{Repair: true})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.Baselined != 1 || report.OK != 1 {
+		t.Errorf("baselined = %d, ok = %d; want 1, 1", report.Baselined, report.OK)
+	}
+	row, err := s.db.GetActivity(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.FileSize != staged.activity.FileSize || row.FileSHA256 != staged.activity.FileSHA256 {
+		t.Errorf("baseline = %d/%s, want %d/%s", row.FileSize, row.FileSHA256,
+			staged.activity.FileSize, staged.activity.FileSHA256)
+	}
+}
+
+// snapshotRows returns the file columns of every activity
+func snapshotRows(t *testing.T, db *database.SQLiteDB) []database.Activity {
+	t.Helper()
+	page, err := db.ListActivities(database.ActivityFilters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := make([]database.Activity, len(page.Activities))
+	for i, a := range page.Activities {
+		rows[i] = database.Activity{
+			ActivityID: a.ActivityID,
+			Filename:   a.Filename,
+			FileSize:   a.FileSize,
+			FileSHA256: a.FileSHA256,
+			Downloaded: a.Downloaded,
+		}
+	}
+	return rows
+}
@@ -0,0 +1,54 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WellnessResult summarises a wellness fetch
+type WellnessResult struct {
+	Days   int      `json:"days"`
+	Stored int      `json:"stored"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// SyncWellness fetches the daily stats of the last days days, today
+// included, and stores them in the wellness table. Days that fail are
+// reported and skipped.
+func (s *SyncService) SyncWellness(ctx context.Context, days int) (*WellnessResult, error) {
+	if days <= 0 {
+		days = 1
+	}
+
+	result := &WellnessResult{Days: days}
+	today := time.Now()
+	for i := 0; i < days; i++ {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		date := today.AddDate(0, 0, -i).Format(dateLayout)
+		stats, err := s.garminClient.GetStats(date)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", date, err))
+			continue
+		}
+		data, err := json.Marshal(stats)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", date, err))
+			continue
+		}
+		if err := s.db.SaveWellness(date, data); err != nil {
+			return result, fmt.Errorf("failed to store wellness for %s: %w", date, err)
+		}
+		result.Stored++
+	}
+
+	fmt.Printf("✅ Stored wellness stats for %d/%d days\n", result.Stored, days)
+	if result.Stored == 0 && len(result.Errors) > 0 {
+		return result, fmt.Errorf("no wellness stats fetched: %s", result.Errors[0])
+	}
+	return result, nil
+}
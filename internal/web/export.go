@@ -0,0 +1,174 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/export"
+	"github.com/sstent/garminsync-go/internal/sync"
+)
+
+// Export streams an archive of activity files with CSV and JSON manifests.
+// The X-Next-Cursor header, when set, resumes a limited export where this
+// one stops.
+func (h *WebHandler) Export(c *gin.Context) {
+	opts := export.Options{
+		ActivityType: c.Query("type"),
+		Archive:      c.Query("archive"),
+		Cursor:       c.Query("cursor"),
+	}
+	if formats := c.Query("formats"); formats != "" {
+		opts.Formats = strings.Split(formats, ",")
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		opts.Limit = n
+	}
+
+	var err error
+	opts.From, opts.To, err = sync.ParseWindow(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exporter := export.New(h.db)
+	nextCursor, err := exporter.NextCursor(opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare export"})
+		return
+	}
+
+	name := fmt.Sprintf("garminsync-export-%s.%s", time.Now().Format("20060102-150405"), opts.Archive)
+	c.Header("Content-Type", opts.ContentType())
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if nextCursor != "" {
+		c.Header("X-Next-Cursor", nextCursor)
+	}
+	c.Status(http.StatusOK)
+
+	// Once the archive has started the status can no longer change; a
+	// failure leaves the client with a truncated archive
+	result, err := exporter.Write(c.Request.Context(), c.Writer, opts)
+	if err != nil {
+		if !errors.Is(err, c.Request.Context().Err()) {
+			log.Printf("Export failed: %v", err)
+		}
+		return
+	}
+	if len(result.Errors) > 0 {
+		log.Printf("Export finished with %d errors", len(result.Errors))
+	}
+}
+
+// ExportActivitiesCSV streams activity summaries as CSV
+func (h *WebHandler) ExportActivitiesCSV(c *gin.Context) {
+	h.exportSummaries(c, export.SummaryCSV)
+}
+
+// ExportActivitiesJSONL streams activity summaries as JSON Lines
+func (h *WebHandler) ExportActivitiesJSONL(c *gin.Context) {
+	h.exportSummaries(c, export.SummaryJSONL)
+}
+
+func (h *WebHandler) exportSummaries(c *gin.Context, format string) {
+	filters, err := activityFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts := export.SummaryOptions{Filters: filters, Units: c.Query("units")}
+	if columns := c.Query("columns"); columns != "" {
+		opts.Columns = strings.Split(columns, ",")
+	}
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := fmt.Sprintf("activities-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Type", export.SummaryContentType(format))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Status(http.StatusOK)
+
+	if _, err := export.New(h.db).WriteSummaries(c.Request.Context(), c.Writer, format, opts); err != nil {
+		if !errors.Is(err, c.Request.Context().Err()) {
+			log.Printf("Activity export failed: %v", err)
+		}
+	}
+}
+
+// activityFilters reads database.ActivityFilters from the query string:
+// type, from and to (YYYY-MM-DD, inclusive), min_distance and max_distance
+// (metres), min_duration and max_duration (seconds), downloaded, sort_by,
+// sort_order, limit and offset
+func activityFilters(c *gin.Context) (database.ActivityFilters, error) {
+	filters := database.ActivityFilters{
+		ActivityType: c.Query("type"),
+		SortBy:       c.Query("sort_by"),
+		SortOrder:    c.Query("sort_order"),
+	}
+
+	from, to, err := sync.ParseWindow(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return filters, err
+	}
+	if !from.IsZero() {
+		filters.DateFrom = &from
+	}
+	if !to.IsZero() {
+		to = to.Add(-time.Second)
+		filters.DateTo = &to
+	}
+
+	for _, param := range []struct {
+		name string
+		dest *float64
+	}{{"min_distance", &filters.MinDistance}, {"max_distance", &filters.MaxDistance}} {
+		if value := c.Query(param.name); value != "" {
+			if *param.dest, err = strconv.ParseFloat(value, 64); err != nil {
+				return filters, fmt.Errorf("invalid %s", param.name)
+			}
+		}
+	}
+	for _, param := range []struct {
+		name string
+		dest *int
+	}{
+		{"min_duration", &filters.MinDuration},
+		{"max_duration", &filters.MaxDuration},
+		{"limit", &filters.Limit},
+		{"offset", &filters.Offset},
+	} {
+		if value := c.Query(param.name); value != "" {
+			if *param.dest, err = strconv.Atoi(value); err != nil || *param.dest < 0 {
+				return filters, fmt.Errorf("invalid %s", param.name)
+			}
+		}
+	}
+
+	if value := c.Query("downloaded"); value != "" {
+		downloaded, err := strconv.ParseBool(value)
+		if err != nil {
+			return filters, errors.New("invalid downloaded")
+		}
+		filters.Downloaded = &downloaded
+	}
+	return filters, nil
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sstent/garminsync-go/internal/convert"
+	"github.com/sstent/garminsync-go/internal/database"
+)
+
+// ActivityFile serves the stored file of an activity. The format query
+// parameter (fit, gpx or tcx) defaults to the stored format; GPX and TCX are
+// converted from the stored file on the fly when needed. Range requests and
+// conditional requests against the ETag are supported.
+func (h *WebHandler) ActivityFile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+
+	activity, err := h.db.GetActivity(id)
+	if err != nil {
+		if errors.Is(err, database.ErrActivityNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get activity"})
+		return
+	}
+	if !activity.Downloaded || activity.Filename == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No file stored for this activity"})
+		return
+	}
+
+	stored := activity.FileFormat()
+	format := c.DefaultQuery("format", stored)
+	switch format {
+	case "fit", convert.FormatGPX, convert.FormatTCX:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be fit, gpx or tcx"})
+		return
+	}
+	if format != stored && format == "fit" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot convert a %s file to FIT", stored)})
+		return
+	}
+
+	file, err := os.Open(activity.Filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Activity file is missing"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open activity file"})
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open activity file"})
+		return
+	}
+
+	name := fmt.Sprintf("activity-%d.%s", activity.ActivityID, format)
+	c.Header("Content-Type", convert.ContentType(format))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if activity.FileSHA256 != "" {
+		// Converted files also depend on the converter that wrote them
+		etag := activity.FileSHA256
+		if format != stored {
+			etag += "-" + format + "-v" + convert.Version
+		}
+		c.Header("ETag", strconv.Quote(etag))
+	}
+
+	if format == stored {
+		http.ServeContent(c.Writer, c.Request, name, info.ModTime(), file)
+		return
+	}
+
+	converted, err := convert.FromFile(activity.Filename, activity.ActivityName, activity.ActivityType)
+	if err != nil {
+		log.Printf("Parse error for activity %d: %v", activity.ActivityID, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Stored file cannot be parsed"})
+		return
+	}
+	var buf bytes.Buffer
+	if err := convert.Write(&buf, format, converted); err != nil {
+		log.Printf("Convert error for activity %d: %v", activity.ActivityID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert activity file"})
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), bytes.NewReader(buf.Bytes()))
+}
@@ -0,0 +1,259 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sstent/garminsync-go/internal/convert"
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/parser"
+	"github.com/tormoder/fit"
+)
+
+var fitStart = time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC)
+
+// testFIT encodes a short run of five one-second records
+func testFIT(t *testing.T) []byte {
+	t.Helper()
+	file, err := fit.NewFile(fit.FileTypeActivity, fit.NewHeader(fit.V20, false))
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	activity, err := file.Activity()
+	if err != nil {
+		t.Fatalf("Activity: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		record := fit.NewRecordMsg()
+		record.Timestamp = fitStart.Add(time.Duration(i) * time.Second)
+		record.PositionLat = fit.NewLatitudeDegrees(47 + float64(i)*0.00003)
+		record.PositionLong = fit.NewLongitudeDegrees(8)
+		record.Distance = uint32(i * 300)
+		record.HeartRate = uint8(120 + i)
+		activity.Records = append(activity.Records, record)
+	}
+	session := fit.NewSessionMsg()
+	session.StartTime = fitStart
+	session.Timestamp = fitStart.Add(4 * time.Second)
+	session.Sport = fit.SportRunning
+	session.TotalTimerTime = 4000
+	session.TotalDistance = 1200
+	activity.Sessions = append(activity.Sessions, session)
+
+	var buf bytes.Buffer
+	if err := fit.Encode(&buf, file, binary.LittleEndian); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// storeFile stores content as the downloaded file of a new activity and
+// returns its SHA-256
+func (ts *testServer) storeFile(t *testing.T, id int, format string, content []byte) string {
+	t.Helper()
+	filename := filepath.Join(ts.dataDir, "activities", fmt.Sprintf("%d.%s", id, format))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	activity := &database.Activity{
+		ActivityID:   id,
+		ActivityName: "Morning Run",
+		ActivityType: "running",
+		StartTime:    fitStart.Add(time.Duration(id) * time.Hour),
+		Filename:     filename,
+		FileType:     format,
+		FileSize:     int64(len(content)),
+		FileSHA256:   hex.EncodeToString(sum[:]),
+		Downloaded:   true,
+	}
+	if err := ts.db.CreateActivity(activity); err != nil {
+		t.Fatalf("CreateActivity: %v", err)
+	}
+	return activity.FileSHA256
+}
+
+// get requests path with the given headers and returns the response with
+// its body read
+func (ts *testServer) get(t *testing.T, path string, headers map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	return resp, body
+}
+
+func TestActivityFileStored(t *testing.T) {
+	ts := newTestServer(t)
+	fitData := testFIT(t)
+	gpxData := []byte(testGPX)
+	tests := []struct {
+		id          int
+		format      string
+		content     []byte
+		contentType string
+	}{
+		{1, "fit", fitData, "application/vnd.ant.fit"},
+		{2, "gpx", gpxData, "application/gpx+xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			sha := ts.storeFile(t, tt.id, tt.format, tt.content)
+			path := fmt.Sprintf("/api/activities/%d/file", tt.id)
+			etag := strconv.Quote(sha)
+
+			// Without a format the stored file is served as it is
+			resp, body := ts.get(t, path, nil)
+			if resp.StatusCode != http.StatusOK || !bytes.Equal(body, tt.content) {
+				t.Fatalf("GET = %d with %d bytes, want 200 with the stored %d bytes", resp.StatusCode, len(body), len(tt.content))
+			}
+			disposition := fmt.Sprintf("attachment; filename=activity-%d.%s", tt.id, tt.format)
+			if got := resp.Header.Get("Content-Disposition"); got != disposition {
+				t.Errorf("Content-Disposition = %q, want %q", got, disposition)
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := resp.Header.Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+			if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+				t.Errorf("Accept-Ranges = %q, want bytes", got)
+			}
+
+			resp, body = ts.get(t, path+"?format="+tt.format, map[string]string{"If-None-Match": etag})
+			if resp.StatusCode != http.StatusNotModified || len(body) != 0 {
+				t.Errorf("conditional GET = %d with %d bytes, want 304 without a body", resp.StatusCode, len(body))
+			}
+			resp, _ = ts.get(t, path, map[string]string{"If-None-Match": `"stale"`})
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("GET with a stale ETag = %d, want 200", resp.StatusCode)
+			}
+
+			resp, body = ts.get(t, path, map[string]string{"Range": "bytes=4-11"})
+			contentRange := fmt.Sprintf("bytes 4-11/%d", len(tt.content))
+			if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Content-Range") != contentRange ||
+				!bytes.Equal(body, tt.content[4:12]) {
+				t.Errorf("range GET = %d, %q, %q; want 206, %q with bytes 4-11",
+					resp.StatusCode, resp.Header.Get("Content-Range"), body, contentRange)
+			}
+			resp, _ = ts.get(t, path, map[string]string{"Range": fmt.Sprintf("bytes=%d-", len(tt.content))})
+			if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+				t.Errorf("range past the end = %d, want 416", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestActivityFileConverted(t *testing.T) {
+	ts := newTestServer(t)
+	sha := ts.storeFile(t, 1, "fit", testFIT(t))
+
+	for _, format := range []string{convert.FormatGPX, convert.FormatTCX} {
+		t.Run(format, func(t *testing.T) {
+			path := "/api/activities/1/file?format=" + format
+			resp, body := ts.get(t, path, nil)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET = %d, want 200: %s", resp.StatusCode, body)
+			}
+			if got, want := resp.Header.Get("Content-Type"), convert.ContentType(format); got != want {
+				t.Errorf("Content-Type = %q, want %q", got, want)
+			}
+			disposition := "attachment; filename=activity-1." + format
+			if got := resp.Header.Get("Content-Disposition"); got != disposition {
+				t.Errorf("Content-Disposition = %q, want %q", got, disposition)
+			}
+
+			// The converted file parses back to the stored activity
+			if detected := parser.DetectFormat(body); detected != format {
+				t.Fatalf("served a %s file, want %s", detected, format)
+			}
+			metrics, err := parser.NewParser().ParseData(body)
+			if err != nil {
+				t.Fatalf("parsing the converted file: %v", err)
+			}
+			if !metrics.StartTime.Equal(fitStart) || len(metrics.Records) != 5 || metrics.Records[4].HeartRate != 124 {
+				t.Errorf("converted file: start %v, %d records; want %v, 5 with heart rate", metrics.StartTime, len(metrics.Records), fitStart)
+			}
+
+			// Converted files have their own ETag and support ranges too
+			etag := strconv.Quote(sha + "-" + format + "-v" + convert.Version)
+			if got := resp.Header.Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+			resp, _ = ts.get(t, path, map[string]string{"If-None-Match": etag})
+			if resp.StatusCode != http.StatusNotModified {
+				t.Errorf("conditional GET = %d, want 304", resp.StatusCode)
+			}
+			resp, _ = ts.get(t, path, map[string]string{"If-None-Match": strconv.Quote(sha)})
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("GET with the stored file's ETag = %d, want 200", resp.StatusCode)
+			}
+			resp, partial := ts.get(t, path, map[string]string{"Range": "bytes=0-4"})
+			if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(partial, body[:5]) {
+				t.Errorf("range GET = %d, %q; want 206 with %q", resp.StatusCode, partial, body[:5])
+			}
+		})
+	}
+}
+
+func TestActivityFileErrors(t *testing.T) {
+	ts := newTestServer(t)
+	ts.storeFile(t, 1, "gpx", []byte(testGPX))
+	ts.storeFile(t, 2, "tcx", []byte("<TrainingCenterDatabase>"))
+	ts.storeFile(t, 3, "fit", []byte("corrupt"))
+	ts.storeFile(t, 4, "fit", testFIT(t))
+	if err := os.Remove(filepath.Join(ts.dataDir, "activities", "4.fit")); err != nil {
+		t.Fatal(err)
+	}
+	pending := &database.Activity{ActivityID: 5, StartTime: fitStart, Filename: "5.fit"}
+	if err := ts.db.CreateActivity(pending); err != nil {
+		t.Fatalf("CreateActivity: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"fit from gpx", "/api/activities/1/file?format=fit", http.StatusBadRequest},
+		{"fit from tcx", "/api/activities/2/file?format=fit", http.StatusBadRequest},
+		{"unknown format", "/api/activities/1/file?format=csv", http.StatusBadRequest},
+		{"invalid id", "/api/activities/one/file", http.StatusBadRequest},
+		{"unknown activity", "/api/activities/99/file", http.StatusNotFound},
+		{"not downloaded", "/api/activities/5/file", http.StatusNotFound},
+		{"file missing", "/api/activities/4/file", http.StatusNotFound},
+		{"unparsable stored file", "/api/activities/3/file?format=gpx", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		if resp, body := ts.get(t, tt.path, nil); resp.StatusCode != tt.want {
+			t.Errorf("%s: GET %s = %d, want %d: %s", tt.name, tt.path, resp.StatusCode, tt.want, body)
+		}
+	}
+}
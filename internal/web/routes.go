@@ -2,35 +2,111 @@ package web
 
 import (
 	"context"
+	"errors"
+	"io"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sstent/garminsync-go/internal/database"
 	"github.com/sstent/garminsync-go/internal/garmin"
+	"github.com/sstent/garminsync-go/internal/parser"
+	"github.com/sstent/garminsync-go/internal/scheduler"
 	"github.com/sstent/garminsync-go/internal/sync"
 )
 
+// maxPageSize caps the number of activities returned per page
+const maxPageSize = 500
+
+// sseKeepAlive is how often an idle event stream gets a keep-alive comment
+const sseKeepAlive = 15 * time.Second
+
 type WebHandler struct {
-	db       *database.SQLiteDB
-	syncer   *sync.SyncService
-	garmin   *garmin.Client
+	db          *database.SQLiteDB
+	syncer      *sync.SyncService
+	coordinator *sync.Coordinator
+	scheduler   *scheduler.Scheduler
+	garmin      *garmin.Client
+	importDir   string // directory JSON path imports may read from, "" to refuse them
+
+	// ctx outlives requests and is cancelled on Stop to interrupt the
+	// background jobs they started
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func NewWebHandler(db *database.SQLiteDB, syncer *sync.SyncService, garmin *garmin.Client) *WebHandler {
+func NewWebHandler(db *database.SQLiteDB, syncer *sync.SyncService, coordinator *sync.Coordinator, scheduler *scheduler.Scheduler, garmin *garmin.Client) *WebHandler {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &WebHandler{
-		db:       db,
-		syncer:   syncer,
-		garmin:   garmin,
+		db:          db,
+		syncer:      syncer,
+		coordinator: coordinator,
+		scheduler:   scheduler,
+		garmin:      garmin,
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 }
 
+// Stop cancels background jobs started through the API, such as a
+// reprocess job. They stop at the next activity.
+func (h *WebHandler) Stop() {
+	h.cancel()
+}
+
+// SetImportDir sets the directory POST /import may read server-side paths
+// from. Without one, only uploaded files can be imported.
+func (h *WebHandler) SetImportDir(dir string) {
+	h.importDir = dir
+}
+
 func (h *WebHandler) RegisterRoutes(router *gin.RouterGroup) {
 	router.GET("/stats", h.GetStats)
 	router.GET("/activities", h.ActivityList)
+	router.POST("/activities/upload", h.UploadActivity)
+	router.GET("/activities/export.csv", h.ExportActivitiesCSV)
+	router.GET("/activities/export.jsonl", h.ExportActivitiesJSONL)
 	router.GET("/activities/:id", h.ActivityDetail)
+	router.GET("/activities/:id/revisions", h.ActivityRevisions)
+	router.GET("/activities/:id/laps", h.ActivityLaps)
+	router.GET("/activities/:id/file", h.ActivityFile)
 	router.POST("/sync", h.Sync)
+	router.DELETE("/sync", h.CancelSync)
+	router.GET("/sync/status", h.SyncStatus)
+	router.GET("/sync/plan", h.SyncPlan)
+	router.GET("/sync/rules", h.GetSyncRules)
+	router.PUT("/sync/rules", h.UpdateSyncRules)
+	router.GET("/sync/skipped", h.SkippedActivities)
+	router.GET("/sync/events", h.SyncEvents)
+	router.GET("/sync/runs", h.SyncRuns)
+	router.GET("/sync/runs/:id", h.SyncRunDetail)
+	router.GET("/sync/retries", h.RetryList)
+	router.POST("/sync/retries/:id/retry", h.RetryActivity)
+	router.POST("/sync/retries/:id/ignore", h.IgnoreActivity)
+	router.GET("/daemon", h.GetDaemon)
+	router.PUT("/daemon", h.UpdateDaemon)
+	router.GET("/schedules", h.ScheduleList)
+	router.POST("/schedules", h.CreateSchedule)
+	router.GET("/schedules/:id", h.ScheduleDetail)
+	router.PUT("/schedules/:id", h.UpdateSchedule)
+	router.DELETE("/schedules/:id", h.DeleteSchedule)
+	router.POST("/schedules/:id/run", h.TriggerSchedule)
+	router.GET("/schedules/:id/runs", h.ScheduleRuns)
+	router.GET("/export", h.Export)
+	router.POST("/import", h.Import)
+	router.GET("/reconcile", h.GetReconcile)
+	router.POST("/reconcile", h.Reconcile)
+	router.GET("/maintenance/verify", h.GetVerify)
+	router.POST("/maintenance/verify", h.Verify)
+	router.GET("/maintenance/reprocess", h.GetReprocess)
+	router.POST("/maintenance/reprocess", h.Reprocess)
+	router.GET("/maintenance/duplicates", h.Duplicates)
 }
 
 func (h *WebHandler) GetStats(c *gin.Context) {
@@ -44,19 +120,29 @@ func (h *WebHandler) GetStats(c *gin.Context) {
 
 func (h *WebHandler) ActivityList(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.Query("limit"))
-	offset, _ := strconv.Atoi(c.Query("offset"))
 	
 	if limit <= 0 {
 		limit = 50
 	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
 	
-	activities, err := h.db.GetActivities(limit, offset)
+	page, err := h.db.ListActivities(database.ActivityFilters{
+		ActivityType: c.Query("type"),
+		Limit:        limit,
+		Cursor:       c.Query("cursor"),
+	})
 	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get activities"})
 		return
 	}
 	
-	c.JSON(http.StatusOK, activities)
+	c.JSON(http.StatusOK, page)
 }
 
 func (h *WebHandler) ActivityDetail(c *gin.Context) {
@@ -75,13 +161,599 @@ func (h *WebHandler) ActivityDetail(c *gin.Context) {
 	c.JSON(http.StatusOK, activity)
 }
 
+func (h *WebHandler) ActivityRevisions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+	
+	revisions, err := h.db.GetActivityRevisions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get revisions"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, revisions)
+}
+
+func (h *WebHandler) ActivityLaps(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+
+	laps, err := h.db.GetActivityLaps(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get laps"})
+		return
+	}
+
+	c.JSON(http.StatusOK, laps)
+}
+
+// UploadActivity stores a FIT, GPX or TCX file sent as the multipart field
+// "file" as a new activity with a local ID, and returns it with its laps.
+func (h *WebHandler) UploadActivity(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	defer file.Close()
+
+	activity, err := h.syncer.Upload(filepath.Base(header.Filename), file)
+	if err != nil {
+		var duplicate *sync.DuplicateError
+		switch {
+		case errors.As(err, &duplicate):
+			c.JSON(http.StatusConflict, gin.H{"error": "Activity already exists", "activity_id": duplicate.ActivityID})
+		case errors.Is(err, parser.ErrUnsupportedFormat), errors.Is(err, parser.ErrNotActivity),
+			errors.Is(err, sync.ErrInvalidActivityFile):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, sync.ErrJobRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Upload error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store activity"})
+		}
+		return
+	}
+
+	laps, err := h.db.GetActivityLaps(activity.ActivityID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get laps"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"activity": activity, "laps": laps})
+}
+
+// Sync starts a sync in the background. If one is already running the
+// existing job is returned with 409 instead of starting another.
+//
+// The optional JSON body limits the run to a date window and can force
+// activities to be downloaded again:
+//
+//	{"from": "2024-03-01", "to": "2024-03-31", "force": true, "mode": "full"}
 func (h *WebHandler) Sync(c *gin.Context) {
-	go func() {
-		err := h.syncer.Sync(context.Background())
+	var req struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Force bool   `json:"force"`
+		Mode  string `json:"mode"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	opts, err := syncOptions(req.Mode, req.From, req.To, req.Force)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.coordinator.Start(opts)
+	if err != nil {
+		if errors.Is(err, sync.ErrSyncInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Sync already in progress", "job": job})
+			return
+		}
+		if errors.Is(err, sync.ErrJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sync"})
+		return
+	}
+	
+	c.JSON(http.StatusAccepted, gin.H{"status": "sync_started", "job": job})
+}
+
+// SyncPlan returns what a sync would do without downloading or storing
+// anything. It takes the same options as POST /sync as query parameters.
+func (h *WebHandler) SyncPlan(c *gin.Context) {
+	force, _ := strconv.ParseBool(c.Query("force"))
+	opts, err := syncOptions(c.Query("mode"), c.Query("from"), c.Query("to"), force)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, err := h.syncer.Plan(c.Request.Context(), opts)
+	if err != nil {
+		log.Printf("Plan error: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to compute sync plan"})
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// syncOptions validates the options accepted by the sync endpoints
+func syncOptions(mode, from, to string, force bool) (sync.Options, error) {
+	opts := sync.Options{Trigger: sync.TriggerAPI, Mode: mode, Force: force}
+	switch mode {
+	case "", sync.ModeIncremental, sync.ModeFull:
+	default:
+		return opts, errors.New("mode must be incremental or full")
+	}
+
+	var err error
+	opts.From, opts.To, err = sync.ParseWindow(from, to)
+	return opts, err
+}
+
+func (h *WebHandler) GetSyncRules(c *gin.Context) {
+	c.JSON(http.StatusOK, h.syncer.Rules())
+}
+
+// UpdateSyncRules replaces the sync filter rules. They apply to the next
+// activity a sync looks at and are kept across restarts.
+func (h *WebHandler) UpdateSyncRules(c *gin.Context) {
+	var rules sync.Rules
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := h.syncer.SaveRules(rules); err != nil {
+		if errors.Is(err, sync.ErrInvalidRules) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save sync rules"})
+		return
+	}
+	c.JSON(http.StatusOK, h.syncer.Rules())
+}
+
+// SkippedActivities lists activities the sync rules filtered out, with why
+func (h *WebHandler) SkippedActivities(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	skipped, err := h.db.ListSkipped(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get skipped activities"})
+		return
+	}
+	c.JSON(http.StatusOK, skipped)
+}
+
+func (h *WebHandler) SyncStatus(c *gin.Context) {
+	job, ok := h.coordinator.Status()
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"running": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"running": job.Running(), "job": job})
+}
+
+// SyncEvents streams sync progress events as Server-Sent Events until the
+// client disconnects. The current job status is sent first so clients that
+// connect mid-run can show where it is.
+func (h *WebHandler) SyncEvents(c *gin.Context) {
+	events, unsubscribe := h.syncer.Events().Subscribe()
+	defer unsubscribe()
+
+	if job, ok := h.coordinator.Status(); ok {
+		c.SSEvent("status", job)
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		case <-keepAlive.C:
+			// Comment lines keep proxies from closing an idle stream
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// CancelSync cancels the running sync. The job stops at the next activity
+// boundary; poll /sync/status to see it finish.
+func (h *WebHandler) CancelSync(c *gin.Context) {
+	job, err := h.coordinator.Cancel()
+	if err != nil {
+		if errors.Is(err, sync.ErrNoSyncRunning) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No sync is running"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel sync"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "cancelling", "job": job})
+}
+
+func (h *WebHandler) GetDaemon(c *gin.Context) {
+	status, err := h.scheduler.Status()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get daemon config"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// UpdateDaemon changes the sync schedule and applies it without a restart.
+// Fields left out of the body keep their current value.
+func (h *WebHandler) UpdateDaemon(c *gin.Context) {
+	var req struct {
+		Enabled      *bool   `json:"enabled"`
+		ScheduleCron *string `json:"schedule_cron"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	current, err := h.scheduler.Status()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get daemon config"})
+		return
+	}
+	enabled, expr := current.Enabled, current.ScheduleCron
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	if req.ScheduleCron != nil {
+		expr = *req.ScheduleCron
+	}
+
+	status, err := h.scheduler.Update(enabled, expr)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrInvalidSchedule) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update daemon config"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// Import adds activity files to the archive and returns the report once
+// finished. It accepts either a ZIP archive or activity file uploaded as the
+// multipart field "file", or a JSON body naming a directory or ZIP inside
+// the configured import directory, relative to it or absolute:
+//
+//	{"path": "garmin-export.zip"}
+func (h *WebHandler) Import(c *gin.Context) {
+	if c.ContentType() == "multipart/form-data" {
+		header, err := c.FormFile("file")
 		if err != nil {
-			log.Printf("Sync error: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+			return
 		}
-	}()
+		dir, err := os.MkdirTemp("", "garminsync-import-")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store upload"})
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, filepath.Base(header.Filename))
+		if err := c.SaveUploadedFile(header, path); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store upload"})
+			return
+		}
+		report, err := h.syncer.Import(c.Request.Context(), path)
+		if err != nil {
+			if errors.Is(err, sync.ErrJobRunning) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Import error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range report.Files {
+			report.Files[i].Path = strings.TrimPrefix(report.Files[i].Path, dir+string(filepath.Separator))
+		}
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: path is required"})
+		return
+	}
+	if h.importDir == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Path imports are disabled; set IMPORT_DIR or upload the file"})
+		return
+	}
+	path, err := resolveImportPath(h.importDir, req.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Path does not exist"})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := h.syncer.Import(c.Request.Context(), path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Path does not exist"})
+			return
+		}
+		if errors.Is(err, sync.ErrJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Import error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// errOutsideImportDir is returned for import paths that leave the import
+// directory
+var errOutsideImportDir = errors.New("path is outside the import directory")
+
+// resolveImportPath resolves an import path against the import directory,
+// following symlinks, and refuses paths that end up outside it
+func resolveImportPath(root, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideImportDir
+	}
+	return resolved, nil
+}
+
+func (h *WebHandler) GetReconcile(c *gin.Context) {
+	result := h.syncer.LastReconcile()
+	if result == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No reconciliation has run yet"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Reconcile runs a reconciliation pass against Garmin Connect and returns its
+// result once finished.
+func (h *WebHandler) Reconcile(c *gin.Context) {
+	result, err := h.syncer.Reconcile(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, sync.ErrJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Reconcile error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *WebHandler) GetVerify(c *gin.Context) {
+	report := h.syncer.LastVerify()
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No verification has run yet"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// Verify checks the archive on disk against the database and returns the
+// report once finished. Pass repair=false to only report problems.
+func (h *WebHandler) Verify(c *gin.Context) {
+	repair := true
+	if value := c.Query("repair"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repair flag"})
+			return
+		}
+		repair = parsed
+	}
 	
-	c.JSON(http.StatusOK, gin.H{"status": "sync_started", "message": "Sync started in background"})
+	report, err := h.syncer.Verify(c.Request.Context(), sync.VerifyOptions{Repair: repair})
+	if err != nil {
+		if errors.Is(err, sync.ErrJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Verify error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetReprocess returns the progress of the running reprocess job, or the
+// report of the last one.
+func (h *WebHandler) GetReprocess(c *gin.Context) {
+	report := h.syncer.LastReprocess()
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No reprocess job has run yet"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// Reprocess starts parsing stored files again in the background, updating
+// the activities' metrics and laps. The optional JSON body selects the
+// activities and the number of parallel workers:
+//
+//	{"type": "running", "from": "2024-01-01", "to": "2024-12-31", "workers": 4}
+func (h *WebHandler) Reprocess(c *gin.Context) {
+	var req struct {
+		Type    string `json:"type"`
+		From    string `json:"from"`
+		To      string `json:"to"`
+		Workers int    `json:"workers"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	opts := sync.ReprocessOptions{ActivityType: req.Type, Workers: req.Workers}
+	var err error
+	opts.From, opts.To, err = sync.ParseWindow(req.From, req.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The job outlives the request, but not the server
+	report, err := h.syncer.StartReprocess(h.ctx, opts)
+	if err != nil {
+		if errors.Is(err, sync.ErrReprocessRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Reprocess already running", "report": h.syncer.LastReprocess()})
+			return
+		}
+		if errors.Is(err, sync.ErrJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start reprocess"})
+		return
+	}
+	c.JSON(http.StatusAccepted, report)
+}
+
+func (h *WebHandler) Duplicates(c *gin.Context) {
+	groups, err := h.db.FindDuplicateFiles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find duplicates"})
+		return
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+func (h *WebHandler) SyncRuns(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	
+	runs, err := h.db.ListSyncRuns(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sync runs"})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+func (h *WebHandler) SyncRunDetail(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sync run ID"})
+		return
+	}
+	
+	run, err := h.db.GetSyncRun(id)
+	if err != nil {
+		if errors.Is(err, database.ErrSyncRunNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sync run not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sync run"})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+// RetryList lists the retry queue; pass status=dead for dead-lettered
+// activities only
+func (h *WebHandler) RetryList(c *gin.Context) {
+	entries, err := h.db.ListRetries(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get retry queue"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// RetryActivity resets a queued activity so the next sync attempts it again
+func (h *WebHandler) RetryActivity(c *gin.Context) {
+	h.setRetryStatus(c, database.RetryPending)
+}
+
+// IgnoreActivity stops a queued activity from ever being retried
+func (h *WebHandler) IgnoreActivity(c *gin.Context) {
+	h.setRetryStatus(c, database.RetryIgnored)
+}
+
+func (h *WebHandler) setRetryStatus(c *gin.Context, status string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+	
+	if err := h.db.SetRetryStatus(id, status); err != nil {
+		if errors.Is(err, database.ErrRetryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Activity is not in the retry queue"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update retry queue"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"activity_id": id, "status": status})
 }
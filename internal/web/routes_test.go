@@ -0,0 +1,340 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/garmin"
+	"github.com/sstent/garminsync-go/internal/scheduler"
+	"github.com/sstent/garminsync-go/internal/sync"
+)
+
+// testServer is the API of a handler backed by a temporary database and
+// data directory
+type testServer struct {
+	*httptest.Server
+	handler *WebHandler
+	db      *database.SQLiteDB
+	syncer  *sync.SyncService
+	dataDir string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	db, err := database.NewSQLiteDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	client := garmin.NewClient()
+	syncer := sync.NewSyncService(client, db, dir)
+	coordinator := sync.NewCoordinator(syncer)
+	handler := NewWebHandler(db, syncer, coordinator, scheduler.New(db, syncer, coordinator), client)
+
+	router := gin.New()
+	handler.RegisterRoutes(router.Group("/api"))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return &testServer{Server: server, handler: handler, db: db, syncer: syncer, dataDir: dir}
+}
+
+// request sends a request with an optional JSON body to the test server,
+// decodes the response into out when it is not nil and returns the status
+func (ts *testServer) request(t *testing.T, method, path, body string, out interface{}) int {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// testGPX is a two-point GPX run
+const testGPX = `<?xml version="1.0"?>
+<gpx version="1.1"><trk><name>Lunch Run</name><type>running</type><trkseg>
+<trkpt lat="52.0" lon="4.0"><time>2024-05-01T12:00:00Z</time></trkpt>
+<trkpt lat="52.001" lon="4.0"><time>2024-05-01T12:01:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+
+// upload posts content as the multipart field "file" to the upload route
+// and decodes the JSON response into out
+func (ts *testServer) upload(t *testing.T, field, filename, content string, out interface{}) int {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(ts.URL+"/api/activities/upload", w.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("POST /activities/upload: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("decoding upload response: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestUploadActivity(t *testing.T) {
+	ts := newTestServer(t)
+
+	var created struct {
+		Activity database.Activity `json:"activity"`
+		Laps     []database.Lap    `json:"laps"`
+	}
+	if code := ts.upload(t, "file", "../lunch.gpx", testGPX, &created); code != http.StatusCreated {
+		t.Fatalf("upload = %d, want 201", code)
+	}
+	activity := created.Activity
+	if activity.ActivityID >= 0 || activity.Source != database.SourceUpload || activity.ActivityName != "Lunch Run" ||
+		activity.ActivityType != "running" || activity.FileType != "gpx" || activity.Distance < 100 {
+		t.Errorf("created activity = %+v, want a parsed GPX run under a local ID", activity)
+	}
+	if created.Laps == nil {
+		t.Errorf("laps missing from the response")
+	}
+	want := filepath.Join(ts.dataDir, "activities", fmt.Sprintf("%d.gpx", activity.ActivityID))
+	if data, err := os.ReadFile(want); err != nil || string(data) != testGPX {
+		t.Errorf("stored file %s: %v, want the uploaded content", want, err)
+	}
+
+	var conflict struct {
+		ActivityID int `json:"activity_id"`
+	}
+	if code := ts.upload(t, "file", "again.gpx", testGPX, &conflict); code != http.StatusConflict || conflict.ActivityID != activity.ActivityID {
+		t.Errorf("duplicate upload = %d, activity %d; want 409 naming %d", code, conflict.ActivityID, activity.ActivityID)
+	}
+
+	tests := []struct {
+		name, field, filename, content string
+	}{
+		{"unparsable GPX", "file", "broken.gpx", "<gpx><trk>"},
+		{"unsupported format", "file", "notes.txt", "just some notes"},
+		{"missing file field", "upload", "lunch.gpx", testGPX},
+	}
+	for _, tt := range tests {
+		var failed struct {
+			Error string `json:"error"`
+		}
+		if code := ts.upload(t, tt.field, tt.filename, tt.content, &failed); code != http.StatusBadRequest || failed.Error == "" {
+			t.Errorf("%s: upload = %d, %q; want 400 with an error", tt.name, code, failed.Error)
+		}
+	}
+	if n, err := ts.db.NextLocalActivityID(); err != nil || n != activity.ActivityID-1 {
+		t.Errorf("NextLocalActivityID = %d, %v; want only the first upload stored", n, err)
+	}
+}
+
+func TestUpdateDaemonReloadsSchedule(t *testing.T) {
+	ts := newTestServer(t)
+	// Only fires on New Year's Day, so no sync runs during the test
+	const newYear = "0 0 1 1 *"
+	if err := ts.db.UpdateDaemonSchedule(false, newYear); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.handler.scheduler.Start(); err != nil {
+		t.Fatalf("scheduler Start: %v", err)
+	}
+	t.Cleanup(ts.handler.scheduler.Stop)
+
+	var status scheduler.Status
+	if code := ts.request(t, http.MethodPut, "/api/daemon", `{"enabled": true}`, &status); code != http.StatusOK {
+		t.Fatalf("PUT /daemon = %d, want 200", code)
+	}
+	if !status.Enabled || status.ScheduleCron != newYear || status.Status != database.DaemonIdle || status.NextRun == nil {
+		t.Errorf("after enabling: %+v, want enabled, idle with a next run", status)
+	}
+
+	if code := ts.request(t, http.MethodPut, "/api/daemon", `{"schedule_cron": "every day"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("PUT /daemon with invalid cron = %d, want 400", code)
+	}
+
+	status = scheduler.Status{}
+	if code := ts.request(t, http.MethodPut, "/api/daemon", `{"enabled": false}`, &status); code != http.StatusOK {
+		t.Fatalf("PUT /daemon = %d, want 200", code)
+	}
+	if status.Enabled || status.ScheduleCron != newYear || status.Status != database.DaemonDisabled || status.NextRun != nil {
+		t.Errorf("after disabling: %+v, want the same cron, disabled without a next run", status)
+	}
+
+	status = scheduler.Status{}
+	if code := ts.request(t, http.MethodGet, "/api/daemon", "", &status); code != http.StatusOK || status.Status != database.DaemonDisabled {
+		t.Errorf("GET /daemon = %d, %+v; want the stored, disabled config", code, status)
+	}
+}
+
+func TestReprocessStopsWithHandler(t *testing.T) {
+	ts := newTestServer(t)
+	activity := &database.Activity{
+		ActivityID: 1,
+		StartTime:  time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC),
+		Filename:   filepath.Join(ts.dataDir, "activities", "1.fit"),
+		Downloaded: true,
+	}
+	if err := ts.db.CreateActivity(activity); err != nil {
+		t.Fatalf("CreateActivity: %v", err)
+	}
+
+	// Jobs started after Stop see the cancelled server context at once
+	ts.handler.Stop()
+	var report sync.ReprocessReport
+	if code := ts.request(t, http.MethodPost, "/api/maintenance/reprocess", `{"workers": 1}`, &report); code != http.StatusAccepted {
+		t.Fatalf("POST /maintenance/reprocess = %d, want 202", code)
+	}
+	if !report.Running || report.Workers != 1 {
+		t.Errorf("initial report = %+v, want a running job with 1 worker", report)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		report = sync.ReprocessReport{}
+		if code := ts.request(t, http.MethodGet, "/api/maintenance/reprocess", "", &report); code != http.StatusOK {
+			t.Fatalf("GET /maintenance/reprocess = %d, want 200", code)
+		}
+		if !report.Running || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if report.Running || report.Error != context.Canceled.Error() {
+		t.Errorf("report = %+v, want the job cancelled", report)
+	}
+}
+
+func TestSyncEvents(t *testing.T) {
+	ts := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/sync/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The handler subscribes at some point after the request is sent, so
+	// keep publishing until the stream delivers an event
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			ts.syncer.Events().Publish(sync.Event{Type: sync.EventActivitySaved, ActivityID: 7})
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /sync/events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	var event, data string
+	for lines.Scan() && (event == "" || data == "") {
+		line := lines.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = line
+		case strings.HasPrefix(line, "data:"):
+			data = line
+		}
+	}
+	if event != "event:"+sync.EventActivitySaved {
+		t.Errorf("event line = %q, want event:%s", event, sync.EventActivitySaved)
+	}
+	if !strings.Contains(data, `"activity_id":7`) {
+		t.Errorf("data line = %q, want activity 7", data)
+	}
+}
+
+func TestResolveImportPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for _, dir := range []string{filepath.Join(root, "exports"), filepath.Join(outside, "secret")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"exports", filepath.Join(root, "exports"), nil},
+		{".", root, nil},
+		{filepath.Join(root, "exports"), filepath.Join(root, "exports"), nil},
+		{"exports/../exports", filepath.Join(root, "exports"), nil},
+		{"../" + filepath.Base(outside) + "/secret", "", errOutsideImportDir},
+		{filepath.Join(outside, "secret"), "", errOutsideImportDir},
+		{"/etc", "", errOutsideImportDir},
+		{"link", "", errOutsideImportDir},
+		{"missing", "", fs.ErrNotExist},
+	}
+	for _, tt := range tests {
+		got, err := resolveImportPath(root, tt.path)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("resolveImportPath(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		want, _ := filepath.EvalSymlinks(tt.want)
+		if err != nil || got != want {
+			t.Errorf("resolveImportPath(%q) = %q, %v; want %q", tt.path, got, err, want)
+		}
+	}
+}
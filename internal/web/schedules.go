@@ -0,0 +1,181 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sstent/garminsync-go/internal/database"
+	"github.com/sstent/garminsync-go/internal/scheduler"
+)
+
+// scheduleRequest is the body of schedule create and update requests.
+// Fields left out of an update keep their current value.
+type scheduleRequest struct {
+	Name         *string          `json:"name"`
+	Kind         *string          `json:"kind"`
+	ScheduleCron *string          `json:"schedule_cron"`
+	Params       *json.RawMessage `json:"params"`
+	Enabled      *bool            `json:"enabled"`
+}
+
+func (r *scheduleRequest) apply(schedule *database.Schedule) {
+	if r.Name != nil {
+		schedule.Name = *r.Name
+	}
+	if r.Kind != nil {
+		schedule.Kind = *r.Kind
+	}
+	if r.ScheduleCron != nil {
+		schedule.ScheduleCron = *r.ScheduleCron
+	}
+	if r.Params != nil {
+		schedule.Params = *r.Params
+	}
+	if r.Enabled != nil {
+		schedule.Enabled = *r.Enabled
+	}
+}
+
+func (h *WebHandler) ScheduleList(c *gin.Context) {
+	schedules, err := h.scheduler.Schedules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedules"})
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+func (h *WebHandler) ScheduleDetail(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.scheduler.Schedule(id)
+	if err != nil {
+		scheduleError(c, err, "Failed to get schedule")
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (h *WebHandler) CreateSchedule(c *gin.Context) {
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	schedule := &database.Schedule{Enabled: true}
+	req.apply(schedule)
+	status, err := h.scheduler.CreateSchedule(schedule)
+	if err != nil {
+		scheduleError(c, err, "Failed to create schedule")
+		return
+	}
+	c.JSON(http.StatusCreated, status)
+}
+
+func (h *WebHandler) UpdateSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	schedule, err := h.db.GetSchedule(id)
+	if err != nil {
+		scheduleError(c, err, "Failed to get schedule")
+		return
+	}
+	req.apply(schedule)
+	status, err := h.scheduler.UpdateSchedule(schedule)
+	if err != nil {
+		scheduleError(c, err, "Failed to update schedule")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func (h *WebHandler) DeleteSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduler.DeleteSchedule(id); err != nil {
+		scheduleError(c, err, "Failed to delete schedule")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// TriggerSchedule runs a schedule now; the run finishes in the background
+func (h *WebHandler) TriggerSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+
+	run, err := h.scheduler.TriggerSchedule(id)
+	if err != nil {
+		scheduleError(c, err, "Failed to trigger schedule")
+		return
+	}
+	c.JSON(http.StatusAccepted, run)
+}
+
+func (h *WebHandler) ScheduleRuns(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	if _, err := h.db.GetSchedule(id); err != nil {
+		scheduleError(c, err, "Failed to get schedule")
+		return
+	}
+	runs, err := h.db.ListScheduleRuns(id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedule runs"})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+func scheduleID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// scheduleError maps scheduler and database errors to responses
+func scheduleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+	case errors.Is(err, database.ErrScheduleExists), errors.Is(err, scheduler.ErrScheduleRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, scheduler.ErrInvalidScheduleConfig), errors.Is(err, scheduler.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
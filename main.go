@@ -4,12 +4,15 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,21 +20,24 @@ import (
 
 	"github.com/sstent/garminsync-go/internal/database"
 	"github.com/sstent/garminsync-go/internal/garmin"
+	"github.com/sstent/garminsync-go/internal/processors"
+	"github.com/sstent/garminsync-go/internal/scheduler"
 	"github.com/sstent/garminsync-go/internal/sync"
 	"github.com/sstent/garminsync-go/internal/web"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/gin-gonic/gin"
-	"github.com/robfig/cron/v3"
 )
 
 type App struct {
 	db         *database.SQLiteDB
-	cron       *cron.Cron
+	scheduler  *scheduler.Scheduler
 	server     *http.Server
 	garmin     *garmin.Client
 	shutdown   chan os.Signal
 	syncService *sync.SyncService  // This should now work
+	coordinator *sync.Coordinator
+	webHandler  *web.WebHandler
 }
 
 func main() {
@@ -49,7 +55,21 @@ func main() {
 		log.Fatal("Failed to initialize app:", err)
 	}
 
+	// Run a one-shot command instead of the server if one was given
+	if len(os.Args) > 1 {
+		err := app.runCommand(os.Args[1:])
+		app.closeProcessors()
+		app.db.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Start services
+	if err := app.initServer(); err != nil {
+		log.Fatal("Failed to initialize server:", err)
+	}
 	app.start()
 
 	// Wait for shutdown signal
@@ -78,30 +98,89 @@ func (app *App) init() error {
 		dataDir = "./data"
 	}
 	app.syncService = sync.NewSyncService(app.garmin, app.db, dataDir)
+	if detect, err := strconv.ParseBool(os.Getenv("SYNC_DETECT_CHANGES")); err == nil {
+		app.syncService.SetChangeDetection(detect)
+	}
+	if attempts, err := strconv.Atoi(os.Getenv("SYNC_MAX_ATTEMPTS")); err == nil {
+		app.syncService.SetMaxAttempts(attempts)
+	}
+	policy, err := sync.ParseDeletionPolicy(os.Getenv("SYNC_DELETION_POLICY"))
+	if err != nil {
+		return err
+	}
+	app.syncService.SetDeletionPolicy(policy)
+
+	// Filter rules from the environment apply until rules are saved via the API
+	minDuration, _ := strconv.ParseFloat(os.Getenv("SYNC_MIN_DURATION"), 64)
+	minDistance, _ := strconv.ParseFloat(os.Getenv("SYNC_MIN_DISTANCE"), 64)
+	rules := sync.Rules{
+		IncludeTypes: splitList(os.Getenv("SYNC_INCLUDE_TYPES")),
+		ExcludeTypes: splitList(os.Getenv("SYNC_EXCLUDE_TYPES")),
+		MinDuration:  minDuration,
+		MinDistance:  minDistance,
+		From:         os.Getenv("SYNC_FROM"),
+		To:           os.Getenv("SYNC_TO"),
+	}
+	if err := app.syncService.LoadRules(rules); err != nil {
+		return err
+	}
+
+	// Post-sync processors, run in the order they are added
+	timeout, _ := time.ParseDuration(os.Getenv("PROCESSOR_TIMEOUT"))
+	if url := os.Getenv("SYNC_WEBHOOK_URL"); url != "" {
+		app.syncService.AddProcessor(processors.NewWebhook(url), timeout)
+	}
+	if target := os.Getenv("INFLUX_TARGET"); target != "" {
+		influx, err := processors.NewInflux(influxOptions(target))
+		if err != nil {
+			return fmt.Errorf("failed to open influx target: %w", err)
+		}
+		app.syncService.AddProcessor(influx, timeout)
+	}
+
+	// Every sync, whatever triggered it, goes through the coordinator
+	app.coordinator = sync.NewCoordinator(app.syncService)
 
-	// Setup cron scheduler
-	app.cron = cron.New()
+	return nil
+}
+
+// initServer recovers from an interrupted sync and sets up the scheduler and
+// HTTP server, which one-shot commands do not need. Recovery only runs here:
+// a command started next to a running daemon would otherwise clean up the
+// files of the daemon's sync in progress.
+func (app *App) initServer() error {
+	// Clean up after any sync that was interrupted mid-batch. A job another
+	// process is running is not interrupted, so there is nothing to recover.
+	report, err := app.syncService.Recover()
+	switch {
+	case errors.Is(err, sync.ErrJobRunning):
+		log.Printf("Startup recovery skipped: %v", err)
+	case err != nil:
+		return fmt.Errorf("startup recovery failed: %w", err)
+	case report.TempFilesRemoved > 0 || len(report.RestoredFiles) > 0 || len(report.OrphanFiles) > 0 || len(report.MissingFiles) > 0:
+		log.Printf("Recovery: removed %d temp files, restored %d files, moved %d orphan files, %d activities missing their file",
+			report.TempFilesRemoved, len(report.RestoredFiles), len(report.OrphanFiles), len(report.MissingFiles))
+	}
+
+	// Setup scheduler; its schedule comes from daemon_config
+	app.scheduler = scheduler.New(app.db, app.syncService, app.coordinator)
 
 	// Setup HTTP server
-	webHandler := web.NewWebHandler(app.db, app.syncService, app.garmin)
+	app.webHandler = web.NewWebHandler(app.db, app.syncService, app.coordinator, app.scheduler, app.garmin)
+	app.webHandler.SetImportDir(os.Getenv("IMPORT_DIR"))
 	// We've removed template loading since we're using static frontend
 	app.server = &http.Server{
 		Addr:    ":8888",
-		Handler: app.setupRoutes(webHandler),
+		Handler: app.setupRoutes(app.webHandler),
 	}
-
 	return nil
 }
 
 func (app *App) start() {
-	// Start cron scheduler
-	app.cron.AddFunc("@hourly", func() {
-		log.Println("Starting scheduled sync...")
-		if err := app.syncService.Sync(context.Background()); err != nil {
-			log.Printf("Sync failed: %v", err)
-		}
-	})
-	app.cron.Start()
+	// Start scheduler
+	if err := app.scheduler.Start(); err != nil {
+		log.Printf("Scheduler not started: %v", err)
+	}
 
 	// Start web server
 	go func() {
@@ -115,8 +194,11 @@ func (app *App) start() {
 func (app *App) stop() {
 	log.Println("Shutting down...")
 
-	// Stop cron
-	app.cron.Stop()
+	// Stop the scheduler, any sync still running and jobs started through
+	// the API
+	app.coordinator.Stop()
+	app.scheduler.Stop()
+	app.webHandler.Stop()
 
 	// Stop web server
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -126,6 +208,9 @@ func (app *App) stop() {
 		log.Printf("Server shutdown error: %v", err)
 	}
 
+	// Close processor targets, such as an Influx file
+	app.closeProcessors()
+
 	// Close database
 	if app.db != nil {
 		app.db.Close()
@@ -134,6 +219,35 @@ func (app *App) stop() {
 	log.Println("Shutdown complete")
 }
 
+// closeProcessors closes the post-sync processors, such as an Influx file
+// target
+func (app *App) closeProcessors() {
+	if err := app.syncService.CloseProcessors(); err != nil {
+		log.Printf("Processor shutdown error: %v", err)
+	}
+}
+
+// splitList splits a comma-separated environment value
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// influxOptions reads the Influx processor settings besides the target from
+// the environment
+func influxOptions(target string) processors.InfluxOptions {
+	batchSize, _ := strconv.Atoi(os.Getenv("INFLUX_BATCH_SIZE"))
+	maxRetries, _ := strconv.Atoi(os.Getenv("INFLUX_MAX_RETRIES"))
+	return processors.InfluxOptions{
+		Target:     target,
+		Token:      os.Getenv("INFLUX_TOKEN"),
+		BatchSize:  batchSize,
+		MaxRetries: maxRetries,
+	}
+}
+
 // Database initialization
 func initDatabase() (*database.SQLiteDB, error) {
 	// Get database path from environment or use default
@@ -183,7 +297,7 @@ func (app *App) setupRoutes(webHandler *web.WebHandler) http.Handler {
 	// Enable CORS for development
 	router.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Content-Type")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)